@@ -20,10 +20,14 @@ import (
 	"syscall"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
 	"github.com/SamSafonov2025/metrics-tpl/internal/crypto"
 	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+	"github.com/SamSafonov2025/metrics-tpl/internal/tracing"
 
 	"github.com/SamSafonov2025/metrics-tpl/internal/config"
 
@@ -118,6 +122,9 @@ type MetricsSender struct {
 	serverAddress string
 	client        *http.Client
 	cryptoKey     string
+	// agentID и agentVersion передаются серверу в каждом запросе (heartbeat)
+	agentID      string
+	agentVersion string
 }
 
 func NewMetricsSender(serverAddress string, cryptoKey string) *MetricsSender {
@@ -169,21 +176,23 @@ func retryCtx(ctx context.Context, fn func() error, isRetryable func(error) bool
 		err := fn()
 		if err == nil {
 			if i > 0 {
-				fmt.Printf("agent: retry succeeded on attempt %d/%d\n", i+1, attempts)
+				logger.FromContext(ctx).Info("agent: retry succeeded", zap.Int("attempt", i+1), zap.Int("attempts", attempts))
 			}
 			return nil
 		}
 		retry := isRetryable(err) && i < len(backoffs)
 		if retry {
-			fmt.Printf("agent: attempt %d/%d failed: %v — next in %s\n", i+1, attempts, err, backoffs[i])
+			logger.FromContext(ctx).Warn("agent: attempt failed, will retry",
+				zap.Int("attempt", i+1), zap.Int("attempts", attempts), zap.Duration("backoff", backoffs[i]), zap.Error(err))
 		} else {
-			fmt.Printf("agent: attempt %d/%d failed: %v — stop\n", i+1, attempts, err)
+			logger.FromContext(ctx).Warn("agent: attempt failed, giving up",
+				zap.Int("attempt", i+1), zap.Int("attempts", attempts), zap.Error(err))
 			return err
 		}
 		select {
 		case <-time.After(backoffs[i]):
 		case <-ctx.Done():
-			fmt.Println("agent: retry aborted:", ctx.Err())
+			logger.FromContext(ctx).Warn("agent: retry aborted", zap.Error(ctx.Err()))
 			return ctx.Err()
 		}
 	}
@@ -191,48 +200,70 @@ func retryCtx(ctx context.Context, fn func() error, isRetryable func(error) bool
 }
 
 // ———— HTTP helpers ————
-func (s *MetricsSender) postGzJSONCtx(ctx context.Context, path string, payload any) error {
+// postGzJSONCtx отправляет payload одним запросом; каждая попытка — отдельный
+// клиентский спан, контекст которого уходит на сервер в заголовке traceparent.
+func (s *MetricsSender) postGzJSONCtx(ctx context.Context, path string, payload any) (err error) {
+	ctx, span := tracing.Start(ctx, "POST "+path, trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { tracing.End(span, err) }()
+
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	var buf bytes.Buffer
-	gz := gzip.NewWriter(&buf)
-	if _, err := gz.Write(jsonData); err != nil {
-		return err
-	}
-	if err := gz.Close(); err != nil {
+	buf, err := gzipBody(ctx, jsonData)
+	if err != nil {
 		return err
 	}
 
 	urlStr := fmt.Sprintf("http://%s%s", s.serverAddress, path)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlStr, &buf)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlStr, buf)
 	if err != nil {
 		return err
 	}
+	tracing.Inject(ctx, req.Header)
 
+	_, hashSpan := tracing.Start(ctx, "hmac.sign")
 	hash := crypto.GenerateHash(jsonData, s.cryptoKey)
+	hashSpan.End()
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Content-Encoding", "gzip")
 	if s.cryptoKey != "" {
 		req.Header.Set("HashSHA256", hash) // подписываем ДЕГЗИПНУТОЕ json-тело
 	}
+	if id := logger.RequestID(ctx); id != "" {
+		req.Header.Set(consts.HeaderRequestID, id)
+	}
+	if s.agentID != "" {
+		req.Header.Set(consts.HeaderAgentID, s.agentID)
+		req.Header.Set(consts.HeaderAgentVersion, s.agentVersion)
+	}
 
 	const maxDump = 512
-	fmt.Printf("agent: POST %s | json=%dB gz=%dB | hash=%s\n",
-		urlStr, len(jsonData), buf.Len(), maskHash(hash))
+	logger.FromContext(ctx).Debug("agent: POST",
+		zap.String("url", urlStr),
+		zap.Int("json_bytes", len(jsonData)),
+		zap.Int("gzip_bytes", buf.Len()),
+		zap.Bool("signed", s.cryptoKey != ""),
+	)
 
 	start := time.Now()
 	resp, err := s.client.Do(req)
 	dur := time.Since(start)
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
 	if err != nil {
-		fmt.Printf("agent: request error (%s) after %s: %v\n", path, dur, err)
+		logger.FromContext(ctx).Warn("agent: request error", zap.String("path", path), zap.Duration("duration", dur), zap.Error(err))
 		return err
 	}
 	defer resp.Body.Close()
 	body, _ := io.ReadAll(io.LimitReader(resp.Body, int64(maxDump)))
-	fmt.Printf("agent: response %s -> %d in %s | preview=%s\n",
-		path, resp.StatusCode, dur, shortStr(strings.TrimSpace(string(body)), maxDump))
+	logger.FromContext(ctx).Debug("agent: response",
+		zap.String("path", path),
+		zap.Int("status", resp.StatusCode),
+		zap.Duration("duration", dur),
+		zap.String("preview", shortStr(strings.TrimSpace(string(body)), maxDump)),
+	)
 
 	if resp.StatusCode != http.StatusOK {
 		return httpStatusError(resp.StatusCode)
@@ -240,18 +271,52 @@ func (s *MetricsSender) postGzJSONCtx(ctx context.Context, path string, payload
 	return nil
 }
 
-func (s *MetricsSender) SendBatchJSONCtx(ctx context.Context, batch []Metrics) error {
+// gzipBody сжимает тело запроса (спан gzip.compress).
+func gzipBody(ctx context.Context, data []byte) (_ *bytes.Buffer, err error) {
+	_, span := tracing.Start(ctx, "gzip.compress")
+	defer func() { tracing.End(span, err) }()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Int("gzip.bytes_in", len(data)),
+		attribute.Int("gzip.bytes_out", buf.Len()),
+	)
+	return &buf, nil
+}
+
+// SendBatchJSONCtx отправляет батч с ретраями, при неудаче — по одной метрике.
+// Все попытки собираются в одну трассу со спаном agent.send_batch и несут
+// один X-Request-ID.
+func (s *MetricsSender) SendBatchJSONCtx(ctx context.Context, batch []Metrics) (err error) {
 	if len(batch) == 0 {
 		return nil
 	}
-	fmt.Printf("agent: sending batch (%d metrics) -> /updates/\n", len(batch))
-	err := retryCtx(ctx, func() error { return s.postGzJSONCtx(ctx, "/updates/", batch) }, isRetryableHTTPOrNetErr)
+	// один X-Request-ID на батч: попытки и fallback по одной метрике
+	// видны в логах агента, сервера и в аудите под одним идентификатором
+	requestID := logger.NewRequestID()
+	ctx = logger.WithRequestID(ctx, requestID)
+	ctx, span := tracing.Start(ctx, "agent.send_batch",
+		trace.WithAttributes(
+			attribute.Int("metrics.count", len(batch)),
+			attribute.String("request_id", requestID),
+		))
+	defer func() { tracing.End(span, err) }()
+	logger.FromContext(ctx).Debug("agent: sending batch", zap.Int("metrics", len(batch)))
+	err = retryCtx(ctx, func() error { return s.postGzJSONCtx(ctx, "/updates/", batch) }, isRetryableHTTPOrNetErr)
 	if err == nil {
-		fmt.Println("agent: batch sent successfully")
+		logger.FromContext(ctx).Info("agent: batch sent", zap.Int("metrics", len(batch)))
 		return nil
 	}
 	// fallback: по одной
-	fmt.Printf("agent: batch send failed (%v), fallback to singles...\n", err)
+	logger.FromContext(ctx).Warn("agent: batch send failed, fallback to singles", zap.Error(err))
+	span.SetAttributes(attribute.Bool("agent.fallback", true))
 	var firstErr error
 	for i, m := range batch {
 		e := retryCtx(ctx, func() error { return s.postGzJSONCtx(ctx, "/update", m) }, isRetryableHTTPOrNetErr)
@@ -259,7 +324,8 @@ func (s *MetricsSender) SendBatchJSONCtx(ctx context.Context, batch []Metrics) e
 			firstErr = e
 		}
 		if e != nil {
-			fmt.Printf("agent: single send failed for #%d (%s/%s): %v\n", i, m.MType, m.ID, e)
+			logger.FromContext(ctx).Warn("agent: single send failed",
+				zap.Int("index", i), zap.String("type", m.MType), zap.String("id", m.ID), zap.Error(e))
 		}
 	}
 	return firstErr
@@ -276,15 +342,18 @@ type Agent struct {
 	jobs      chan []Metrics
 }
 
-func NewAgent(pollInterval, reportInterval time.Duration, serverAddress, cryptoKey string, rateLimit int) *Agent {
+func NewAgent(pollInterval, reportInterval time.Duration, serverAddress, cryptoKey string, rateLimit int, agentID string) *Agent {
 	if rateLimit < 1 {
 		rateLimit = 1
 	}
+	sender := NewMetricsSender(serverAddress, cryptoKey)
+	sender.agentID = agentID
+	sender.agentVersion = buildVersion
 	return &Agent{
 		pollInterval:   pollInterval,
 		reportInterval: reportInterval,
 		collector:      NewMetricsCollector(),
-		sender:         NewMetricsSender(serverAddress, cryptoKey),
+		sender:         sender,
 		rateLimit:      rateLimit,
 		// небольшой буфер, чтобы сбор не стопорился при кратковременных всплесках
 		jobs: make(chan []Metrics, rateLimit*2),
@@ -298,8 +367,14 @@ func (a *Agent) Start(ctx context.Context) {
 	defer pollTicker.Stop()
 	defer reportTicker.Stop()
 
-	fmt.Printf("agent: started | poll=%s report=%s | server=%s | hmac=%t | workers=%d\n",
-		a.pollInterval, a.reportInterval, a.sender.serverAddress, a.sender.cryptoKey != "", a.rateLimit)
+	logger.GetLogger().Info("agent: started",
+		zap.String("agent_id", a.sender.agentID),
+		zap.Duration("poll_interval", a.pollInterval),
+		zap.Duration("report_interval", a.reportInterval),
+		zap.String("server", a.sender.serverAddress),
+		zap.Bool("hmac", a.sender.cryptoKey != ""),
+		zap.Int("workers", a.rateLimit),
+	)
 
 	// (4) стартуем пул отправителей
 	for i := 0; i < a.rateLimit; i++ {
@@ -345,7 +420,7 @@ func (a *Agent) Start(ctx context.Context) {
 				delta := a.collector.pollCount
 				batch = append(batch, Metrics{ID: "PollCount", MType: "counter", Delta: &delta})
 
-				fmt.Printf("agent: enqueue runtime report | gauges=%d counters=1 pollCount=%d\n", len(collected), delta)
+				logger.GetLogger().Debug("agent: enqueue runtime report", zap.Int("gauges", len(collected)), zap.Int64("poll_count", delta))
 				a.jobs <- batch
 				// сбрасываем pollCount только ПОСЛЕ постановки в очередь
 				a.collector.pollCount = 0
@@ -364,7 +439,7 @@ func (a *Agent) Start(ctx context.Context) {
 			case <-sysTicker.C:
 				sysMetrics := CollectSystemGauges()
 				if len(sysMetrics) > 0 {
-					fmt.Printf("agent: enqueue system gauges | n=%d\n", len(sysMetrics))
+					logger.GetLogger().Debug("agent: enqueue system gauges", zap.Int("gauges", len(sysMetrics)))
 					a.jobs <- sysMetrics
 				}
 			}
@@ -373,7 +448,7 @@ func (a *Agent) Start(ctx context.Context) {
 
 	// ожидание сигнала завершения
 	<-ctx.Done()
-	fmt.Println("agent: shutdown")
+	logger.GetLogger().Info("agent: shutdown")
 }
 
 // — обёртки для тестов (оставляем как было) —
@@ -388,15 +463,6 @@ func shortStr(s string, n int) string {
 	}
 	return s[:n] + "...(truncated)"
 }
-func maskHash(h string) string {
-	if h == "" {
-		return ""
-	}
-	if len(h) <= 10 {
-		return h
-	}
-	return h[:10] + "…"
-}
 
 // ---- main ----
 func main() {
@@ -407,7 +473,11 @@ func main() {
 
 	cfg := config.ParseAgentFlags()
 
-	if err := logger.Init(); err != nil {
+	if err := logger.Init(logger.Config{
+		Level:    cfg.LogLevel,
+		Format:   cfg.LogFormat,
+		Sampling: cfg.LogSampling,
+	}); err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 
@@ -415,11 +485,25 @@ func main() {
 		zap.String("server_address", cfg.ServerAddress),
 		zap.Duration("poll_interval", cfg.PollInterval),
 		zap.Duration("report_interval", cfg.ReportInterval),
-		zap.String("crypto_key", cfg.CryptoKey),
+		zap.Bool("hmac", cfg.CryptoKey != ""),
 		zap.Int("rate_limit", cfg.RateLimit),
+		zap.String("agent_id", cfg.AgentID),
+		zap.String("trace_exporter", cfg.TraceExporter),
 	)
 
-	agent := NewAgent(cfg.PollInterval, cfg.ReportInterval, cfg.ServerAddress, cfg.CryptoKey, cfg.RateLimit)
+	shutdownTracing, err := tracing.Init(context.Background(), "metrics-agent", cfg.TraceExporter, cfg.OTLPEndpoint)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.GetLogger().Warn("agent: tracing shutdown failed", zap.Error(err))
+		}
+	}()
+
+	agent := NewAgent(cfg.PollInterval, cfg.ReportInterval, cfg.ServerAddress, cfg.CryptoKey, cfg.RateLimit, cfg.AgentID)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -2,6 +2,7 @@ package main
 
 import (
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -9,6 +10,14 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/tracing"
 )
 
 func TestMetricsSender_SendBatchJSON(t *testing.T) {
@@ -57,3 +66,64 @@ func TestMetricsSender_SendBatchJSON(t *testing.T) {
 	err := sender.SendBatchJSON([]Metrics{metric})
 	assert.NoError(t, err, "Sending should not produce error")
 }
+
+func TestMetricsSender_PropagatesTraceparent(t *testing.T) {
+	_, err := tracing.Init(context.Background(), "test", tracing.ExporterNone, "")
+	require.NoError(t, err)
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(prev)
+
+	var remote trace.SpanContext
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(t, r.Header.Get("traceparent"))
+		remote = trace.SpanContextFromContext(tracing.Extract(r.Context(), r.Header))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewMetricsSender(server.Listener.Addr().String(), "123")
+	value := 1.5
+	require.NoError(t, sender.SendBatchJSON([]Metrics{{ID: "g", MType: "gauge", Value: &value}}))
+
+	names := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range rec.Ended() {
+		names[s.Name()] = s
+	}
+	require.Contains(t, names, "agent.send_batch")
+	require.Contains(t, names, "POST /updates/")
+	assert.Contains(t, names, "gzip.compress")
+	assert.Contains(t, names, "hmac.sign")
+
+	// сервер продолжает трассу от клиентского спана попытки
+	post := names["POST /updates/"]
+	assert.Equal(t, names["agent.send_batch"].SpanContext().TraceID(), remote.TraceID())
+	assert.Equal(t, post.SpanContext().SpanID(), remote.SpanID())
+	assert.True(t, remote.IsRemote())
+}
+
+func TestMetricsSender_RequestIDPerBatch(t *testing.T) {
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(consts.HeaderRequestID))
+		if len(ids) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable) // первая попытка — ретрай
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewMetricsSender(server.Listener.Addr().String(), "")
+	value := 1.0
+	batch := []Metrics{{ID: "g", MType: "gauge", Value: &value}}
+	require.NoError(t, sender.SendBatchJSON(batch))
+	require.NoError(t, sender.SendBatchJSON(batch))
+
+	// ретрай несёт тот же идентификатор, следующий батч — новый
+	require.Len(t, ids, 3)
+	assert.NotEmpty(t, ids[0])
+	assert.Equal(t, ids[0], ids[1])
+	assert.NotEqual(t, ids[0], ids[2])
+}
@@ -0,0 +1,77 @@
+// Команда auditverify проверяет цепочку хешей файлов аудита сервера.
+//
+// Использование:
+//
+//	auditverify [-k KEY] FILE...
+//
+// Файлы передаются от старых к новым: сначала ротированные
+// (audit.log.20261018T120000.000 или сжатые .gz), последним — текущий audit.log.
+// Ключ берётся из -k или переменной окружения AUDIT_KEY и должен совпадать
+// с -audit-key сервера; без ключа цепочка проверяется по SHA-256.
+//
+// Код выхода 0 — цепочка цела, 1 — найдено нарушение (печатается первая
+// изменённая строка) или ошибка чтения.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/audit"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "auditverify:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("auditverify", flag.ContinueOnError)
+	key := fs.String("k", os.Getenv("AUDIT_KEY"), "Audit chain HMAC key (env AUDIT_KEY)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: auditverify [-k KEY] FILE...")
+	}
+
+	v := audit.NewChainVerifier([]byte(*key))
+	for _, name := range fs.Args() {
+		if err := verifyFile(v, name); err != nil {
+			var ce *audit.ChainError
+			if errors.As(err, &ce) {
+				return fmt.Errorf("tampered: %w", err)
+			}
+			return err
+		}
+	}
+
+	if v.Lines == 0 {
+		return errors.New("no chained lines found")
+	}
+	fmt.Fprintf(out, "ok: %d lines, seq %d..%d, %d checkpoints\n", v.Lines, v.FirstSeq, v.LastSeq(), v.Checks)
+	if v.Unchained > 0 {
+		fmt.Fprintf(out, "warning: %d lines before the chain started are covered only by the first chained line\n", v.Unchained)
+	}
+	if v.Recovered > 0 {
+		fmt.Fprintf(out, "warning: %d torn lines (%d bytes) were dropped by the server after a crash\n", v.Recovered, v.Dropped)
+	}
+	if v.Unsealed > 0 {
+		fmt.Fprintf(out, "note: %d lines after the last checkpoint; the very last one is not protected until the next write\n", v.Unsealed)
+	}
+	return nil
+}
+
+func verifyFile(v *audit.ChainVerifier, name string) error {
+	f, err := audit.OpenLog(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return v.VerifyFile(name, f)
+}
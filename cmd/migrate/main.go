@@ -0,0 +1,111 @@
+// Команда migrate управляет схемой PostgreSQL-хранилища метрик.
+//
+// Использование:
+//
+//	migrate [-d DSN] [-steps N] up|down|status|notify-off
+//
+//	up          применить ещё не применённые миграции (-steps ограничивает их число)
+//	down        откатить последние применённые миграции (по умолчанию одну)
+//	status      показать встроенные миграции и время их применения (только чтение)
+//	notify-off  снять триггеры уведомлений кеша, поставленные сервером с -cache-notify
+//
+// DSN берётся из -d или переменной окружения DATABASE_DSN.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/postgres"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dsn := fs.String("d", os.Getenv("DATABASE_DSN"), "Database connection string (env DATABASE_DSN)")
+	steps := fs.Int("steps", 0, "Number of migrations to apply (up, 0 = all) or roll back (down, 0 = one)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: migrate [-d DSN] [-steps N] up|down|status|notify-off")
+	}
+	if *dsn == "" {
+		return errors.New("database DSN is not set (-d or DATABASE_DSN)")
+	}
+
+	pool, err := postgres.Open(*dsn)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch cmd := fs.Arg(0); cmd {
+	case "up":
+		done, err := postgres.MigrateUp(ctx, pool, *steps)
+		report(out, "applied", done)
+		return err
+	case "down":
+		done, err := postgres.MigrateDown(ctx, pool, *steps)
+		report(out, "rolled back", done)
+		return err
+	case "status":
+		states, err := postgres.MigrationStatus(ctx, pool)
+		if errors.Is(err, postgres.ErrNotInitialized) {
+			// ни одна миграция не применялась — все встроенные в статусе pending
+			fmt.Fprintln(out, "schema_migrations: not initialized (run migrate up)")
+			all, err := postgres.Migrations()
+			if err != nil {
+				return err
+			}
+			for _, m := range all {
+				states = append(states, postgres.MigrationState{Migration: m})
+			}
+		} else if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, st := range states {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%06d\t%s\t%s\n", st.Version, st.Name, applied)
+		}
+		return tw.Flush()
+	case "notify-off":
+		if err := postgres.DisableNotify(ctx, pool); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "notify triggers removed")
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q (want up, down, status or notify-off)", cmd)
+	}
+}
+
+func report(out io.Writer, verb string, versions []int64) {
+	if len(versions) == 0 {
+		fmt.Fprintf(out, "nothing %s\n", verb)
+		return
+	}
+	for _, v := range versions {
+		fmt.Fprintf(out, "%s %06d\n", verb, v)
+	}
+}
@@ -231,7 +231,7 @@ func generateLoad(storage *memstorage.MemStorage) {
 		switch rand.Intn(3) {
 		case 0:
 			// Чтение
-			_, _ = storage.GetGauge(ctx, fmt.Sprintf("gauge_%d", rand.Intn(numMetrics)))
+			_, _, _ = storage.GetGauge(ctx, fmt.Sprintf("gauge_%d", rand.Intn(numMetrics)))
 		case 1:
 			// Запись gauge
 			_ = storage.SetGauge(ctx, fmt.Sprintf("gauge_%d", rand.Intn(numMetrics)), rand.Float64()*1000)
@@ -242,8 +242,8 @@ func generateLoad(storage *memstorage.MemStorage) {
 
 		// Периодически читаем все метрики (создаем аллокации)
 		if rand.Intn(100) == 0 {
-			_ = storage.GetAllGauges(ctx)
-			_ = storage.GetAllCounters(ctx)
+			_, _ = storage.GetAllGauges(ctx)
+			_, _ = storage.GetAllCounters(ctx)
 		}
 
 		// Периодически делаем батч-обновления
@@ -261,8 +261,9 @@ func serializeMetrics(storage *memstorage.MemStorage, bufferPool *sync.Pool) {
 	ctx := context.Background()
 
 	for {
-		gauges := storage.GetAllGauges(ctx)
-		counters := storage.GetAllCounters(ctx)
+		// MemStorage не возвращает ошибок чтения
+		gauges, _ := storage.GetAllGauges(ctx)
+		counters, _ := storage.GetAllCounters(ctx)
 
 		// Создаем структуру для сериализации
 		type MetricsResponse struct {
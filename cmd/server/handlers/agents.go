@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/agents"
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+)
+
+// AgentsHandler возвращает список агентов с временем последнего отчёта,
+// версией и состоянием (up/stale/down) в JSON.
+//
+// Endpoint: GET /agents
+func (h *Handler) AgentsHandler(rw http.ResponseWriter, r *http.Request) {
+	list := []agents.Agent{}
+	if h.Agents != nil {
+		list = h.Agents.List()
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(rw).Encode(list); err != nil {
+		logger.FromContext(r.Context()).Error("AgentsHandler encode error", zapError(err))
+	}
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/alerting"
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+)
+
+// AlertsHandler возвращает текущее состояние всех правил алертов в JSON.
+// Если движок алертов не настроен, возвращает пустой список.
+//
+// Endpoint: GET /alerts
+func (h *Handler) AlertsHandler(rw http.ResponseWriter, r *http.Request) {
+	alerts := []alerting.Alert{}
+	if h.Alerts != nil {
+		alerts = h.Alerts.Alerts()
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(rw).Encode(alerts); err != nil {
+		logger.FromContext(r.Context()).Error("AlertsHandler encode error", zapError(err))
+	}
+}
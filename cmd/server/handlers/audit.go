@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/audit"
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+)
+
+// Audit — middleware аудита маршрутов обновления метрик. Ставится перед
+// проверкой HMAC, чтобы видеть и отклонённые ею запросы. Обработчики
+// дописывают в запись аудита метрики и код ошибки (noteAudit, rejectAudit),
+// а событие отправляется после ответа. Неуспешные запросы попадают в аудит
+// только при подробности failures или values. Без AuditPublisher — no-op.
+func (h *Handler) Audit(next http.Handler) http.Handler {
+	if h.AuditPublisher == nil {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		verbosity := h.AuditPublisher.Verbosity()
+		ctx, rec := audit.WithRecord(r.Context(), verbosity == audit.VerbosityValues)
+		sw := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		event := rec.Event(sw.status)
+		if event.Outcome != audit.OutcomeSuccess && verbosity == audit.VerbosityBasic {
+			return
+		}
+		event.Timestamp = time.Now().Unix()
+		event.IPAddress = getClientIP(r)
+		event.RequestID = logger.RequestID(ctx)
+		event.Endpoint = endpoint(r)
+		event.UserAgent = r.UserAgent()
+		event.AgentID = r.Header.Get(consts.HeaderAgentID)
+		h.AuditPublisher.NotifyAll(event)
+	})
+}
+
+// noteAudit передаёт в аудит метрики запроса с их значениями из самого
+// запроса; хранилище не читается. Вызывается до записи в хранилище.
+func (h *Handler) noteAudit(r *http.Request, items []dto.Metrics) {
+	ctx := r.Context()
+	if !audit.Recording(ctx) {
+		return
+	}
+	changes := make([]audit.MetricChange, len(items))
+	for i, m := range items {
+		changes[i] = audit.MetricChange{ID: m.ID, MType: m.MType, Value: m.Value, Delta: m.Delta}
+	}
+	audit.Note(ctx, changes...)
+}
+
+// noteTotal передаёт в аудит итог counter, который вернул сервис после записи.
+func noteTotal(r *http.Request, m dto.Metrics) {
+	if m.MType == consts.MetricTypeCounter && m.Delta != nil {
+		audit.NoteTotal(r.Context(), m.ID, *m.Delta)
+	}
+}
+
+// rejectAudit отмечает в аудите код ошибки запроса и метрики, если они ещё не отмечены.
+func rejectAudit(r *http.Request, code string, items ...dto.Metrics) {
+	for _, m := range items {
+		audit.Note(r.Context(), audit.MetricChange{ID: m.ID, MType: m.MType})
+	}
+	audit.Reject(r.Context(), code)
+}
+
+// endpoint — метод и шаблон маршрута chi (без значений из URL).
+func endpoint(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if p := rctx.RoutePattern(); p != "" {
+			return r.Method + " " + p
+		}
+	}
+	return r.Method + " " + r.URL.Path
+}
+
+// statusRecorder запоминает код ответа для события аудита.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// getClientIP извлекает IP адрес клиента из запроса
+func getClientIP(r *http.Request) string {
+	// Пробуем получить IP из заголовков прокси
+	ip := r.Header.Get("X-Real-IP")
+	if ip == "" {
+		ip = r.Header.Get("X-Forwarded-For")
+		if ip != "" {
+			// X-Forwarded-For может содержать список IP, берем первый
+			if idx := strings.Index(ip, ","); idx != -1 {
+				ip = ip[:idx]
+			}
+		}
+	}
+	// Если заголовков нет, берем из RemoteAddr
+	if ip == "" {
+		ip = r.RemoteAddr
+		// RemoteAddr может содержать порт, убираем его
+		if idx := strings.LastIndex(ip, ":"); idx != -1 {
+			ip = ip[:idx]
+		}
+	}
+	return strings.TrimSpace(ip)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dashboard"
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+	"github.com/SamSafonov2025/metrics-tpl/internal/service"
+)
+
+// MetricPageHandler возвращает HTML-страницу отдельной метрики.
+//
+// Endpoint: GET /metric/{metricType}/{metricName}
+//
+// Возвращает:
+//   - HTTP 200 и страницу метрики
+//   - HTTP 400 при некорректном типе метрики
+//   - HTTP 404 если метрика не найдена
+//   - HTTP 500 при внутренней ошибке
+//   - HTTP 503 если хранилище недоступно
+func (h *Handler) MetricPageHandler(rw http.ResponseWriter, r *http.Request) {
+	typ := chi.URLParam(r, "metricType")
+	id := chi.URLParam(r, "metricName")
+
+	m, err := h.Svc.Get(r.Context(), typ, id)
+	if err == service.ErrInvalidType {
+		http.Error(rw, "Invalid metric type", http.StatusBadRequest)
+		return
+	}
+	if err == service.ErrNotFound {
+		http.Error(rw, "Metric not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Error("MetricPageHandler Get failed", zapError(err))
+		writeStorageError(rw, err)
+		return
+	}
+
+	page := dashboard.MetricPage{Row: dashboard.Row{Name: m.ID, Type: m.MType}}
+	if m.MType == consts.MetricTypeGauge {
+		page.Value = dashboard.FormatGauge(*m.Value)
+	} else {
+		page.Value = dashboard.FormatCounter(*m.Delta)
+	}
+
+	buf := h.bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer h.bufferPool.Put(buf)
+
+	if err := dashboard.RenderMetric(buf, page); err != nil {
+		logger.FromContext(r.Context()).Error("MetricPageHandler render error", zapError(err))
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(buf.Bytes())
+}
+
+// MetricsListHandler возвращает все метрики отсортированным JSON-массивом.
+// Используется дашбордом для автообновления; поддерживает фильтр ?q=.
+//
+// Endpoint: GET /api/metrics
+//
+// Формат ответа:
+//
+//	[{"id":"Alloc","type":"gauge","value":"123.4"},{"id":"PollCount","type":"counter","value":"5"}]
+func (h *Handler) MetricsListHandler(rw http.ResponseWriter, r *http.Request) {
+	gauges, counters, err := h.Svc.List(r.Context())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("MetricsListHandler List failed", zapError(err))
+		writeStorageError(rw, err)
+		return
+	}
+	g, c := dashboard.Rows(gauges, counters, r.URL.Query().Get("q"))
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(rw).Encode(append(g, c...)); err != nil {
+		logger.FromContext(r.Context()).Error("MetricsListHandler encode error", zapError(err))
+	}
+}
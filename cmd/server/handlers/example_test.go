@@ -125,7 +125,7 @@ func ExampleHandler_UpdateHandlerJSON() {
 	fmt.Printf("Статус: %d\n", rr.Code)
 
 	// Проверяем сохраненное значение
-	val, exists := repo.GetGauge(context.Background(), "cpu_usage")
+	val, exists, _ := repo.GetGauge(context.Background(), "cpu_usage")
 	if exists {
 		fmt.Printf("Сохраненное значение: %.1f\n", val)
 	}
@@ -223,9 +223,9 @@ func ExampleHandler_UpdateMetrics() {
 	fmt.Printf("Статус: %d\n", rr.Code)
 
 	// Проверяем сохраненные значения
-	temp, _ := repo.GetGauge(context.Background(), "temperature")
-	hum, _ := repo.GetGauge(context.Background(), "humidity")
-	reqCount, _ := repo.GetCounter(context.Background(), "total_requests")
+	temp, _, _ := repo.GetGauge(context.Background(), "temperature")
+	hum, _, _ := repo.GetGauge(context.Background(), "humidity")
+	reqCount, _, _ := repo.GetCounter(context.Background(), "total_requests")
 
 	fmt.Printf("temperature: %.1f\n", temp)
 	fmt.Printf("humidity: %.1f\n", hum)
@@ -265,7 +265,7 @@ func ExampleHandler_UpdateHandler() {
 	fmt.Printf("Статус: %d\n", rr.Code)
 
 	// Проверяем значение
-	val, exists := repo.GetGauge(context.Background(), "cpu_temp")
+	val, exists, _ := repo.GetGauge(context.Background(), "cpu_temp")
 	if exists {
 		fmt.Printf("cpu_temp: %.1f\n", val)
 	}
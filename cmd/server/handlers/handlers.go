@@ -7,20 +7,26 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
-	"strings"
 	"sync"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
+	"github.com/SamSafonov2025/metrics-tpl/internal/agents"
+	"github.com/SamSafonov2025/metrics-tpl/internal/alerting"
 	"github.com/SamSafonov2025/metrics-tpl/internal/audit"
 	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dashboard"
 	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/health"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/leader"
 	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
 	"github.com/SamSafonov2025/metrics-tpl/internal/service"
+	"github.com/SamSafonov2025/metrics-tpl/internal/stream"
 )
 
 // Handler содержит зависимости для обработки HTTP-запросов метрик.
@@ -28,10 +34,20 @@ import (
 type Handler struct {
 	Svc            service.MetricsService
 	AuditPublisher *audit.AuditPublisher
+	// Alerts — движок алертов для GET /alerts; nil, если правила не заданы
+	Alerts *alerting.Engine
+	// Agents — реестр агентов для GET /agents; nil, если не используется
+	Agents *agents.Registry
+	// Stream — хаб потока обновлений для GET /stream; nil, если поток отключён
+	Stream *stream.Hub
+	// Health — проверки готовности для GET /readyz; nil — всегда готов
+	Health *health.Checker
+	// Build — сведения о сборке для GET /version
+	Build health.BuildInfo
+	// Leader — выбор лидера в HA-режиме (роль показывается в GET /readyz); nil вне HA
+	Leader *leader.Elector
 	// bufferPool переиспользует буферы для JSON encoding/decoding
 	bufferPool *sync.Pool
-	// stringSlicePool переиспользует слайсы строк для метрик
-	stringSlicePool *sync.Pool
 }
 
 // NewHandler создает новый экземпляр Handler с заданным сервисом и издателем аудита.
@@ -45,61 +61,53 @@ func NewHandler(svc service.MetricsService, auditPublisher *audit.AuditPublisher
 				return new(bytes.Buffer)
 			},
 		},
-		stringSlicePool: &sync.Pool{
-			New: func() interface{} {
-				s := make([]string, 0, 100)
-				return &s
-			},
-		},
 	}
 }
 
-// Ping проверяет доступность базы данных.
-// Возвращает HTTP 200 при успешном подключении или HTTP 500 при ошибке.
+// Ping проверяет доступность хранилища (БД или файла встраиваемой базы).
+// Возвращает HTTP 200, если хранилище доступно (in-memory — всегда), или HTTP 500 при ошибке.
 //
 // Endpoint: GET /ping
 func (h *Handler) Ping(rw http.ResponseWriter, r *http.Request) {
 	if err := h.Svc.Ping(r.Context()); err != nil {
-		logger.GetLogger().Warn("Ping failed", zapError(err))
+		logger.FromContext(r.Context()).Warn("Ping failed", zapError(err))
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	rw.WriteHeader(http.StatusOK)
 }
 
-// HomeHandler возвращает HTML-страницу со списком всех метрик.
-// Отображает gauge и counter метрики в виде форматированного списка.
+// HomeHandler возвращает HTML-дашборд со списком всех метрик.
+// Gauge и counter метрики выводятся в отсортированных по имени таблицах;
+// параметр ?q= оставляет только метрики, в имени которых есть подстрока.
+// Страница работает и без JavaScript.
 //
 // Endpoint: GET /
 func (h *Handler) HomeHandler(rw http.ResponseWriter, r *http.Request) {
 	gauges, counters, err := h.Svc.List(r.Context())
 	if err != nil {
-		logger.GetLogger().Error("List metrics failed", zapError(err))
-		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.FromContext(r.Context()).Error("List metrics failed", zapError(err))
+		writeStorageError(rw, err)
 		return
 	}
 
-	var sb strings.Builder
-	// Предаллокируем память для улучшения производительности
-	sb.Grow(len(gauges)*50 + len(counters)*50 + 50)
+	query := r.URL.Query().Get("q")
+	page := dashboard.IndexPage{Query: query}
+	page.Gauges, page.Counters = dashboard.Rows(gauges, counters, query)
 
-	sb.WriteString("<h4>Gauges</h4>")
-	for name, v := range gauges {
-		sb.WriteString(name)
-		sb.WriteString(": ")
-		sb.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
-		sb.WriteString("</br>")
-	}
-	sb.WriteString("<h4>Counters</h4>")
-	for name, v := range counters {
-		sb.WriteString(name)
-		sb.WriteString(": ")
-		sb.WriteString(strconv.FormatInt(v, 10))
-		sb.WriteString("</br>")
+	// Используем буфер из пула, чтобы не отдавать частично отрендеренную страницу
+	buf := h.bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer h.bufferPool.Put(buf)
+
+	if err := dashboard.RenderIndex(buf, page); err != nil {
+		logger.FromContext(r.Context()).Error("HomeHandler render error", zapError(err))
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
 	}
 	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
 	rw.WriteHeader(http.StatusOK)
-	_, _ = rw.Write([]byte(sb.String()))
+	_, _ = rw.Write(buf.Bytes())
 }
 
 // UpdateHandler обновляет метрику через URL-параметры (устаревший формат).
@@ -123,7 +131,8 @@ func (h *Handler) UpdateHandler(rw http.ResponseWriter, r *http.Request) {
 		if f, err := strconv.ParseFloat(val, 64); err == nil {
 			m.Value = &f
 		} else {
-			logger.GetLogger().Warn("UpdateHandler bad gauge value", zapString("val", val), zapError(err))
+			logger.FromContext(r.Context()).Warn("UpdateHandler bad gauge value", zapString("val", val), zapError(err))
+			rejectAudit(r, audit.ErrCodeBadValue, m)
 			http.Error(rw, "Bad request", http.StatusBadRequest)
 			return
 		}
@@ -131,22 +140,32 @@ func (h *Handler) UpdateHandler(rw http.ResponseWriter, r *http.Request) {
 		if d, err := strconv.ParseInt(val, 10, 64); err == nil {
 			m.Delta = &d
 		} else {
-			logger.GetLogger().Warn("UpdateHandler bad counter delta", zapString("val", val), zapError(err))
+			logger.FromContext(r.Context()).Warn("UpdateHandler bad counter delta", zapString("val", val), zapError(err))
+			rejectAudit(r, audit.ErrCodeBadValue, m)
 			http.Error(rw, "Bad request", http.StatusBadRequest)
 			return
 		}
 	default:
-		logger.GetLogger().Warn("UpdateHandler invalid metric type", zapString("type", m.MType))
+		logger.FromContext(r.Context()).Warn("UpdateHandler invalid metric type", zapString("type", m.MType))
+		rejectAudit(r, audit.ErrCodeInvalidType, m)
 		http.Error(rw, "Invalid metric type", http.StatusBadRequest)
 		return
 	}
-	if _, err := h.Svc.Update(r.Context(), m); err != nil {
-		logger.GetLogger().Error("UpdateHandler Update failed", zapError(err))
-		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	h.noteAudit(r, []dto.Metrics{m})
+	updated, err := h.Svc.Update(r.Context(), m)
+	if err != nil {
+		if isBadMetric(err) {
+			logger.FromContext(r.Context()).Warn("UpdateHandler bad metric", zapString("name", m.ID), zapError(err))
+			rejectAudit(r, auditCode(err))
+			http.Error(rw, "Bad request", http.StatusBadRequest)
+			return
+		}
+		logger.FromContext(r.Context()).Error("UpdateHandler Update failed", zapError(err))
+		writeStorageError(rw, err)
 		return
 	}
-	// Отправляем событие аудита после успешной обработки
-	h.sendAuditEvent(r, []string{m.ID})
+	noteTotal(r, updated)
+	h.publishUpdates([]dto.Metrics{m})
 	rw.WriteHeader(http.StatusOK)
 }
 
@@ -160,24 +179,25 @@ func (h *Handler) UpdateHandler(rw http.ResponseWriter, r *http.Request) {
 //   - HTTP 400 при некорректном типе метрики
 //   - HTTP 404 если метрика не найдена
 //   - HTTP 500 при внутренней ошибке
+//   - HTTP 503 если хранилище недоступно
 func (h *Handler) GetHandler(rw http.ResponseWriter, r *http.Request) {
 	typ := chi.URLParam(r, "metricType")
 	id := chi.URLParam(r, "metricName")
 
 	m, err := h.Svc.Get(r.Context(), typ, id)
 	if err == service.ErrInvalidType {
-		logger.GetLogger().Warn("GetHandler invalid type", zapString("type", typ))
+		logger.FromContext(r.Context()).Warn("GetHandler invalid type", zapString("type", typ))
 		http.Error(rw, "Invalid metric type", http.StatusBadRequest)
 		return
 	}
 	if err == service.ErrNotFound {
-		logger.GetLogger().Warn("GetHandler metric not found", zapString("type", typ), zapString("id", id))
+		logger.FromContext(r.Context()).Warn("GetHandler metric not found", zapString("type", typ), zapString("id", id))
 		http.Error(rw, "Metric not found", http.StatusNotFound)
 		return
 	}
 	if err != nil {
-		logger.GetLogger().Error("GetHandler Get failed", zapError(err))
-		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.FromContext(r.Context()).Error("GetHandler Get failed", zapError(err))
+		writeStorageError(rw, err)
 		return
 	}
 
@@ -207,24 +227,27 @@ func (h *Handler) GetHandler(rw http.ResponseWriter, r *http.Request) {
 func (h *Handler) UpdateHandlerJSON(rw http.ResponseWriter, r *http.Request) {
 	var m dto.Metrics
 	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
-		logger.GetLogger().Warn("UpdateHandlerJSON decode error", zapError(err))
+		logger.FromContext(r.Context()).Warn("UpdateHandlerJSON decode error", zapError(err))
 		http.Error(rw, "Bad request", http.StatusBadRequest)
 		return
 	}
+	update := m // в поток уходит само обновление (для counter — приращение)
+	h.noteAudit(r, []dto.Metrics{m})
 	m, err := h.Svc.Update(r.Context(), m)
-	if err == service.ErrInvalidType || err == service.ErrBadValue {
-		logger.GetLogger().Warn("UpdateHandlerJSON bad metric", zapError(err))
+	if isBadMetric(err) {
+		logger.FromContext(r.Context()).Warn("UpdateHandlerJSON bad metric", zapError(err))
+		rejectAudit(r, auditCode(err))
 		http.Error(rw, "Bad request", http.StatusBadRequest)
 		return
 	}
 	if err != nil {
-		logger.GetLogger().Error("UpdateHandlerJSON Update failed", zapError(err))
-		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.FromContext(r.Context()).Error("UpdateHandlerJSON Update failed", zapError(err))
+		writeStorageError(rw, err)
 		return
 	}
+	noteTotal(r, m)
 
-	// Отправляем событие аудита после успешной обработки
-	h.sendAuditEvent(r, []string{m.ID})
+	h.publishUpdates([]dto.Metrics{update})
 
 	// Используем буфер из пула для JSON encoding
 	buf := h.bufferPool.Get().(*bytes.Buffer)
@@ -232,7 +255,7 @@ func (h *Handler) UpdateHandlerJSON(rw http.ResponseWriter, r *http.Request) {
 	defer h.bufferPool.Put(buf)
 
 	if err := json.NewEncoder(buf).Encode(m); err != nil {
-		logger.GetLogger().Error("UpdateHandlerJSON encode error", zapError(err))
+		logger.FromContext(r.Context()).Error("UpdateHandlerJSON encode error", zapError(err))
 		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -257,27 +280,28 @@ func (h *Handler) UpdateHandlerJSON(rw http.ResponseWriter, r *http.Request) {
 //   - HTTP 400 при некорректном типе метрики
 //   - HTTP 404 если метрика не найдена
 //   - HTTP 500 при внутренней ошибке
+//   - HTTP 503 если хранилище недоступно
 func (h *Handler) ValueHandlerJSON(rw http.ResponseWriter, r *http.Request) {
 	var req dto.Metrics
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.GetLogger().Warn("ValueHandlerJSON decode error", zapError(err))
+		logger.FromContext(r.Context()).Warn("ValueHandlerJSON decode error", zapError(err))
 		http.Error(rw, "Bad request", http.StatusBadRequest)
 		return
 	}
 	m, err := h.Svc.Get(r.Context(), req.MType, req.ID)
 	if err == service.ErrInvalidType {
-		logger.GetLogger().Warn("ValueHandlerJSON invalid type", zapString("type", req.MType))
+		logger.FromContext(r.Context()).Warn("ValueHandlerJSON invalid type", zapString("type", req.MType))
 		http.Error(rw, "Invalid metric type", http.StatusBadRequest)
 		return
 	}
 	if err == service.ErrNotFound {
-		logger.GetLogger().Warn("ValueHandlerJSON metric not found", zapString("type", req.MType), zapString("id", req.ID))
+		logger.FromContext(r.Context()).Warn("ValueHandlerJSON metric not found", zapString("type", req.MType), zapString("id", req.ID))
 		http.Error(rw, "Metric not found", http.StatusNotFound)
 		return
 	}
 	if err != nil {
-		logger.GetLogger().Error("ValueHandlerJSON Get failed", zapError(err))
-		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.FromContext(r.Context()).Error("ValueHandlerJSON Get failed", zapError(err))
+		writeStorageError(rw, err)
 		return
 	}
 
@@ -287,7 +311,7 @@ func (h *Handler) ValueHandlerJSON(rw http.ResponseWriter, r *http.Request) {
 	defer h.bufferPool.Put(buf)
 
 	if err := json.NewEncoder(buf).Encode(m); err != nil {
-		logger.GetLogger().Error("ValueHandlerJSON encode error", zapError(err))
+		logger.FromContext(r.Context()).Error("ValueHandlerJSON encode error", zapError(err))
 		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -316,37 +340,24 @@ func (h *Handler) ValueHandlerJSON(rw http.ResponseWriter, r *http.Request) {
 func (h *Handler) UpdateMetrics(rw http.ResponseWriter, r *http.Request) {
 	var body []dto.Metrics
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		logger.GetLogger().Warn("UpdateMetrics decode error", zapError(err))
+		logger.FromContext(r.Context()).Warn("UpdateMetrics decode error", zapError(err))
 		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
+	h.noteAudit(r, body)
 	if err := h.Svc.UpdateBatch(r.Context(), body); err != nil {
-		if err == service.ErrInvalidType || err == service.ErrBadValue {
-			logger.GetLogger().Warn("UpdateMetrics bad metric in batch", zapError(err))
+		if isBadMetric(err) {
+			logger.FromContext(r.Context()).Warn("UpdateMetrics bad metric in batch", zapError(err))
+			rejectAudit(r, auditCode(err))
 			http.Error(rw, "Bad request", http.StatusBadRequest)
 			return
 		}
-		logger.GetLogger().Error("UpdateMetrics UpdateBatch failed", zapError(err))
-		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.FromContext(r.Context()).Error("UpdateMetrics UpdateBatch failed", zapError(err))
+		writeStorageError(rw, err)
 		return
 	}
 
-	// Отправляем событие аудита после успешной обработки
-	// Используем пул для слайса имен метрик
-	metricNamesPtr := h.stringSlicePool.Get().(*[]string)
-	metricNames := (*metricNamesPtr)[:0] // Обнуляем длину, но сохраняем capacity
-	defer h.stringSlicePool.Put(metricNamesPtr)
-
-	// Расширяем слайс если нужно
-	if cap(metricNames) < len(body) {
-		metricNames = make([]string, 0, len(body))
-		*metricNamesPtr = metricNames
-	}
-
-	for _, m := range body {
-		metricNames = append(metricNames, m.ID)
-	}
-	h.sendAuditEvent(r, metricNames)
+	h.publishUpdates(body)
 
 	rw.WriteHeader(http.StatusOK)
 }
@@ -355,39 +366,27 @@ func (h *Handler) UpdateMetrics(rw http.ResponseWriter, r *http.Request) {
 func zapError(err error) zap.Field    { return zap.Error(err) }
 func zapString(k, v string) zap.Field { return zap.String(k, v) }
 
-// getClientIP извлекает IP адрес клиента из запроса
-func getClientIP(r *http.Request) string {
-	// Пробуем получить IP из заголовков прокси
-	ip := r.Header.Get("X-Real-IP")
-	if ip == "" {
-		ip = r.Header.Get("X-Forwarded-For")
-		if ip != "" {
-			// X-Forwarded-For может содержать список IP, берем первый
-			if idx := strings.Index(ip, ","); idx != -1 {
-				ip = ip[:idx]
-			}
-		}
-	}
-	// Если заголовков нет, берем из RemoteAddr
-	if ip == "" {
-		ip = r.RemoteAddr
-		// RemoteAddr может содержать порт, убираем его
-		if idx := strings.LastIndex(ip, ":"); idx != -1 {
-			ip = ip[:idx]
-		}
-	}
-	return strings.TrimSpace(ip)
+// isBadMetric сообщает, что сервис отклонил метрику из-за ошибки клиента (400).
+func isBadMetric(err error) bool {
+	return err == service.ErrInvalidType || err == service.ErrBadValue || err == service.ErrReservedName
 }
 
-// sendAuditEvent отправляет событие аудита
-func (h *Handler) sendAuditEvent(r *http.Request, metricNames []string) {
-	if h.AuditPublisher == nil {
-		return
+// auditCode — код ошибки аудита для ошибок валидации сервиса.
+func auditCode(err error) string {
+	switch err {
+	case service.ErrInvalidType:
+		return audit.ErrCodeInvalidType
+	case service.ErrReservedName:
+		return audit.ErrCodeReserved
 	}
-	event := audit.AuditEvent{
-		Timestamp: time.Now().Unix(),
-		Metrics:   metricNames,
-		IPAddress: getClientIP(r),
+	return audit.ErrCodeBadValue
+}
+
+// writeStorageError отвечает 503, если хранилище недоступно, и 500 на прочие ошибки.
+func writeStorageError(rw http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, interfaces.ErrUnavailable) {
+		code = http.StatusServiceUnavailable
 	}
-	h.AuditPublisher.NotifyAll(event)
+	http.Error(rw, http.StatusText(code), code)
 }
@@ -1,22 +1,34 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/SamSafonov2025/metrics-tpl/internal/audit"
 	"github.com/SamSafonov2025/metrics-tpl/internal/config"
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/crypto"
 	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/health"
 	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
 	"github.com/SamSafonov2025/metrics-tpl/internal/service"
 	"github.com/SamSafonov2025/metrics-tpl/internal/storage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+	"github.com/SamSafonov2025/metrics-tpl/internal/stream"
 )
 
 // helper: создаёт чистый сторадж и handler с сервисом
@@ -28,7 +40,7 @@ func newTestEnv(t *testing.T) (interfaces.Store, *Handler) {
 
 	cfg := &config.ServerConfig{
 		StoreInterval:   5 * time.Second,
-		FileStoragePath: "storage.json",
+		FileStoragePath: filepath.Join(t.TempDir(), "storage.json"),
 		Restore:         false,
 		Database:        "", // без БД — memstorage
 	}
@@ -44,6 +56,91 @@ func newTestEnv(t *testing.T) (interfaces.Store, *Handler) {
 	return repo, h
 }
 
+func TestUpdateHandlerSyncPersistFailure(t *testing.T) {
+	storage.TestReset()
+	// синхронный режим с недоступным для записи путём: каждое сохранение падает
+	repo := storage.NewStorage(&config.ServerConfig{
+		FileStoragePath: filepath.Join(t.TempDir(), "missing", "storage.json"),
+	})
+	t.Cleanup(storage.Close)
+	h := NewHandler(service.NewMetricsService(repo, 5*time.Second, nil), nil)
+
+	router := chi.NewRouter()
+	router.Post("/update/{metricType}/{metricName}/{metricValue}", h.UpdateHandler)
+	router.Post("/updates/", h.UpdateMetrics)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/update/gauge/temperature/23.5", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/updates/",
+		strings.NewReader(`[{"id":"hits","type":"counter","delta":1}]`)))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+// TestReadHandlersStorageFailure: отказ хранилища на чтении не выдаётся за 404;
+// недоступность отвечает 503, прочие ошибки — 500.
+func TestReadHandlersStorageFailure(t *testing.T) {
+	requests := []func() *http.Request{
+		func() *http.Request { return httptest.NewRequest(http.MethodGet, "/value/gauge/temperature", nil) },
+		func() *http.Request { return httptest.NewRequest(http.MethodGet, "/value/counter/hits", nil) },
+		func() *http.Request {
+			return httptest.NewRequest(http.MethodPost, "/value/", strings.NewReader(`{"id":"hits","type":"counter"}`))
+		},
+		func() *http.Request { return httptest.NewRequest(http.MethodGet, "/", nil) },
+		func() *http.Request { return httptest.NewRequest(http.MethodGet, "/api/metrics", nil) },
+		func() *http.Request { return httptest.NewRequest(http.MethodGet, "/metric/gauge/temperature", nil) },
+	}
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"unavailable", fmt.Errorf("get gauge: %w: dial tcp: connection refused", interfaces.ErrUnavailable), http.StatusServiceUnavailable},
+		{"other", errors.New("get gauge: corrupted row"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHandler(service.NewMetricsService(storetest.Failing{Err: tc.err}, time.Second, nil), nil)
+			router := chi.NewRouter()
+			router.Get("/", h.HomeHandler)
+			router.Get("/value/{metricType}/{metricName}", h.GetHandler)
+			router.Post("/value/", h.ValueHandlerJSON)
+			router.Get("/api/metrics", h.MetricsListHandler)
+			router.Get("/metric/{metricType}/{metricName}", h.MetricPageHandler)
+
+			for _, newReq := range requests {
+				req := newReq()
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, tc.want, rr.Code, "%s %s", req.Method, req.URL.Path)
+			}
+		})
+	}
+}
+
+// TestUpdateHandlersStorageUnavailable: запись при недоступном хранилище
+// отвечает 503, как и чтение.
+func TestUpdateHandlersStorageUnavailable(t *testing.T) {
+	err := fmt.Errorf("set gauge: %w: dial tcp: connection refused", interfaces.ErrUnavailable)
+	h := NewHandler(service.NewMetricsService(storetest.Failing{Err: err}, time.Second, nil), nil)
+	router := chi.NewRouter()
+	router.Post("/update/{metricType}/{metricName}/{metricValue}", h.UpdateHandler)
+	router.Post("/update/", h.UpdateHandlerJSON)
+	router.Post("/updates/", h.UpdateMetrics)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/update/gauge/temperature/23.5", nil),
+		httptest.NewRequest(http.MethodPost, "/update/", strings.NewReader(`{"id":"hits","type":"counter","delta":1}`)),
+		httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(`[{"id":"hits","type":"counter","delta":1}]`)),
+	} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "%s %s", req.Method, req.URL.Path)
+	}
+}
+
 func TestUpdateHandlerGaugeSuccess(t *testing.T) {
 	s, h := newTestEnv(t)
 	router := chi.NewRouter()
@@ -57,7 +154,7 @@ func TestUpdateHandlerGaugeSuccess(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
-	value, exists := s.GetGauge(context.Background(), "temperature")
+	value, exists, _ := s.GetGauge(context.Background(), "temperature")
 	assert.True(t, exists)
 	assert.Equal(t, 23.5, value)
 }
@@ -75,7 +172,7 @@ func TestUpdateHandlerCounterSuccess(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
-	value, exists := s.GetCounter(context.Background(), "hits")
+	value, exists, _ := s.GetCounter(context.Background(), "hits")
 	assert.True(t, exists)
 	assert.Equal(t, int64(10), value)
 }
@@ -155,10 +252,55 @@ func TestHomeHandle(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 	body := rr.Body.String()
 
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
 	assert.Contains(t, body, "Gauges")
-	assert.Contains(t, body, "temperature: 23.5")
+	assert.Contains(t, body, `<a href="/metric/gauge/temperature">temperature</a></td><td class="value">23.5</td>`)
 	assert.Contains(t, body, "Counters")
-	assert.Contains(t, body, "hits: 10")
+	assert.Contains(t, body, `<a href="/metric/counter/hits">hits</a></td><td class="value">10</td>`)
+}
+
+func TestHomeHandleSortedAndFiltered(t *testing.T) {
+	s, h := newTestEnv(t)
+	for _, name := range []string{"zeta", "alpha", "HeapAlloc", "beta"} {
+		assert.NoError(t, s.SetGauge(context.Background(), name, 1))
+	}
+
+	router := chi.NewRouter()
+	router.Get("/", h.HomeHandler)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	iHeap := strings.Index(body, `data-name="HeapAlloc"`)
+	iAlpha := strings.Index(body, `data-name="alpha"`)
+	iBeta := strings.Index(body, `data-name="beta"`)
+	iZeta := strings.Index(body, `data-name="zeta"`)
+	assert.True(t, iHeap < iAlpha && iAlpha < iBeta && iBeta < iZeta, "gauges must be sorted by name")
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/?q=ALP", nil))
+	body = rr.Body.String()
+	assert.Contains(t, body, `data-name="alpha"`)
+	assert.NotContains(t, body, `data-name="beta"`)
+	assert.NotContains(t, body, `data-name="HeapAlloc"`)
+}
+
+func TestMetricPageHandler(t *testing.T) {
+	s, h := newTestEnv(t)
+	assert.NoError(t, s.IncrementCounter(context.Background(), "hits", 7))
+
+	router := chi.NewRouter()
+	router.Get("/metric/{metricType}/{metricName}", h.MetricPageHandler)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metric/counter/hits", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `<td class="value">7</td>`)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metric/counter/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
 func TestUpdateHandlerJSON_GaugeSuccess(t *testing.T) {
@@ -185,7 +327,7 @@ func TestUpdateHandlerJSON_GaugeSuccess(t *testing.T) {
 	assert.Equal(t, "gauge", response.MType)
 	assert.Equal(t, 23.5, *response.Value)
 
-	value, exists := s.GetGauge(context.Background(), "temperature")
+	value, exists, _ := s.GetGauge(context.Background(), "temperature")
 	assert.True(t, exists)
 	assert.Equal(t, 23.5, value)
 }
@@ -214,7 +356,7 @@ func TestUpdateHandlerJSON_CounterSuccess(t *testing.T) {
 	assert.Equal(t, "counter", response.MType)
 	assert.Equal(t, int64(10), *response.Delta)
 
-	value, exists := s.GetCounter(context.Background(), "hits")
+	value, exists, _ := s.GetCounter(context.Background(), "hits")
 	assert.True(t, exists)
 	assert.Equal(t, int64(10), value)
 }
@@ -271,6 +413,43 @@ func TestUpdateHandlerJSON_MissingDelta(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
+func TestUpdateRejectsReservedNames(t *testing.T) {
+	s, h := newTestEnv(t)
+	router := chi.NewRouter()
+	router.Post("/update/{metricType}/{metricName}/{metricValue}", h.UpdateHandler)
+	router.Post("/update", h.UpdateHandlerJSON)
+	router.Post("/updates", h.UpdateMetrics)
+
+	v := 1.0
+	post := func(path string, body any) int {
+		var r *http.Request
+		if body == nil {
+			r = httptest.NewRequest(http.MethodPost, path, nil)
+		} else {
+			b, _ := json.Marshal(body)
+			r = httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post("/update/gauge/server.http.requests/1", nil))
+	assert.Equal(t, http.StatusBadRequest, post("/update", dto.Metrics{ID: "up.web-01", MType: "gauge", Value: &v}))
+	assert.Equal(t, http.StatusBadRequest, post("/updates", []dto.Metrics{
+		{ID: "ok", MType: "gauge", Value: &v},
+		{ID: "server.cache.hits", MType: "gauge", Value: &v},
+	}))
+
+	gauges, err := s.GetAllGauges(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, gauges, "батч с зарезервированным именем отклонён целиком")
+
+	// похожие, но не зарезервированные имена принимаются
+	assert.Equal(t, http.StatusOK, post("/update/gauge/serverLoad/1", nil))
+	assert.Equal(t, http.StatusOK, post("/update", dto.Metrics{ID: "uptime", MType: "gauge", Value: &v}))
+}
+
 func TestValueHandlerJSON_GaugeSuccess(t *testing.T) {
 	s, h := newTestEnv(t)
 	assert.NoError(t, s.SetGauge(context.Background(), "temperature", 23.5))
@@ -354,3 +533,264 @@ func TestValueHandlerJSON_MetricNotFound(t *testing.T) {
 
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
+
+func TestStreamHandler(t *testing.T) {
+	_, h := newTestEnv(t)
+	h.Stream = stream.NewHub(16, stream.DropOldest)
+	defer h.Stream.Close()
+
+	router := chi.NewRouter()
+	router.Get("/stream", h.StreamHandler)
+	router.Post("/update/{metricType}/{metricName}/{metricValue}", h.UpdateHandler)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream?match=hit*")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	for _, path := range []string{"/update/gauge/temperature/1", "/update/counter/hits/3"} {
+		r, err := http.Post(srv.URL+path, "text/plain", nil)
+		if assert.NoError(t, err) {
+			r.Body.Close()
+		}
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	var data string
+	for sc.Scan() {
+		if line := sc.Text(); strings.HasPrefix(line, "data: ") {
+			data = strings.TrimPrefix(line, "data: ")
+			break
+		}
+	}
+	var e stream.Event
+	assert.NoError(t, json.Unmarshal([]byte(data), &e))
+	assert.Equal(t, "hits", e.ID)
+	if assert.NotNil(t, e.Delta) {
+		assert.Equal(t, int64(3), *e.Delta)
+	}
+}
+
+func TestSnapshotExportImport(t *testing.T) {
+	s, h := newTestEnv(t)
+	ctx := context.Background()
+	assert.NoError(t, s.SetGauge(ctx, "temperature", 23.5))
+	assert.NoError(t, s.IncrementCounter(ctx, "hits", 10))
+
+	const key = "secret"
+	c := crypto.Crypto{Key: key}
+	router := chi.NewRouter()
+	router.Get("/snapshot", h.ExportSnapshot)
+	router.With(c.HashValidationMiddleware).Post("/snapshot", h.ImportSnapshot)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/snapshot?format=ndjson", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+	exported := rr.Body.String()
+	assert.Equal(t, 2, strings.Count(exported, "\n"))
+
+	// счётчик ушёл вперёд — merge возвращает его к абсолютному значению снимка
+	assert.NoError(t, s.IncrementCounter(ctx, "hits", 5))
+	assert.NoError(t, s.SetGauge(ctx, "extra", 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/snapshot?mode=merge", strings.NewReader(exported))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	hits, _, _ := s.GetCounter(ctx, "hits")
+	assert.Equal(t, int64(10), hits)
+	_, ok, _ := s.GetGauge(ctx, "extra")
+	assert.True(t, ok)
+
+	// replace стирает хранилище и без подписи запрещён
+	req = httptest.NewRequest(http.MethodPost, "/snapshot?mode=replace&format=ndjson", strings.NewReader(exported))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	_, ok, _ = s.GetGauge(ctx, "extra")
+	assert.True(t, ok)
+
+	req = httptest.NewRequest(http.MethodPost, "/snapshot?mode=replace&format=ndjson", strings.NewReader(exported))
+	req.Header.Set("HashSHA256", crypto.GenerateHash([]byte(exported), key))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	_, ok, _ = s.GetGauge(ctx, "extra")
+	assert.False(t, ok)
+
+	req = httptest.NewRequest(http.MethodPost, "/snapshot", strings.NewReader(`[{"id":"x","type":"gauge"}]`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestReadyHandler(t *testing.T) {
+	_, h := newTestEnv(t)
+
+	rr := httptest.NewRecorder()
+	h.ReadyHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok","checks":{}}`, rr.Body.String())
+
+	h.Health = health.New(time.Second)
+	h.Health.Register("storage", func(context.Context) error { return nil })
+	h.Health.Register("file_backup", func(context.Context) error { return errors.New("disk full") })
+	rr = httptest.NewRecorder()
+	h.ReadyHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var resp health.Report
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, health.StatusFail, resp.Status)
+	assert.Equal(t, health.StatusOK, resp.Checks["storage"].Status)
+	assert.Equal(t, health.StatusFail, resp.Checks["file_backup"].Status)
+	assert.Equal(t, "disk full", resp.Checks["file_backup"].Error)
+}
+
+func TestHealthzAndVersionHandlers(t *testing.T) {
+	_, h := newTestEnv(t)
+	h.Build = health.BuildInfo{Version: "v1.2.0", Date: "2025-01-01", Commit: "abc123"}
+
+	rr := httptest.NewRecorder()
+	h.HealthzHandler(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	h.VersionHandler(rr, httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"version":"v1.2.0","date":"2025-01-01","commit":"abc123"}`, rr.Body.String())
+}
+
+// auditSink — наблюдатель аудита, отдающий события в канал.
+type auditSink chan audit.AuditEvent
+
+func (s auditSink) Notify(e audit.AuditEvent) error { s <- e; return nil }
+func (s auditSink) Close() error                    { return nil }
+
+func TestRequestIDPropagatesToResponseAndAudit(t *testing.T) {
+	_, h := newTestEnv(t)
+	sink := make(auditSink, 1)
+	h.AuditPublisher = audit.NewAuditPublisher()
+	h.AuditPublisher.Register(sink)
+
+	router := chi.NewRouter()
+	router.Use(logger.Middleware)
+	router.With(h.Audit).Post("/update", h.UpdateHandlerJSON)
+
+	req := httptest.NewRequest(http.MethodPost, "/update", strings.NewReader(`{"id":"g","type":"gauge","value":1}`))
+	req.Header.Set(consts.HeaderRequestID, "batch-42")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "batch-42", rr.Header().Get(consts.HeaderRequestID))
+	select {
+	case e := <-sink:
+		assert.Equal(t, "batch-42", e.RequestID)
+		assert.Equal(t, []string{"g"}, e.Metrics)
+	case <-time.After(time.Second):
+		t.Fatal("audit event not delivered")
+	}
+}
+
+func TestAuditVerbosity(t *testing.T) {
+	const key = "secret"
+	post := func(h *Handler, path, body, hash string) {
+		c := crypto.Crypto{Key: key}
+		router := chi.NewRouter()
+		router.With(h.Audit, c.HashValidationMiddleware).Post("/update", h.UpdateHandlerJSON)
+		router.With(h.Audit, c.HashValidationMiddleware).Post("/update/{metricType}/{metricName}/{metricValue}", h.UpdateHandler)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("User-Agent", "test-agent")
+		req.Header.Set(consts.HeaderAgentID, "host-1")
+		if hash != "" {
+			req.Header.Set("HashSHA256", hash)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	ok := `{"id":"g","type":"gauge","value":2}`
+	badType := `{"id":"g","type":"histogram","value":2}`
+
+	tests := []struct {
+		verbosity string
+		send      func(h *Handler)
+		want      *audit.AuditEvent
+	}{
+		{
+			verbosity: audit.VerbosityBasic,
+			send:      func(h *Handler) { post(h, "/update", ok, crypto.GenerateHash([]byte(ok), key)) },
+			want:      &audit.AuditEvent{Metrics: []string{"g"}, Endpoint: "POST /update", Outcome: audit.OutcomeSuccess, Status: 200},
+		},
+		{
+			verbosity: audit.VerbosityBasic,
+			send:      func(h *Handler) { post(h, "/update", badType, "") },
+			want:      nil, // неуспешные запросы в basic не аудируются
+		},
+		{
+			verbosity: audit.VerbosityFailures,
+			send:      func(h *Handler) { post(h, "/update", badType, "") },
+			want: &audit.AuditEvent{Metrics: []string{"g"}, Endpoint: "POST /update",
+				Outcome: audit.OutcomeRejected, Status: 400, Error: audit.ErrCodeInvalidType},
+		},
+		{
+			verbosity: audit.VerbosityFailures,
+			send:      func(h *Handler) { post(h, "/update", ok, "forged") },
+			want: &audit.AuditEvent{Metrics: []string{}, Endpoint: "POST /update",
+				Outcome: audit.OutcomeRejected, Status: 400, Error: audit.ErrCodeBadHMAC},
+		},
+		{
+			verbosity: audit.VerbosityFailures,
+			send:      func(h *Handler) { post(h, "/update/gauge/g/abc", "", "") },
+			want: &audit.AuditEvent{Metrics: []string{"g"}, Endpoint: "POST /update/{metricType}/{metricName}/{metricValue}",
+				Outcome: audit.OutcomeRejected, Status: 400, Error: audit.ErrCodeBadValue},
+		},
+		{
+			verbosity: audit.VerbosityValues,
+			send:      func(h *Handler) { post(h, "/update", ok, "") },
+			want: &audit.AuditEvent{Metrics: []string{"g"}, Endpoint: "POST /update", Outcome: audit.OutcomeSuccess, Status: 200,
+				Values: []audit.MetricChange{{ID: "g", MType: "gauge", Value: ptr(2.0)}}},
+		},
+		{
+			verbosity: audit.VerbosityValues,
+			send:      func(h *Handler) { post(h, "/update", `{"id":"c","type":"counter","delta":3}`, "") },
+			want: &audit.AuditEvent{Metrics: []string{"c"}, Endpoint: "POST /update", Outcome: audit.OutcomeSuccess, Status: 200,
+				Values: []audit.MetricChange{{ID: "c", MType: "counter", Delta: ptr(int64(3)), Total: ptr(int64(8))}}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.verbosity, func(t *testing.T) {
+			repo, h := newTestEnv(t)
+			assert.NoError(t, repo.SetGauge(context.Background(), "g", 1))
+			assert.NoError(t, repo.IncrementCounter(context.Background(), "c", 5))
+			sink := make(auditSink, 1)
+			h.AuditPublisher = audit.NewAuditPublisher()
+			h.AuditPublisher.Register(sink)
+			assert.NoError(t, h.AuditPublisher.SetVerbosity(tc.verbosity))
+
+			tc.send(h)
+
+			select {
+			case e := <-sink:
+				if assert.NotNil(t, tc.want, "unexpected event %+v", e) {
+					assert.NotZero(t, e.Timestamp)
+					assert.Equal(t, "test-agent", e.UserAgent)
+					assert.Equal(t, "host-1", e.AgentID)
+					e.Timestamp, e.IPAddress, e.UserAgent, e.AgentID = 0, "", "", ""
+					assert.Equal(t, *tc.want, e)
+				}
+			case <-time.After(100 * time.Millisecond):
+				assert.Nil(t, tc.want, "event not delivered")
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
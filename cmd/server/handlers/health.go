@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/health"
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+)
+
+// readyResponse — ответ GET /readyz: результат каждой проверки и роль реплики.
+type readyResponse struct {
+	health.Report
+	Role string `json:"role,omitempty"` // leader | follower (только в HA-режиме)
+}
+
+// HealthzHandler сообщает, что процесс жив и обслуживает запросы.
+// Зависимости не проверяются: для этого есть GET /readyz.
+//
+// Endpoint: GET /healthz
+func (h *Handler) HealthzHandler(rw http.ResponseWriter, r *http.Request) {
+	writeJSON(rw, r, http.StatusOK, map[string]string{"status": health.StatusOK}, "HealthzHandler")
+}
+
+// ReadyHandler сообщает, готова ли реплика принимать трафик: 200, если все
+// проверки (хранилище, бэкап в файл, приёмники аудита) успешны, иначе 503.
+// В ответе — результат каждой проверки; в HA-режиме ещё и роль реплики.
+//
+// Endpoint: GET /readyz
+//
+// Формат ответа:
+//
+//	{"status":"fail","checks":{"storage":{"status":"ok","duration_ms":0.4},
+//	 "file_backup":{"status":"fail","error":"...","duration_ms":0}}}
+func (h *Handler) ReadyHandler(rw http.ResponseWriter, r *http.Request) {
+	resp := readyResponse{Report: health.Report{Status: health.StatusOK, Checks: map[string]health.CheckResult{}}}
+	if h.Health != nil {
+		resp.Report = h.Health.Run(r.Context())
+	}
+	if h.Leader != nil {
+		resp.Role = "follower"
+		if h.Leader.IsLeader() {
+			resp.Role = "leader"
+		}
+	}
+
+	code := http.StatusOK
+	if !resp.OK() {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(rw, r, code, resp, "ReadyHandler")
+}
+
+// VersionHandler возвращает сведения о сборке.
+//
+// Endpoint: GET /version
+//
+// Формат ответа:
+//
+//	{"version":"v1.2.0","date":"2025-01-01","commit":"abc123"}
+func (h *Handler) VersionHandler(rw http.ResponseWriter, r *http.Request) {
+	writeJSON(rw, r, http.StatusOK, h.Build, "VersionHandler")
+}
+
+// writeJSON отвечает кодом code и телом v в JSON.
+func writeJSON(rw http.ResponseWriter, r *http.Request, code int, v any, handler string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(code)
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		logger.FromContext(r.Context()).Error(handler+" encode error", zapError(err))
+	}
+}
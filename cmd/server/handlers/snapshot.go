@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/audit"
+	"github.com/SamSafonov2025/metrics-tpl/internal/crypto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+	"github.com/SamSafonov2025/metrics-tpl/internal/snapshot"
+)
+
+const contentTypeNDJSON = "application/x-ndjson"
+
+// ExportSnapshot возвращает полный согласованный снимок всех метрик.
+// У counter в поле delta — абсолютное значение счётчика.
+// Формат выбирается параметром ?format=json|ndjson или заголовком Accept;
+// при Accept-Encoding: gzip ответ сжимается.
+//
+// Endpoint: GET /snapshot
+//
+// Возвращает:
+//   - HTTP 200 и снимок
+//   - HTTP 400 при неизвестном формате
+//   - HTTP 500 при внутренней ошибке
+func (h *Handler) ExportSnapshot(rw http.ResponseWriter, r *http.Request) {
+	format := snapshotFormat(r, r.Header.Get("Accept"))
+	if format != snapshot.FormatJSON && format != snapshot.FormatNDJSON {
+		http.Error(rw, "Unknown snapshot format", http.StatusBadRequest)
+		return
+	}
+
+	items, err := h.Svc.Snapshot(r.Context())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("ExportSnapshot Snapshot failed", zapError(err))
+		writeStorageError(rw, err)
+		return
+	}
+
+	if format == snapshot.FormatNDJSON {
+		rw.Header().Set("Content-Type", contentTypeNDJSON)
+	} else {
+		rw.Header().Set("Content-Type", "application/json")
+	}
+	rw.WriteHeader(http.StatusOK)
+	if err := snapshot.Encode(rw, items, format); err != nil {
+		logger.FromContext(r.Context()).Error("ExportSnapshot encode error", zapError(err))
+	}
+}
+
+// ImportSnapshot применяет снимок, полученный в теле запроса.
+// Режим задаётся параметром ?mode=merge|replace (по умолчанию merge):
+//   - merge: gauge перезаписываются, counter доводятся до абсолютных значений снимка,
+//     остальные метрики не меняются;
+//   - replace: всё содержимое хранилища заменяется снимком. Запрос должен быть
+//     подписан ключом сервера (HashSHA256); без ключа на сервере replace запрещён.
+//
+// Формат тела — ?format=json|ndjson или Content-Type; тело может быть сжато gzip.
+//
+// Endpoint: POST /snapshot
+//
+// Возвращает:
+//   - HTTP 200 при успешном применении
+//   - HTTP 400 при некорректном теле, формате, режиме или метрике
+//   - HTTP 403 при replace без проверенной подписи
+//   - HTTP 501 если хранилище не поддерживает режим mode
+//   - HTTP 500 при внутренней ошибке
+func (h *Handler) ImportSnapshot(rw http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = snapshot.ModeMerge
+	}
+	if mode == snapshot.ModeReplace && !crypto.Verified(r.Context()) {
+		logger.FromContext(r.Context()).Warn("ImportSnapshot replace without verified signature")
+		rejectAudit(r, audit.ErrCodeUnsigned)
+		http.Error(rw, "Replace requires a signed request", http.StatusForbidden)
+		return
+	}
+	format := snapshotFormat(r, r.Header.Get("Content-Type"))
+
+	items, err := snapshot.Decode(r.Body, format)
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("ImportSnapshot decode error", zapError(err))
+		http.Error(rw, "Bad request", http.StatusBadRequest)
+		return
+	}
+	h.noteAudit(r, items)
+
+	err = h.Svc.Restore(r.Context(), items, mode)
+	switch {
+	case err == nil:
+	case errors.Is(err, snapshot.ErrBadItem), errors.Is(err, snapshot.ErrBadMode):
+		logger.FromContext(r.Context()).Warn("ImportSnapshot bad snapshot", zapError(err))
+		rejectAudit(r, audit.ErrCodeBadValue)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, snapshot.ErrReplaceUnsupported), errors.Is(err, snapshot.ErrMergeUnsupported):
+		http.Error(rw, err.Error(), http.StatusNotImplemented)
+		return
+	default:
+		logger.FromContext(r.Context()).Error("ImportSnapshot Restore failed", zapError(err))
+		writeStorageError(rw, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("Snapshot imported", zapString("mode", mode), zapString("format", format))
+	rw.WriteHeader(http.StatusOK)
+}
+
+// snapshotFormat определяет формат по ?format= или по медиа-типу заголовка.
+func snapshotFormat(r *http.Request, mediaType string) string {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f
+	}
+	if strings.Contains(mediaType, contentTypeNDJSON) {
+		return snapshot.FormatNDJSON
+	}
+	return snapshot.FormatJSON
+}
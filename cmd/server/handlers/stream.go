@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+)
+
+// streamHeartbeat — период комментариев-пингов, чтобы прокси не рвали тихое соединение.
+const streamHeartbeat = 15 * time.Second
+
+// StreamHandler отдаёт поток обновлений метрик в формате Server-Sent Events.
+// Каждое успешное обновление (/update, /updates) приходит событием "metric";
+// при переполнении буфера клиента приходит событие "dropped" с числом потерянных событий.
+//
+// Endpoint: GET /stream?match=CPU*,FreeMemory
+//
+// Формат события:
+//
+//	event: metric
+//	data: {"id":"PollCount","type":"counter","delta":5,"ts":1700000000000}
+//
+// Возвращает:
+//   - HTTP 200 и бесконечный поток событий
+//   - HTTP 404 если поток не настроен
+//   - HTTP 500 если соединение не поддерживает потоковую отдачу
+func (h *Handler) StreamHandler(rw http.ResponseWriter, r *http.Request) {
+	if h.Stream == nil {
+		http.Error(rw, "Stream is disabled", http.StatusNotFound)
+		return
+	}
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		logger.FromContext(r.Context()).Error("StreamHandler: response writer does not support flushing")
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	sub := h.Stream.Subscribe(r.URL.Query().Get("match"))
+	defer h.Stream.Unsubscribe(sub)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	var reported uint64
+	for {
+		select {
+		case e := <-sub.Events():
+			if dropped := sub.Dropped(); dropped != reported {
+				reported = dropped
+				if _, err := fmt.Fprintf(rw, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped); err != nil {
+					return
+				}
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				logger.FromContext(r.Context()).Error("StreamHandler encode error", zapError(err))
+				continue
+			}
+			if _, err := fmt.Fprintf(rw, "event: metric\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(rw, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-h.Stream.Done():
+			return
+		}
+	}
+}
+
+// publishUpdates отправляет успешно применённые обновления в поток
+func (h *Handler) publishUpdates(items []dto.Metrics) {
+	if h.Stream == nil {
+		return
+	}
+	h.Stream.Publish(items)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -14,11 +15,19 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/SamSafonov2025/metrics-tpl/internal/agents"
+	"github.com/SamSafonov2025/metrics-tpl/internal/alerting"
 	"github.com/SamSafonov2025/metrics-tpl/internal/audit"
 	"github.com/SamSafonov2025/metrics-tpl/internal/config"
+	"github.com/SamSafonov2025/metrics-tpl/internal/health"
+	"github.com/SamSafonov2025/metrics-tpl/internal/leader"
 	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
 	"github.com/SamSafonov2025/metrics-tpl/internal/router"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
 	"github.com/SamSafonov2025/metrics-tpl/internal/storage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/statstorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/stream"
+	"github.com/SamSafonov2025/metrics-tpl/internal/tracing"
 )
 
 var (
@@ -35,45 +44,209 @@ func main() {
 
 	cfg := config.ParseServerFlags()
 
-	if err := logger.Init(); err != nil {
+	if err := logger.Init(logger.Config{
+		Level:    cfg.LogLevel,
+		Format:   cfg.LogFormat,
+		Sampling: cfg.LogSampling,
+		Body:     cfg.LogBody,
+	}); err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 
-	// логируем все поля конфига
-	logger.GetLogger().Info("Server config loaded !!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!",
+	// логируем поля конфига; ключ HMAC не выводим, пароль в DSN маскируем
+	logger.GetLogger().Info("Server config loaded",
 		zap.String("address", cfg.ServerAddress),
 		zap.Duration("store_interval", cfg.StoreInterval),
+		zap.Duration("request_timeout", cfg.RequestTimeout),
+		zap.String("storage", cfg.Storage),
 		zap.String("file_storage_path", cfg.FileStoragePath),
 		zap.Bool("restore", cfg.Restore),
-		zap.String("database_dsn", cfg.Database),
-		zap.String("crypto_key", cfg.CryptoKey),
+		zap.String("database_dsn", logger.RedactDSN(cfg.Database)),
+		zap.Bool("hmac", cfg.CryptoKey != ""),
+		zap.String("log_level", cfg.LogLevel),
+		zap.String("trace_exporter", cfg.TraceExporter),
 	)
 
-	s := storage.NewStorage(cfg) // репозиторий (interfaces.Store)
-	svc := service.NewMetricsService(s, cfg.StoreInterval,
-		func(ctx context.Context) error { return postgres.Pool.Ping(ctx) })
+	// Трассировка: спаны запросов, gzip, HMAC, сервиса и SQL (traceparent от агента)
+	shutdownTracing, err := tracing.Init(context.Background(), "metrics-server", cfg.TraceExporter, cfg.OTLPEndpoint)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.GetLogger().Warn("Tracing shutdown failed", zap.Error(err))
+		}
+	}()
+
+	// репозиторий (interfaces.Store); операции с ним замеряются в self-метрики
+	s := statstorage.New(storage.NewStorage(cfg), selfmetrics.Default())
+	svc := service.NewMetricsService(s, cfg.RequestTimeout, storage.Ping)
+
+	// Проверки готовности для GET /readyz
+	checks := health.New(health.DefaultTimeout)
+	checks.Register("storage", storage.Ping)
+	if fm := storage.FileManager(); fm != nil {
+		checks.Register("file_backup", fm.Check)
+	}
 
 	// Инициализируем систему аудита
 	auditPublisher := audit.NewAuditPublisher()
-	defer auditPublisher.Close()
+	// Закрывается после server.Shutdown: события завершённых запросов успевают встать в очередь
+	defer func() {
+		if err := auditPublisher.Close(); err != nil {
+			logger.GetLogger().Error("Audit events lost on shutdown", zap.Error(err))
+		}
+	}()
+	// Хранилище закрывается после server.Shutdown и до аудита: финальный снимок
+	// в файл, закрытие WAL, снятие блокировки bbolt, checkpoint WAL SQLite
+	defer storage.Close()
+	if err := auditPublisher.SetVerbosity(cfg.AuditVerbosity); err != nil {
+		logger.GetLogger().Fatal("Invalid audit verbosity", zap.Error(err))
+	}
+	auditQueue := audit.DefaultQueueConfig()
+	auditQueue.Size = cfg.AuditQueueSize
+	auditQueue.BatchSize = cfg.AuditBatchSize
+	auditQueue.Overflow = cfg.AuditOverflow
+	auditQueue.MaxRetries = cfg.AuditRetries
+	auditQueue.DrainTimeout = cfg.AuditDrain
+	if err := auditPublisher.SetQueue(auditQueue); err != nil {
+		logger.GetLogger().Fatal("Invalid audit queue settings", zap.Error(err))
+	}
 
 	// Регистрируем наблюдателей на основе конфигурации
 	if cfg.AuditFile != "" {
-		fileObserver, err := audit.NewFileAuditObserver(cfg.AuditFile)
+		fileObserver, err := audit.NewFileAuditObserver(cfg.AuditFile, audit.FileOptions{
+			Key:           []byte(cfg.AuditKey),
+			MaxSize:       cfg.AuditMaxSize,
+			MaxAge:        cfg.AuditMaxAge,
+			MaxBackups:    cfg.AuditMaxBackups,
+			Compress:      cfg.AuditCompress,
+			FsyncInterval: cfg.AuditFsync,
+		})
 		if err != nil {
 			logger.GetLogger().Fatal("Failed to create file audit observer", zap.Error(err))
 		}
 		auditPublisher.Register(fileObserver)
-		logger.GetLogger().Info("File audit observer registered", zap.String("file", cfg.AuditFile))
+		checks.Register("audit_file", fileObserver.Check)
+		// Внешняя ротация (logrotate) переименовывает файл и шлёт SIGHUP
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := fileObserver.Reopen(); err != nil {
+					logger.GetLogger().Error("Failed to reopen audit file", zap.Error(err))
+					continue
+				}
+				logger.GetLogger().Info("Audit file reopened", zap.String("file", cfg.AuditFile))
+			}
+		}()
+		logger.GetLogger().Info("File audit observer registered",
+			zap.String("file", cfg.AuditFile),
+			zap.Bool("chain_hmac", cfg.AuditKey != ""),
+			zap.Int64("max_size", cfg.AuditMaxSize),
+			zap.Duration("max_age", cfg.AuditMaxAge),
+			zap.Int("max_backups", cfg.AuditMaxBackups),
+			zap.Bool("compress", cfg.AuditCompress),
+			zap.Duration("fsync_interval", cfg.AuditFsync),
+		)
 	}
 
 	if cfg.AuditURL != "" {
 		urlObserver := audit.NewURLAuditObserver(cfg.AuditURL)
 		auditPublisher.Register(urlObserver)
+		checks.Register("audit_url", urlObserver.Check)
 		logger.GetLogger().Info("URL audit observer registered", zap.String("url", cfg.AuditURL))
 	}
 
-	r := router.New(svc, cfg.CryptoKey, auditPublisher)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// HA-режим: singleton-задачи (бэкап в файл, алерты) выполняет только лидер.
+	// Выборы идут через PostgreSQL: без БД (другой backend или откат на файл
+	// при недоступной БД) каждая реплика считала бы себя лидером
+	var elector *leader.Elector
+	runSingleton := func(_ string, fn func(ctx context.Context)) { go fn(ctx) }
+	if cfg.HA && postgres.Pool == nil {
+		logger.GetLogger().Fatal("HA mode requires the PostgreSQL backend",
+			zap.String("storage", s.StorageType()))
+	}
+	if cfg.HA {
+		elector = leader.New(postgres.Pool, leader.DefaultKey)
+		runSingleton = elector.Go
+		if fm := storage.FileManager(); fm != nil && cfg.StoreInterval > 0 {
+			elector.Go("file-backup", func(ctx context.Context) { fm.RunBackupContext(ctx, cfg.StoreInterval, s) })
+		}
+	}
+
+	// Движок алертов (если задан файл правил)
+	var alerts *alerting.Engine
+	if cfg.AlertRules != "" {
+		rules, err := alerting.LoadRules(cfg.AlertRules)
+		if err != nil {
+			logger.GetLogger().Fatal("Failed to load alert rules", zap.Error(err))
+		}
+		alerts, err = alerting.NewEngine(s, rules, cfg.AlertWebhooks, cfg.AlertInterval)
+		if err != nil {
+			logger.GetLogger().Fatal("Failed to create alerting engine", zap.Error(err))
+		}
+		runSingleton("alerting", alerts.Run)
+		logger.GetLogger().Info("Alerting engine started",
+			zap.String("rules", cfg.AlertRules),
+			zap.Int("rules_count", len(rules)),
+			zap.Duration("interval", cfg.AlertInterval),
+		)
+	}
+
+	// Кеш чтений перед БД: сброс по уведомлениям других реплик.
+	// Триггеры NOTIFY ставятся только здесь, без -cache-notify записи за них не платят
+	if cache := storage.Cache(); cache != nil && cfg.CacheNotify {
+		if err := postgres.EnableNotify(ctx, postgres.Pool); err != nil {
+			logger.GetLogger().Error("Failed to enable cache notifications, cache relies on TTL", zap.Error(err))
+		} else {
+			go postgres.Listen(ctx, postgres.Pool, postgres.MetricsChangedChannel, cache.Invalidate, cache.InvalidateAll)
+		}
+	}
+
+	// Реестр агентов и синтетические метрики доступности up.<id>
+	agentRegistry := agents.NewRegistry(cfg.AgentStaleAfter, cfg.AgentDownAfter, cfg.AgentForgetAfter, cfg.AgentMax)
+
+	// Self-метрики и up.* каждая реплика считает сама: в HA-режиме они пишутся
+	// под её идентификатором, чтобы реплики не перезаписывали друг другу значения
+	if elector != nil {
+		replica := selfmetrics.Name(cfg.ReplicaID)
+		if replica == "" {
+			logger.GetLogger().Fatal("Invalid replica ID", zap.String("replica_id", cfg.ReplicaID))
+		}
+		selfmetrics.Default().SetReplica(replica)
+		agentRegistry.SetReplica(replica)
+		logger.GetLogger().Info("HA mode: per-replica metrics", zap.String("replica", replica))
+	}
+
+	// Self-метрики сервера (server.*) записываются в то же хранилище, что и метрики агентов
+	go selfmetrics.Default().Run(ctx, s, cfg.SelfMetrics)
+	go agentRegistry.Run(ctx, s)
+
+	if elector != nil {
+		go elector.Run(ctx)
+		logger.GetLogger().Info("HA mode: leader election started")
+	}
+
+	// Поток обновлений для GET /stream
+	streamHub := stream.NewHub(cfg.StreamBuffer, cfg.StreamDrop)
+
+	r := router.New(router.Deps{
+		Svc:            svc,
+		Key:            cfg.CryptoKey,
+		AuditPublisher: auditPublisher,
+		Alerts:         alerts,
+		Agents:         agentRegistry,
+		Stream:         streamHub,
+		Health:         checks,
+		Build:          health.BuildInfo{Version: buildVersion, Date: buildDate, Commit: buildCommit},
+		Leader:         elector,
+	})
 
 	logger.GetLogger().Info("Server started",
 		zap.String("address", cfg.ServerAddress),
@@ -83,8 +256,8 @@ func main() {
 	)
 
 	server := &http.Server{Addr: cfg.ServerAddress, Handler: r}
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+	// SSE-соединения бесконечны — закрываем их, чтобы Shutdown не ждал таймаута
+	server.RegisterOnShutdown(streamHub.Close)
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
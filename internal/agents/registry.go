@@ -0,0 +1,263 @@
+// Package agents отслеживает агентов, присылающих метрики на сервер.
+//
+// Агент представляется заголовками X-Agent-ID и X-Agent-Version; по ним
+// реестр запоминает время последнего обращения, версию и адрес агента,
+// вычисляет его состояние (up/stale/down) и публикует синтетический gauge
+// "up.<id>" (1 — агент на связи, 0 — нет), который можно использовать
+// в правилах алертов и на дашбордах. Каждая реплика сервера видит только
+// своих агентов, поэтому с несколькими репликами на одной БД gauge пишется
+// как "up.<replica>.<id>" (см. SetReplica).
+package agents
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+)
+
+// Состояния агента
+const (
+	StateUp    = "up"    // отчитывался недавно
+	StateStale = "stale" // пропустил несколько отчётов
+	StateDown  = "down"  // давно не выходил на связь
+)
+
+// UpMetricPrefix — префикс синтетических gauge-метрик доступности агентов.
+const UpMetricPrefix = "up."
+
+// maxIDLen — максимальная длина X-Agent-ID.
+const maxIDLen = 128
+
+// upInterval — период публикации gauge-метрик доступности.
+const upInterval = 5 * time.Second
+
+// Agent — сведения об агенте, отдаются в GET /agents.
+type Agent struct {
+	ID       string    `json:"id"`
+	Version  string    `json:"version,omitempty"`
+	Address  string    `json:"address,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+	State    string    `json:"state"`
+}
+
+// Registry хранит последние сведения о каждом агенте. Число агентов
+// ограничено, а давно молчащие агенты забываются.
+type Registry struct {
+	staleAfter  time.Duration
+	downAfter   time.Duration
+	forgetAfter time.Duration // 0 — не забывать
+	maxAgents   int           // 0 — без ограничения
+
+	mu      sync.RWMutex
+	agents  map[string]*Agent
+	replica string // "" — одна реплика
+
+	now func() time.Time // подменяется в тестах
+}
+
+// NewRegistry создаёт реестр. Агент считается stale, если не выходил на связь
+// дольше staleAfter, и down — дольше downAfter; через forgetAfter он
+// удаляется из реестра (0 — никогда). Реестр хранит не больше maxAgents
+// агентов (0 — без ограничения).
+func NewRegistry(staleAfter, downAfter, forgetAfter time.Duration, maxAgents int) *Registry {
+	return &Registry{
+		staleAfter:  staleAfter,
+		downAfter:   downAfter,
+		forgetAfter: forgetAfter,
+		maxAgents:   maxAgents,
+		agents:      make(map[string]*Agent),
+		now:         time.Now,
+	}
+}
+
+// SetReplica задаёт идентификатор реплики для имён gauge: "up.<replica>.<id>".
+// replica не должен содержать точек, иначе имя станет неоднозначным.
+func (r *Registry) SetReplica(replica string) {
+	r.mu.Lock()
+	r.replica = replica
+	r.mu.Unlock()
+}
+
+// ValidID проверяет X-Agent-ID: до 128 символов, только буквы, цифры и "_.-".
+// Так имя gauge "up.<id>" однозначно соответствует агенту.
+func ValidID(id string) bool {
+	if id == "" || len(id) > maxIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_', c == '.', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Touch отмечает обращение агента. Некорректный ID не регистрируется;
+// новый агент при заполненном реестре вытесняет самого давно молчащего
+// из агентов в состоянии down, а если таких нет — не регистрируется.
+func (r *Registry) Touch(id, version, address string) {
+	if !ValidID(id) {
+		return
+	}
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.agents[id]
+	if !ok {
+		if r.maxAgents > 0 && len(r.agents) >= r.maxAgents && !r.evictLocked(now) {
+			logger.GetLogger().Warn("Agent registry is full, agent ignored",
+				zap.String("agent_id", id), zap.Int("max_agents", r.maxAgents))
+			return
+		}
+		a = &Agent{ID: id}
+		r.agents[id] = a
+		logger.GetLogger().Info("New agent registered", zap.String("agent_id", id), zap.String("version", version))
+	}
+	a.Version = version
+	a.Address = address
+	a.LastSeen = now
+}
+
+// evictLocked удаляет самого давно молчащего агента, если он в состоянии down.
+// Вызывается под r.mu.
+func (r *Registry) evictLocked(now time.Time) bool {
+	var oldest *Agent
+	for _, a := range r.agents {
+		if oldest == nil || a.LastSeen.Before(oldest.LastSeen) {
+			oldest = a
+		}
+	}
+	if oldest == nil || r.state(now, oldest.LastSeen) != StateDown {
+		return false
+	}
+	delete(r.agents, oldest.ID)
+	logger.GetLogger().Info("Agent evicted from registry", zap.String("agent_id", oldest.ID))
+	return true
+}
+
+// Forget удаляет агентов, молчащих дольше forgetAfter.
+func (r *Registry) Forget() {
+	if r.forgetAfter <= 0 {
+		return
+	}
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, a := range r.agents {
+		if now.Sub(a.LastSeen) > r.forgetAfter {
+			delete(r.agents, id)
+			logger.GetLogger().Info("Agent forgotten", zap.String("agent_id", id))
+		}
+	}
+}
+
+// List возвращает всех известных агентов с актуальным состоянием, отсортированных по ID.
+func (r *Registry) List() []Agent {
+	now := r.now()
+
+	r.mu.RLock()
+	out := make([]Agent, 0, len(r.agents))
+	for _, a := range r.agents {
+		cp := *a
+		cp.State = r.state(now, a.LastSeen)
+		out = append(out, cp)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (r *Registry) state(now, lastSeen time.Time) string {
+	switch age := now.Sub(lastSeen); {
+	case age > r.downAfter:
+		return StateDown
+	case age > r.staleAfter:
+		return StateStale
+	default:
+		return StateUp
+	}
+}
+
+// Middleware регистрирует агента по заголовкам запроса, если запрос
+// обработан успешно (2xx): отклонённые и неудавшиеся запросы агента живым не делают.
+func (r *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(consts.HeaderAgentID)
+		if id == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, req)
+		if sw.status >= 200 && sw.status < 300 {
+			r.Touch(id, req.Header.Get(consts.HeaderAgentVersion), req.RemoteAddr)
+		}
+	})
+}
+
+// statusWriter запоминает код ответа.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// PublishUp забывает давно молчащих агентов и записывает в хранилище
+// gauge доступности (UpMetricName) для каждого оставшегося.
+func (r *Registry) PublishUp(ctx context.Context, store interfaces.Store) {
+	r.Forget()
+	for _, a := range r.List() {
+		v := 0.0
+		if a.State == StateUp {
+			v = 1
+		}
+		if err := store.SetGauge(ctx, r.UpMetricName(a.ID), v); err != nil {
+			logger.GetLogger().Warn("Failed to publish agent up metric", zap.String("agent_id", a.ID), zap.Error(err))
+		}
+	}
+}
+
+// Run периодически публикует gauge-метрики доступности до отмены ctx.
+func (r *Registry) Run(ctx context.Context, store interfaces.Store) {
+	ticker := time.NewTicker(upInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.PublishUp(ctx, store)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// UpMetricName возвращает имя gauge доступности агента: "up.<id>" или,
+// с заданной репликой, "up.<replica>.<id>". ID проверен ValidID,
+// поэтому разные агенты получают разные имена.
+func (r *Registry) UpMetricName(id string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.replica == "" {
+		return UpMetricPrefix + id
+	}
+	return UpMetricPrefix + r.replica + "." + id
+}
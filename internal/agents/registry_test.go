@@ -0,0 +1,111 @@
+package agents
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/memstorage"
+)
+
+func TestRegistry_States(t *testing.T) {
+	r := NewRegistry(30*time.Second, 2*time.Minute, 0, 0)
+	now := time.Unix(1_700_000_000, 0)
+	r.now = func() time.Time { return now }
+
+	r.Touch("host-a", "v1.0.0", "10.0.0.1:5000")
+	r.Touch("", "v1.0.0", "10.0.0.2:5000") // без ID не регистрируем
+
+	list := r.List()
+	require.Len(t, list, 1)
+	assert.Equal(t, "host-a", list[0].ID)
+	assert.Equal(t, "v1.0.0", list[0].Version)
+	assert.Equal(t, StateUp, list[0].State)
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, StateStale, r.List()[0].State)
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, StateDown, r.List()[0].State)
+}
+
+func TestRegistry_MiddlewareAndUpMetric(t *testing.T) {
+	r := NewRegistry(30*time.Second, 2*time.Minute, 0, 0)
+	status := http.StatusOK
+	h := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	}))
+	send := func(id string) {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.Header.Set(consts.HeaderAgentID, id)
+		req.Header.Set(consts.HeaderAgentVersion, "v2")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	send("web-01.example")
+	// неуспешные запросы и некорректные ID агента не регистрируют
+	status = http.StatusBadRequest
+	send("rejected")
+	status = http.StatusInternalServerError
+	send("failed")
+	status = http.StatusOK
+	send("web-01.example:1")
+	send("a b")
+
+	list := r.List()
+	require.Len(t, list, 1)
+	assert.Equal(t, "web-01.example", list[0].ID)
+
+	store := memstorage.New()
+	r.PublishUp(context.Background(), store)
+
+	v, ok, _ := store.GetGauge(context.Background(), "up.web-01.example")
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, v)
+}
+
+func TestRegistry_CapAndForget(t *testing.T) {
+	r := NewRegistry(30*time.Second, 2*time.Minute, time.Hour, 2)
+	now := time.Unix(1_700_000_000, 0)
+	r.now = func() time.Time { return now }
+
+	r.Touch("a", "", "")
+	r.Touch("b", "", "")
+	r.Touch("c", "", "") // реестр полон, все живы — не регистрируется
+	assert.Len(t, r.List(), 2)
+
+	now = now.Add(3 * time.Minute)
+	r.Touch("b", "", "")
+	r.Touch("c", "", "") // вытесняет a: он down и молчит дольше всех
+	ids := []string{}
+	for _, a := range r.List() {
+		ids = append(ids, a.ID)
+	}
+	assert.Equal(t, []string{"b", "c"}, ids)
+
+	now = now.Add(2 * time.Hour)
+	r.Forget()
+	assert.Empty(t, r.List())
+}
+
+func TestRegistry_UpMetricNameWithReplica(t *testing.T) {
+	r := NewRegistry(30*time.Second, 2*time.Minute, 0, 0)
+	assert.Equal(t, "up.web-01.example", r.UpMetricName("web-01.example"))
+	r.SetReplica("server-2")
+	assert.Equal(t, "up.server-2.web-01.example", r.UpMetricName("web-01.example"))
+}
+
+func TestValidID(t *testing.T) {
+	for _, id := range []string{"host-1", "web_01.example", "A.b-c_9"} {
+		assert.True(t, ValidID(id), id)
+	}
+	for _, id := range []string{"", "a b", "a:b", "a/b", "ы", string(make([]byte, maxIDLen+1))} {
+		assert.False(t, ValidID(id), id)
+	}
+}
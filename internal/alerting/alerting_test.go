@@ -0,0 +1,138 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/memstorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+)
+
+func TestParseExpr(t *testing.T) {
+	c, err := parseExpr("FreeMemory < 5e8 for 2m")
+	require.NoError(t, err)
+	assert.Equal(t, "FreeMemory", c.metric)
+	assert.False(t, c.rate)
+	assert.Equal(t, "<", c.op)
+	assert.Equal(t, 5e8, c.threshold)
+	assert.Equal(t, 2*time.Minute, c.forDur)
+
+	c, err = parseExpr("rate(PollCount) == 0")
+	require.NoError(t, err)
+	assert.True(t, c.rate)
+	assert.Equal(t, "PollCount", c.metric)
+	assert.Zero(t, c.forDur)
+
+	for _, bad := range []string{"", "Alloc", "Alloc ~ 1", "Alloc > x", "Alloc > 1 during 1m", "Alloc > 1 for soon", "rate() > 1"} {
+		_, err := parseExpr(bad)
+		assert.ErrorIs(t, err, ErrBadExpr, bad)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name":"LowMemory","expr":"FreeMemory < 5e8 for 2m"}]`), 0o644))
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name":"A","expr":"x > 1"},{"name":"A","expr":"y > 1"}]`), 0o644))
+	_, err = LoadRules(path)
+	assert.Error(t, err)
+}
+
+func TestEngine_StateTransitions(t *testing.T) {
+	ctx := context.Background()
+	store := memstorage.New()
+	e, err := NewEngine(store, []Rule{{Name: "LowMemory", Expr: "FreeMemory < 100 for 2m"}}, nil, time.Minute)
+	require.NoError(t, err)
+
+	now := time.Unix(1_700_000_000, 0)
+	e.now = func() time.Time { return now }
+
+	// нет данных — алерт неактивен
+	e.Evaluate(ctx)
+	assert.Equal(t, StateInactive, e.Alerts()[0].State)
+
+	require.NoError(t, store.SetGauge(ctx, "FreeMemory", 50))
+	e.Evaluate(ctx)
+	assert.Equal(t, StatePending, e.Alerts()[0].State)
+
+	now = now.Add(time.Minute)
+	e.Evaluate(ctx)
+	assert.Equal(t, StatePending, e.Alerts()[0].State)
+
+	now = now.Add(time.Minute)
+	e.Evaluate(ctx)
+	a := e.Alerts()[0]
+	assert.Equal(t, StateFiring, a.State)
+	require.NotNil(t, a.FiredAt)
+
+	require.NoError(t, store.SetGauge(ctx, "FreeMemory", 500))
+	now = now.Add(time.Minute)
+	e.Evaluate(ctx)
+	a = e.Alerts()[0]
+	assert.Equal(t, StateResolved, a.State)
+	require.NotNil(t, a.ResolvedAt)
+}
+
+func TestEngine_StorageFailureKeepsState(t *testing.T) {
+	ctx := context.Background()
+	store := memstorage.New()
+	e, err := NewEngine(store, []Rule{{Name: "LowMemory", Expr: "FreeMemory < 100"}}, nil, time.Minute)
+	require.NoError(t, err)
+
+	require.NoError(t, store.SetGauge(ctx, "FreeMemory", 50))
+	e.Evaluate(ctx)
+	require.Equal(t, StateFiring, e.Alerts()[0].State)
+
+	// хранилище недоступно — это не «метрика пропала», алерт не разрешается
+	e.store = storetest.Failing{Err: interfaces.ErrUnavailable}
+	e.Evaluate(ctx)
+	a := e.Alerts()[0]
+	assert.Equal(t, StateFiring, a.State)
+	assert.Nil(t, a.ResolvedAt)
+}
+
+func TestEngine_RateAndWebhook(t *testing.T) {
+	ctx := context.Background()
+	got := make(chan Notification, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&n))
+		got <- n
+	}))
+	defer srv.Close()
+
+	store := memstorage.New()
+	e, err := NewEngine(store, []Rule{{Name: "Stalled", Expr: "rate(PollCount) == 0"}}, []string{srv.URL}, time.Minute)
+	require.NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+	e.now = func() time.Time { return now }
+
+	require.NoError(t, store.IncrementCounter(ctx, "PollCount", 5))
+	e.Evaluate(ctx) // первый замер — rate ещё не определён
+	assert.Equal(t, StateInactive, e.Alerts()[0].State)
+
+	now = now.Add(10 * time.Second)
+	e.Evaluate(ctx) // счётчик не менялся — rate == 0
+	assert.Equal(t, StateFiring, e.Alerts()[0].State)
+
+	select {
+	case n := <-got:
+		assert.Equal(t, "Stalled", n.Alert.Name)
+		assert.Equal(t, StateFiring, n.Alert.State)
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
@@ -0,0 +1,227 @@
+package alerting
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+)
+
+// Состояния алерта
+const (
+	StateInactive = "inactive" // условие не выполняется
+	StatePending  = "pending"  // условие выполняется, но меньше, чем "for"
+	StateFiring   = "firing"   // условие выполняется дольше "for"
+	StateResolved = "resolved" // алерт был firing, условие перестало выполняться
+)
+
+// Alert — текущее состояние правила, отдаётся в GET /alerts.
+type Alert struct {
+	Name        string     `json:"name"`
+	Expr        string     `json:"expr"`
+	State       string     `json:"state"`
+	Value       *float64   `json:"value,omitempty"`        // последнее вычисленное значение
+	ActiveSince *time.Time `json:"active_since,omitempty"` // с какого момента условие выполняется
+	FiredAt     *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	LastEval    *time.Time `json:"last_eval,omitempty"`
+}
+
+// ruleState — правило вместе с состоянием вычисления.
+type ruleState struct {
+	rule  Rule
+	cond  condition
+	alert Alert
+
+	// для rate(): предыдущее значение счётчика и время его снятия
+	prevValue float64
+	prevAt    time.Time
+	hasPrev   bool
+}
+
+// Engine периодически вычисляет правила по хранилищу и рассылает уведомления.
+type Engine struct {
+	store    interfaces.Store
+	notifier *WebhookNotifier
+	interval time.Duration
+
+	mu    sync.RWMutex
+	rules []*ruleState
+
+	now func() time.Time // подменяется в тестах
+}
+
+// NewEngine создаёт движок. Правила должны быть предварительно проверены LoadRules.
+// webhooks — общие адреса уведомлений для всех правил.
+func NewEngine(store interfaces.Store, rules []Rule, webhooks []string, interval time.Duration) (*Engine, error) {
+	e := &Engine{
+		store:    store,
+		notifier: NewWebhookNotifier(webhooks),
+		interval: interval,
+		now:      time.Now,
+	}
+	for _, r := range rules {
+		c, err := parseExpr(r.Expr)
+		if err != nil {
+			return nil, err
+		}
+		e.rules = append(e.rules, &ruleState{
+			rule:  r,
+			cond:  c,
+			alert: Alert{Name: r.Name, Expr: r.Expr, State: StateInactive},
+		})
+	}
+	return e, nil
+}
+
+// Run вычисляет правила каждые interval до отмены ctx.
+func (e *Engine) Run(ctx context.Context) {
+	if e.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.Evaluate(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Evaluate выполняет один проход по всем правилам.
+func (e *Engine) Evaluate(ctx context.Context) {
+	now := e.now()
+
+	e.mu.Lock()
+	var events []Notification
+	for _, rs := range e.rules {
+		if n, ok := e.evalRule(ctx, rs, now); ok {
+			events = append(events, n)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, n := range events {
+		logger.GetLogger().Info("Alert state changed",
+			zap.String("alert", n.Alert.Name), zap.String("state", n.Alert.State))
+		e.notifier.Send(ctx, n)
+	}
+}
+
+// evalRule обновляет состояние правила; возвращает уведомление при переходе в firing/resolved.
+func (e *Engine) evalRule(ctx context.Context, rs *ruleState, now time.Time) (Notification, bool) {
+	v, ok, err := e.sample(ctx, rs, now)
+	if err != nil {
+		// хранилище недоступно: состояние правила не меняем до следующей оценки
+		logger.GetLogger().Warn("Failed to evaluate alert rule",
+			zap.String("alert", rs.alert.Name), zap.Error(err))
+		return Notification{}, false
+	}
+
+	a := &rs.alert
+	a.LastEval = timePtr(now)
+	if ok {
+		a.Value = &v
+	} else {
+		a.Value = nil
+	}
+	active := ok && rs.cond.match(v)
+
+	switch {
+	case active && (a.State == StateInactive || a.State == StateResolved):
+		a.ActiveSince = timePtr(now)
+		a.ResolvedAt = nil
+		if rs.cond.forDur > 0 {
+			a.State = StatePending
+			return Notification{}, false
+		}
+		a.State = StateFiring
+		a.FiredAt = timePtr(now)
+		return e.notification(rs, now), true
+
+	case active && a.State == StatePending:
+		if now.Sub(*a.ActiveSince) >= rs.cond.forDur {
+			a.State = StateFiring
+			a.FiredAt = timePtr(now)
+			return e.notification(rs, now), true
+		}
+
+	case !active && a.State == StatePending:
+		a.State = StateInactive
+		a.ActiveSince = nil
+
+	case !active && a.State == StateFiring:
+		a.State = StateResolved
+		a.ActiveSince = nil
+		a.ResolvedAt = timePtr(now)
+		return e.notification(rs, now), true
+	}
+	return Notification{}, false
+}
+
+// sample достаёт текущее значение селектора правила.
+// Для обычного селектора ищется gauge, затем counter.
+// Для rate() нужна пара последовательных замеров, поэтому первый вызов данных не даёт.
+func (e *Engine) sample(ctx context.Context, rs *ruleState, now time.Time) (float64, bool, error) {
+	v, found, err := e.read(ctx, rs.cond.metric)
+	if err != nil {
+		return 0, false, err
+	}
+	if !found {
+		rs.hasPrev = false
+		return 0, false, nil
+	}
+
+	if !rs.cond.rate {
+		return v, true, nil
+	}
+
+	prev, prevAt, hadPrev := rs.prevValue, rs.prevAt, rs.hasPrev
+	rs.prevValue, rs.prevAt, rs.hasPrev = v, now, true
+	dt := now.Sub(prevAt).Seconds()
+	if !hadPrev || dt <= 0 {
+		return 0, false, nil
+	}
+	return (v - prev) / dt, true, nil
+}
+
+// read ищет метрику сначала среди gauge, затем среди counter.
+func (e *Engine) read(ctx context.Context, name string) (float64, bool, error) {
+	if g, ok, err := e.store.GetGauge(ctx, name); err != nil || ok {
+		return g, ok, err
+	}
+	c, ok, err := e.store.GetCounter(ctx, name)
+	return float64(c), ok, err
+}
+
+func (e *Engine) notification(rs *ruleState, now time.Time) Notification {
+	return Notification{
+		Alert:     rs.alert,
+		Timestamp: now.Unix(),
+		webhooks:  rs.rule.Webhooks,
+	}
+}
+
+// Alerts возвращает снимок состояний всех правил, отсортированный по имени.
+func (e *Engine) Alerts() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]Alert, 0, len(e.rules))
+	for _, rs := range e.rules {
+		out = append(out, rs.alert)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func timePtr(t time.Time) *time.Time { return &t }
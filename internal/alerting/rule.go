@@ -0,0 +1,155 @@
+// Package alerting реализует движок пороговых алертов поверх хранилища метрик.
+//
+// Правила задаются выражениями вида
+//
+//	FreeMemory < 5e8 for 2m
+//	rate(PollCount) == 0 for 1m
+//
+// и периодически вычисляются по текущему состоянию interfaces.Store.
+// Для каждого правила отслеживаются состояния pending, firing и resolved,
+// а переходы в firing/resolved рассылаются на webhook'и.
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBadExpr возвращается при некорректном выражении правила.
+var ErrBadExpr = errors.New("alerting: bad rule expression")
+
+// Rule описывает правило алерта в файле правил.
+//
+// Пример файла:
+//
+//	[
+//	  {"name": "LowMemory", "expr": "FreeMemory < 5e8 for 2m"},
+//	  {"name": "AgentStalled", "expr": "rate(PollCount) == 0 for 1m", "webhooks": ["http://hooks/alert"]}
+//	]
+type Rule struct {
+	// Name — уникальное имя алерта
+	Name string `json:"name"`
+	// Expr — условие срабатывания
+	Expr string `json:"expr"`
+	// Webhooks — дополнительные адреса уведомлений (помимо общих из конфигурации)
+	Webhooks []string `json:"webhooks,omitempty"`
+}
+
+// condition — разобранное выражение правила.
+type condition struct {
+	metric    string        // имя метрики
+	rate      bool          // rate(metric): скорость изменения в секунду
+	op        string        // оператор сравнения
+	threshold float64       // порог
+	forDur    time.Duration // сколько условие должно держаться до firing
+}
+
+// LoadRules читает правила из JSON-файла и проверяет их выражения.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("alerting: read rules: %w", err)
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("alerting: decode rules: %w", err)
+	}
+	seen := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("alerting: rule without name (expr=%q)", r.Expr)
+		}
+		if _, dup := seen[r.Name]; dup {
+			return nil, fmt.Errorf("alerting: duplicate rule name %q", r.Name)
+		}
+		seen[r.Name] = struct{}{}
+		if _, err := parseExpr(r.Expr); err != nil {
+			return nil, fmt.Errorf("alerting: rule %q: %w", r.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+// parseExpr разбирает выражение "<selector> <op> <number> [for <duration>]",
+// где selector — имя метрики или rate(имя).
+func parseExpr(expr string) (condition, error) {
+	var c condition
+	fields := strings.Fields(expr)
+	if len(fields) != 3 && len(fields) != 5 {
+		return c, fmt.Errorf("%w: %q", ErrBadExpr, expr)
+	}
+
+	sel := fields[0]
+	if strings.HasPrefix(sel, "rate(") && strings.HasSuffix(sel, ")") {
+		c.rate = true
+		sel = strings.TrimSuffix(strings.TrimPrefix(sel, "rate("), ")")
+	}
+	if !validMetricName(sel) {
+		return c, fmt.Errorf("%w: bad metric name %q", ErrBadExpr, sel)
+	}
+	c.metric = sel
+
+	switch fields[1] {
+	case "<", "<=", ">", ">=", "==", "!=":
+		c.op = fields[1]
+	default:
+		return c, fmt.Errorf("%w: unknown operator %q", ErrBadExpr, fields[1])
+	}
+
+	th, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return c, fmt.Errorf("%w: bad threshold %q", ErrBadExpr, fields[2])
+	}
+	c.threshold = th
+
+	if len(fields) == 5 {
+		if fields[3] != "for" {
+			return c, fmt.Errorf("%w: expected \"for\", got %q", ErrBadExpr, fields[3])
+		}
+		d, err := time.ParseDuration(fields[4])
+		if err != nil || d < 0 {
+			return c, fmt.Errorf("%w: bad duration %q", ErrBadExpr, fields[4])
+		}
+		c.forDur = d
+	}
+	return c, nil
+}
+
+func validMetricName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_', r == '.', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// match сравнивает значение с порогом.
+func (c condition) match(v float64) bool {
+	switch c.op {
+	case "<":
+		return v < c.threshold
+	case "<=":
+		return v <= c.threshold
+	case ">":
+		return v > c.threshold
+	case ">=":
+		return v >= c.threshold
+	case "==":
+		return v == c.threshold
+	case "!=":
+		return v != c.threshold
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+)
+
+// Notification — тело webhook-уведомления о смене состояния алерта.
+type Notification struct {
+	Alert     Alert `json:"alert"`
+	Timestamp int64 `json:"ts"` // unix timestamp перехода
+
+	webhooks []string // адреса конкретного правила
+}
+
+// backoffs — паузы между повторными попытками доставки
+var backoffs = []time.Duration{time.Second, 3 * time.Second, 5 * time.Second}
+
+// WebhookNotifier доставляет уведомления POST-запросами с JSON-телом.
+// Доставка асинхронная и с ретраями, чтобы не тормозить вычисление правил.
+type WebhookNotifier struct {
+	urls   []string
+	client *http.Client
+}
+
+// NewWebhookNotifier создаёт нотификатор с общим списком адресов.
+func NewWebhookNotifier(urls []string) *WebhookNotifier {
+	return &WebhookNotifier{
+		urls: urls,
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+// Send отправляет уведомление на общие адреса и адреса правила.
+func (w *WebhookNotifier) Send(ctx context.Context, n Notification) {
+	targets := make([]string, 0, len(w.urls)+len(n.webhooks))
+	targets = append(targets, w.urls...)
+	targets = append(targets, n.webhooks...)
+
+	for _, url := range targets {
+		go func(url string) {
+			if err := w.deliver(ctx, url, n); err != nil {
+				logger.GetLogger().Error("Failed to deliver alert webhook",
+					zap.String("url", url), zap.String("alert", n.Alert.Name), zap.Error(err))
+			}
+		}(url)
+	}
+}
+
+// deliver отправляет уведомление с повторами по backoffs.
+func (w *WebhookNotifier) deliver(ctx context.Context, url string, n Notification) error {
+	var err error
+	for i := 0; i <= len(backoffs); i++ {
+		if err = postJSON(ctx, w.client, url, n); err == nil {
+			return nil
+		}
+		if i == len(backoffs) {
+			break
+		}
+		select {
+		case <-time.After(backoffs[i]):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// postJSON сериализует payload в JSON и отправляет его POST-запросом на url.
+// Любой ответ вне диапазона 2xx считается ошибкой.
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("server returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
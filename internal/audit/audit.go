@@ -2,18 +2,30 @@
 package audit
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
 
 	"go.uber.org/zap"
 
 	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
 )
 
 // AuditEvent представляет событие аудита
 type AuditEvent struct {
-	Timestamp int64    `json:"ts"`         // unix timestamp события
-	Metrics   []string `json:"metrics"`    // наименование полученных метрик
-	IPAddress string   `json:"ip_address"` // IP адрес входящего запроса
+	Timestamp int64          `json:"ts"`                   // unix timestamp события
+	Metrics   []string       `json:"metrics"`              // наименование полученных метрик
+	IPAddress string         `json:"ip_address"`           // IP адрес входящего запроса
+	RequestID string         `json:"request_id,omitempty"` // X-Request-ID запроса (корреляция с логами)
+	Endpoint  string         `json:"endpoint,omitempty"`   // метод и маршрут: "POST /updates/"
+	UserAgent string         `json:"user_agent,omitempty"` // User-Agent клиента
+	AgentID   string         `json:"agent_id,omitempty"`   // X-Agent-ID, если запрос от агента
+	Outcome   string         `json:"outcome,omitempty"`    // success | rejected | failure
+	Status    int            `json:"status,omitempty"`     // HTTP-код ответа
+	Error     string         `json:"error,omitempty"`      // код ошибки для rejected/failure (ErrCode*)
+	Values    []MetricChange `json:"values,omitempty"`     // типы и значения метрик (VerbosityValues)
 }
 
 // Observer интерфейс наблюдателя (подписчика)
@@ -22,6 +34,32 @@ type Observer interface {
 	Close() error
 }
 
+// sinkStatus запоминает результат последней доставки события наблюдателем.
+// Встраивается в наблюдателей и даёт им метод Check для проверки готовности.
+type sinkStatus struct {
+	mu  sync.Mutex
+	err error
+}
+
+// record сохраняет результат доставки и возвращает его без изменений.
+func (s *sinkStatus) record(err error) error {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	return err
+}
+
+// Check возвращает ошибку последней доставки; nil — доставка прошла успешно
+// или событий ещё не было.
+func (s *sinkStatus) Check(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return fmt.Errorf("last audit delivery failed: %w", s.err)
+	}
+	return nil
+}
+
 // Publisher интерфейс издателя (publisher)
 type Publisher interface {
 	Register(observer Observer)
@@ -29,60 +67,129 @@ type Publisher interface {
 	NotifyAll(event AuditEvent)
 }
 
-// AuditPublisher реализация publisher для аудита
+// AuditPublisher реализация publisher для аудита. Каждому наблюдателю
+// достаётся своя ограниченная очередь с фоновой доставкой (см. QueueConfig),
+// поэтому медленный приёмник не тормозит запросы и других наблюдателей.
 type AuditPublisher struct {
 	mu        sync.RWMutex
-	observers []Observer
+	observers []*queue
+	verbosity string
+	queue     QueueConfig
 }
 
-// NewAuditPublisher создает новый publisher
+// NewAuditPublisher создает новый publisher с подробностью VerbosityBasic
+// и очередями DefaultQueueConfig
 func NewAuditPublisher() *AuditPublisher {
 	return &AuditPublisher{
-		observers: make([]Observer, 0),
+		observers: make([]*queue, 0),
+		verbosity: VerbosityBasic,
+		queue:     DefaultQueueConfig(),
+	}
+}
+
+// SetVerbosity задаёт подробность событий: basic | failures | values.
+func (p *AuditPublisher) SetVerbosity(v string) error {
+	switch v {
+	case VerbosityBasic, VerbosityFailures, VerbosityValues:
+	default:
+		return fmt.Errorf("audit: unknown verbosity %q (want %s | %s | %s)",
+			v, VerbosityBasic, VerbosityFailures, VerbosityValues)
 	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.verbosity = v
+	return nil
+}
+
+// Verbosity возвращает подробность событий.
+func (p *AuditPublisher) Verbosity() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.verbosity
 }
 
-// Register регистрирует нового наблюдателя
+// SetQueue задаёт параметры очередей доставки. Действует на наблюдателей,
+// зарегистрированных после вызова.
+func (p *AuditPublisher) SetQueue(cfg QueueConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queue = cfg
+	return nil
+}
+
+// Register регистрирует нового наблюдателя и запускает его очередь
 func (p *AuditPublisher) Register(observer Observer) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.observers = append(p.observers, observer)
+	p.observers = append(p.observers, newQueue(observer, p.queue))
 }
 
-// Deregister удаляет наблюдателя
+// Deregister удаляет наблюдателя, дождавшись доставки его очереди (не дольше DrainTimeout)
 func (p *AuditPublisher) Deregister(observer Observer) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	var q *queue
 	for i, obs := range p.observers {
-		if obs == observer {
-			p.observers = append(p.observers[:i], p.observers[i+1:]...)
+		if obs.sink == observer {
+			q = obs
+			// новый массив: NotifyAll может обходить старый без блокировки
+			p.observers = append(p.observers[:i:i], p.observers[i+1:]...)
 			break
 		}
 	}
+	drain := p.queue.DrainTimeout
+	p.mu.Unlock()
+
+	if q == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	if err := q.close(ctx); err != nil {
+		logger.GetLogger().Error("Failed to close audit observer", zap.Error(err))
+	}
 }
 
-// NotifyAll оповещает всех наблюдателей о событии
+// NotifyAll ставит событие в очереди всех наблюдателей. Не ждёт доставки;
+// блокируется только при политике OverflowBlock и заполненной очереди.
 func (p *AuditPublisher) NotifyAll(event AuditEvent) {
 	p.mu.RLock()
-	defer p.mu.RUnlock()
-	for _, observer := range p.observers {
-		// Запускаем в горутине, чтобы не блокировать основной поток
-		go func(obs Observer) {
-			if err := obs.Notify(event); err != nil {
-				logger.GetLogger().Error("Failed to notify audit observer", zap.Error(err))
-			}
-		}(observer)
+	observers := p.observers
+	p.mu.RUnlock()
+	for _, q := range observers {
+		if err := q.push(event); err != nil {
+			selfmetrics.Add("audit.failures", 1)
+			logger.GetLogger().Error("Failed to notify audit observer",
+				zap.String("request_id", event.RequestID), zap.Error(err))
+		}
 	}
 }
 
-// Close закрывает всех наблюдателей
+// Close прекращает приём событий, ждёт доставки накопленных в очередях
+// не дольше DrainTimeout и закрывает наблюдателей. Возвращает ошибку,
+// если часть событий не успела уйти или наблюдатель не закрылся.
 func (p *AuditPublisher) Close() error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	for _, observer := range p.observers {
-		if err := observer.Close(); err != nil {
-			logger.GetLogger().Error("Failed to close audit observer", zap.Error(err))
-		}
+	observers := p.observers
+	p.observers = nil
+	drain := p.queue.DrainTimeout
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+
+	// Очереди дочитываются параллельно: общий срок на всех
+	errs := make([]error, len(observers))
+	var wg sync.WaitGroup
+	for i, q := range observers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = q.close(ctx)
+		}()
 	}
-	return nil
+	wg.Wait()
+	return errors.Join(errs...)
 }
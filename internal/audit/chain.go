@@ -0,0 +1,334 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Цепочка хешей файла аудита.
+//
+// Каждая строка файла начинается с полей "seq" (сквозной номер, не
+// сбрасывается при ротации) и "prev_hash" — хеш предыдущей строки без
+// перевода строки: HMAC-SHA256 с ключом аудита или SHA-256 без ключа.
+// Изменение, удаление или вставка строки ломает цепочку на следующей строке.
+// Последнюю строку защищают контрольные точки: при открытии, закрытии
+// и перед ротацией файла пишется строка с type=checkpoint и подписью "sig"
+// самой точки. Оборванная при падении сервера последняя строка при открытии
+// отрезается, а потеря отмечается точкой recovered с числом отброшенных байт.
+
+// CheckpointType — значение поля "type" строки контрольной точки.
+const CheckpointType = "checkpoint"
+
+// Причины контрольной точки
+const (
+	CheckpointOpen      = "open"      // сервер открыл файл
+	CheckpointRotate    = "rotate"    // последняя строка файла перед ротацией
+	CheckpointClose     = "close"     // сервер закрыл файл при остановке
+	CheckpointRecovered = "recovered" // при открытии отрезана оборванная последняя строка
+)
+
+// Checkpoint — строка контрольной точки в файле аудита.
+type Checkpoint struct {
+	Seq      uint64 `json:"seq"`
+	PrevHash string `json:"prev_hash"`
+	Type     string `json:"type"`
+	Reason   string `json:"reason"`
+	TS       int64  `json:"ts"`
+	File     string `json:"file,omitempty"`    // для rotate: имя, под которым сохранён файл
+	Dropped  int64  `json:"dropped,omitempty"` // для recovered: сколько байт оборванной строки отброшено
+	Sig      string `json:"sig,omitempty"`     // хеш строки точки без поля sig
+}
+
+// chainHeader — поля цепочки, общие для всех строк.
+type chainHeader struct {
+	Seq      *uint64 `json:"seq"`
+	PrevHash *string `json:"prev_hash"`
+	Type     string  `json:"type"`
+}
+
+// chainHash считает хеш строки: HMAC-SHA256 с ключом или SHA-256 без него.
+func chainHash(key []byte, line []byte) string {
+	if len(key) == 0 {
+		sum := sha256.Sum256(line)
+		return hex.EncodeToString(sum[:])
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(line)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// chain — состояние цепочки пишущей стороны: номер и хеш последней строки.
+type chain struct {
+	key  []byte
+	seq  uint64
+	prev string
+}
+
+// event дописывает поля цепочки в начало JSON-объекта события.
+func (c *chain) event(data []byte) []byte {
+	c.seq++
+	line := fmt.Appendf(nil, `{"seq":%d,"prev_hash":%q,`, c.seq, c.prev)
+	line = append(line, data[1:]...)
+	c.prev = chainHash(c.key, line)
+	return line
+}
+
+// checkpoint строит подписанную строку контрольной точки cp,
+// заполняя поля цепочки.
+func (c *chain) checkpoint(cp Checkpoint) ([]byte, error) {
+	c.seq++
+	cp.Seq, cp.PrevHash, cp.Type = c.seq, c.prev, CheckpointType
+	unsigned, err := json.Marshal(cp)
+	if err != nil {
+		return nil, err
+	}
+	cp.Sig = chainHash(c.key, unsigned)
+	line, err := json.Marshal(cp)
+	if err != nil {
+		return nil, err
+	}
+	c.prev = chainHash(c.key, line)
+	return line, nil
+}
+
+// resume продолжает цепочку с последней строки существующего файла.
+// Строка без поля seq (файл до включения цепочки) тоже хешируется,
+// а нумерация тогда начинается заново.
+func (c *chain) resume(last []byte) {
+	if len(last) == 0 {
+		return
+	}
+	var h chainHeader
+	if json.Unmarshal(last, &h) == nil && h.Seq != nil {
+		c.seq = *h.Seq
+	}
+	c.prev = chainHash(c.key, last)
+}
+
+// lastLine возвращает последнюю непустую строку файла без перевода строки,
+// её смещение в файле и признак того, что строка дописана до конца
+// (за ней есть перевод строки). Читает файл с конца блоками, чтобы не
+// сканировать его целиком.
+func lastLine(f *os.File) (line []byte, off int64, complete bool, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	const block = 4096
+	end := info.Size()
+	var tail []byte
+	for pos := end; pos > 0; {
+		n := min(int64(block), pos)
+		pos -= n
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, pos); err != nil {
+			return nil, 0, false, err
+		}
+		tail = append(buf, tail...)
+		trimmed := bytes.TrimRight(tail, "\n")
+		complete = len(trimmed) < len(tail)
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], pos + int64(i) + 1, complete, nil
+		}
+		if pos == 0 {
+			return trimmed, 0, complete, nil
+		}
+	}
+	return nil, 0, false, nil
+}
+
+// repairTail отрезает оборванную последнюю строку файла — без перевода
+// строки и не JSON (сервер упал посреди записи) — и возвращает последнюю
+// целую строку и число отброшенных байт. Полная строка, у которой не дописан
+// только перевод строки, сохраняется: он дописывается.
+func repairTail(f *os.File) (last []byte, dropped int64, err error) {
+	last, off, complete, err := lastLine(f)
+	if err != nil || len(last) == 0 || complete && json.Valid(last) {
+		return last, 0, err
+	}
+	if json.Valid(last) {
+		_, err = f.Write([]byte{'\n'})
+		return last, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := f.Truncate(off); err != nil {
+		return nil, 0, err
+	}
+	last, _, _, err = lastLine(f)
+	return last, info.Size() - off, err
+}
+
+// OpenLog открывает файл аудита на чтение; ротированный файл .gz распаковывается.
+func OpenLog(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil || !strings.HasSuffix(name, ".gz") {
+		return f, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return gzipFile{zr, f}, nil
+}
+
+// gzipFile закрывает и распаковщик, и файл под ним.
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g gzipFile) Close() error { return errors.Join(g.Reader.Close(), g.f.Close()) }
+
+// ChainError — нарушение цепочки: файл и номер строки (с 1).
+type ChainError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ChainError) Error() string { return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err) }
+func (e *ChainError) Unwrap() error { return e.Err }
+
+// Ошибки проверки цепочки
+var (
+	ErrChainBroken  = errors.New("prev_hash does not match the previous line")
+	ErrChainSeq     = errors.New("seq is out of order")
+	ErrChainSig     = errors.New("checkpoint signature mismatch")
+	ErrChainMissing = errors.New("line has no seq/prev_hash after the chain started")
+)
+
+// ChainVerifier проверяет цепочку строк одного или нескольких файлов,
+// переданных по порядку (от старых к новым).
+type ChainVerifier struct {
+	key []byte
+
+	started bool
+	seq     uint64
+	prev    string
+	line    int
+
+	FirstSeq  uint64 // номер первой строки цепочки
+	Lines     int    // проверено строк цепочки
+	Checks    int    // из них контрольных точек
+	Unsealed  int    // строк после последней контрольной точки: их последнюю можно изменить незаметно
+	Unchained int    // строк до начала цепочки (файл до её включения)
+	Recovered int    // точек recovered: сервер отбросил оборванную при падении строку
+	Dropped   int64  // сколько байт отброшено по точкам recovered
+}
+
+// NewChainVerifier создаёт проверку с ключом аудита (пустой — SHA-256).
+func NewChainVerifier(key []byte) *ChainVerifier {
+	return &ChainVerifier{key: key}
+}
+
+// VerifyFile проверяет строки r как продолжение уже проверенных.
+// Возвращает *ChainError на первой строке, где цепочка нарушена.
+func (v *ChainVerifier) VerifyFile(name string, r io.Reader) error {
+	v.line = 0
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		v.line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		if err := v.next(sc.Bytes()); err != nil {
+			return &ChainError{File: name, Line: v.line, Err: err}
+		}
+	}
+	return sc.Err()
+}
+
+func (v *ChainVerifier) next(line []byte) error {
+	var h chainHeader
+	if err := json.Unmarshal(line, &h); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if h.Seq == nil || h.PrevHash == nil {
+		if v.started {
+			return ErrChainMissing
+		}
+		v.Unchained++
+		v.prev = chainHash(v.key, line)
+		return nil
+	}
+
+	// Начало цепочки: ссылку на строку перед первым файлом проверить нечем,
+	// кроме хеша строк без цепочки, если они были
+	switch {
+	case !v.started && v.Unchained == 0:
+		v.FirstSeq = *h.Seq
+	case !v.started:
+		if *h.PrevHash != v.prev {
+			return ErrChainBroken
+		}
+		v.FirstSeq = *h.Seq
+	default:
+		if *h.PrevHash != v.prev {
+			return ErrChainBroken
+		}
+		if *h.Seq != v.seq+1 {
+			return fmt.Errorf("%w: got %d, want %d", ErrChainSeq, *h.Seq, v.seq+1)
+		}
+	}
+
+	if h.Type == CheckpointType {
+		cp, err := v.checkpoint(line)
+		if err != nil {
+			return err
+		}
+		if cp.Reason == CheckpointRecovered {
+			v.Recovered++
+			v.Dropped += cp.Dropped
+		}
+		v.Checks++
+		v.Unsealed = 0
+	} else {
+		v.Unsealed++
+	}
+
+	v.started = true
+	v.seq = *h.Seq
+	v.prev = chainHash(v.key, line)
+	v.Lines++
+	return nil
+}
+
+func (v *ChainVerifier) checkpoint(line []byte) (Checkpoint, error) {
+	var cp Checkpoint
+	if err := json.Unmarshal(line, &cp); err != nil {
+		return cp, fmt.Errorf("invalid checkpoint: %w", err)
+	}
+	sig := cp.Sig
+	cp.Sig = ""
+	unsigned, err := json.Marshal(cp)
+	if err != nil {
+		return cp, err
+	}
+	if !hmac.Equal([]byte(sig), []byte(chainHash(v.key, unsigned))) {
+		return cp, ErrChainSig
+	}
+	// Лишние поля или другой порядок подпись бы не заметила
+	cp.Sig = sig
+	if signed, err := json.Marshal(cp); err != nil || !bytes.Equal(signed, line) {
+		return cp, ErrChainSig
+	}
+	return cp, nil
+}
+
+// LastSeq возвращает номер последней проверенной строки цепочки.
+func (v *ChainVerifier) LastSeq() uint64 { return v.seq }
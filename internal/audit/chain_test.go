@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeAudit пишет n событий в файл аудита path, пересоздавая наблюдателя
+// (как при перезапуске сервера) каждые restartEvery событий.
+func writeAudit(t *testing.T, path string, opts FileOptions, n, restartEvery int) {
+	t.Helper()
+	obs, err := NewFileAuditObserver(path, opts)
+	require.NoError(t, err)
+	for i := 1; i <= n; i++ {
+		require.NoError(t, obs.Notify(AuditEvent{Timestamp: int64(i), Metrics: []string{"m"}, RequestID: fmt.Sprint(i)}))
+		if i%restartEvery == 0 {
+			require.NoError(t, obs.Close())
+			obs, err = NewFileAuditObserver(path, opts)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, obs.Close())
+}
+
+// auditFiles — ротированные файлы по времени и текущий последним.
+func auditFiles(t *testing.T, path string) []string {
+	t.Helper()
+	rotated, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	sort.Strings(rotated)
+	return append(rotated, path)
+}
+
+func verify(key []byte, files ...string) (*ChainVerifier, error) {
+	v := NewChainVerifier(key)
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return v, err
+		}
+		if err := v.VerifyFile(name, bytes.NewReader(data)); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+func TestChainRotateAndVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	key := []byte("secret")
+	writeAudit(t, path, FileOptions{Key: key, MaxSize: 1024}, 30, 7)
+
+	files := auditFiles(t, path)
+	require.Greater(t, len(files), 2, "файл должен ротироваться")
+
+	v, err := verify(key, files...)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), v.FirstSeq)
+	assert.Equal(t, uint64(v.Lines), v.LastSeq(), "seq сквозной через ротации и перезапуски")
+	assert.Greater(t, v.Checks, 2*len(files)-2)
+
+	// другой ключ или пропущенный файл — нарушение
+	_, err = verify([]byte("other"), files...)
+	assert.ErrorIs(t, err, ErrChainSig)
+	_, err = verify(key, append(files[:1:1], files[2:]...)...)
+	var ce *ChainError
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, files[2], ce.File)
+	assert.Equal(t, 1, ce.Line)
+}
+
+func TestChainDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeAudit(t, path, FileOptions{}, 5, 100)
+	orig, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := bytes.SplitAfter(orig, []byte("\n"))
+	// строки: 1 — open, 2..6 — события, 7 — close
+
+	tamper := func(edit func([][]byte) [][]byte) error {
+		cp := make([][]byte, len(lines))
+		copy(cp, lines)
+		require.NoError(t, os.WriteFile(path, bytes.Join(edit(cp), nil), 0644))
+		_, err := verify(nil, path)
+		return err
+	}
+
+	tests := map[string]struct {
+		edit     func([][]byte) [][]byte
+		wantLine int
+		wantErr  error
+	}{
+		"edited line": {
+			edit: func(l [][]byte) [][]byte {
+				l[2] = bytes.Replace(l[2], []byte(`"metrics":["m"]`), []byte(`"metrics":["x"]`), 1)
+				return l
+			},
+			wantLine: 4, wantErr: ErrChainBroken,
+		},
+		"deleted line": {
+			edit:     func(l [][]byte) [][]byte { return append(l[:3:3], l[4:]...) },
+			wantLine: 4, wantErr: ErrChainBroken,
+		},
+		"forged checkpoint": {
+			edit: func(l [][]byte) [][]byte {
+				l[0] = bytes.Replace(l[0], []byte(`"reason":"open"`), []byte(`"reason":"rotate"`), 1)
+				return l
+			},
+			wantLine: 1, wantErr: ErrChainSig,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tamper(tc.edit)
+			var ce *ChainError
+			require.ErrorAs(t, err, &ce)
+			assert.Equal(t, tc.wantLine, ce.Line)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+
+	require.NoError(t, tamper(func(l [][]byte) [][]byte { return l }))
+}
+
+func TestChainContinuesLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ts":1,"metrics":["old"],"ip_address":""}`+"\n"), 0644))
+	writeAudit(t, path, FileOptions{}, 2, 100)
+
+	v, err := verify(nil, path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v.Unchained)
+	assert.Equal(t, 4, v.Lines, "open, два события, close")
+	assert.Zero(t, v.Unsealed, "хвост закрыт точкой close")
+}
+
+func TestChainRecoversTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	key := []byte("secret")
+	writeAudit(t, path, FileOptions{Key: key}, 2, 100)
+
+	// сервер упал посреди записи события: строка без перевода строки и не JSON
+	torn := `{"seq":5,"prev_hash":"ab`
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(torn)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = verify(key, path)
+	require.Error(t, err, "до перезапуска цепочка оборвана")
+
+	writeAudit(t, path, FileOptions{Key: key}, 1, 100)
+
+	v, err := verify(key, path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v.Recovered)
+	assert.Equal(t, int64(len(torn)), v.Dropped)
+	assert.Equal(t, uint64(v.Lines), v.LastSeq(), "seq продолжается после отброшенной строки")
+	assert.Equal(t, 8, v.Lines, "open, 2, close | recovered, open, 1, close")
+}
+
+func TestChainKeepsLineWithoutNewline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeAudit(t, path, FileOptions{}, 1, 100)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, bytes.TrimRight(data, "\n"), 0644))
+
+	writeAudit(t, path, FileOptions{}, 1, 100)
+
+	v, err := verify(nil, path)
+	require.NoError(t, err)
+	assert.Zero(t, v.Recovered, "целая строка без перевода строки сохраняется")
+	assert.Equal(t, 6, v.Lines)
+}
@@ -2,66 +2,425 @@
 package audit
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
 )
 
-// FileAuditObserver наблюдатель для записи в файл
+// FileOptions — параметры файла аудита.
+type FileOptions struct {
+	Key           []byte        // ключ HMAC цепочки хешей (пустой — SHA-256 без ключа)
+	MaxSize       int64         // размер файла в байтах, после которого он ротируется (0 — без ротации)
+	MaxAge        time.Duration // сколько писать в один файл до ротации (0 — без ротации по времени)
+	MaxBackups    int           // сколько ротированных файлов хранить (0 — все)
+	Compress      bool          // сжимать ротированные файлы gzip
+	FsyncInterval time.Duration // group commit: fsync не чаще раза в интервал (0 — после каждой записи)
+}
+
+// FileAuditObserver наблюдатель для записи в файл. Строки файла связаны
+// цепочкой хешей (см. chain.go), проверить её можно командой auditverify.
 type FileAuditObserver struct {
-	mu       sync.Mutex
-	filePath string
-	file     *os.File
+	sinkStatus
+	mu          sync.Mutex
+	filePath    string
+	file        *os.File
+	opts        FileOptions
+	chain       chain
+	size        int64
+	openedAt    time.Time
+	lastRotated string // имя последнего ротированного файла (см. rotatedName)
+	dirty       bool   // есть записи без fsync (для FsyncInterval)
+
+	bgMu      sync.Mutex // сжатие и удаление ротированных файлов идут по одному
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewFileAuditObserver создает наблюдателя для записи в файл. Цепочка
+// продолжается с последней строки существующего файла; в начале работы
+// пишется контрольная точка open. С FsyncInterval запускается фоновый fsync.
+func NewFileAuditObserver(filePath string, opts FileOptions) (*FileAuditObserver, error) {
+	f := &FileAuditObserver{
+		filePath: filePath,
+		opts:     opts,
+		chain:    chain{key: opts.Key},
+		done:     make(chan struct{}),
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	if err := f.writeCheckpoint(CheckpointOpen, ""); err != nil {
+		f.file.Close()
+		return nil, err
+	}
+	if opts.FsyncInterval > 0 {
+		f.wg.Add(1)
+		go f.syncLoop()
+	}
+	return f, nil
 }
 
-// NewFileAuditObserver создает наблюдателя для записи в файл
-func NewFileAuditObserver(filePath string) (*FileAuditObserver, error) {
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// open открывает файл на дозапись и подхватывает цепочку с его последней строки.
+// Оборванная последняя строка отрезается и отмечается точкой recovered.
+// Возраст файла для MaxAge отсчитывается от открытия.
+func (f *FileAuditObserver) open() error {
+	file, err := os.OpenFile(f.filePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open audit file: %w", err)
+		return fmt.Errorf("failed to open audit file: %w", err)
 	}
-	return &FileAuditObserver{
-		filePath: filePath,
-		file:     file,
-	}, nil
+	last, dropped, err := repairTail(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to read audit file tail: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit file: %w", err)
+	}
+	f.chain.resume(last)
+	f.file, f.size, f.openedAt = file, info.Size(), time.Now()
+	if dropped == 0 {
+		return nil
+	}
+	logger.GetLogger().Warn("Dropped torn last line of audit file",
+		zap.String("file", f.filePath), zap.Int64("bytes", dropped))
+	if err := f.writePoint(Checkpoint{Reason: CheckpointRecovered, Dropped: dropped}); err != nil {
+		file.Close()
+		f.file = nil
+		return err
+	}
+	return nil
 }
 
 // Notify записывает событие в файл
 func (f *FileAuditObserver) Notify(event AuditEvent) error {
+	return f.record(f.write([]AuditEvent{event}))
+}
+
+// NotifyBatch записывает события в файл одной записью с одним fsync
+func (f *FileAuditObserver) NotifyBatch(_ context.Context, events []AuditEvent) error {
+	return f.record(f.write(events))
+}
+
+func (f *FileAuditObserver) write(events []AuditEvent) error {
 	// Маршализация JSON вне критической секции (CPU-интенсивная операция)
-	data, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal audit event: %w", err)
+	encoded := make([][]byte, len(events))
+	for i, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return permanent(fmt.Errorf("failed to marshal audit event: %w", err))
+		}
+		encoded[i] = line
 	}
 
-	// Добавляем перевод строки вне критической секции
-	data = append(data, '\n')
-
-	// Критическая секция: только запись в файл и синхронизация с диском
+	// Критическая секция: цепочка хешей, запись в файл и синхронизация с диском
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	if _, err := f.file.Write(data); err != nil {
+	if f.file == nil {
+		return permanent(os.ErrClosed)
+	}
+	if f.needRotate() {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	for _, line := range encoded {
+		data = append(append(data, f.chain.event(line)...), '\n')
+	}
+	return f.append(data)
+}
+
+// needRotate — файл вырос больше MaxSize или пишется дольше MaxAge.
+func (f *FileAuditObserver) needRotate() bool {
+	return f.opts.MaxSize > 0 && f.size >= f.opts.MaxSize ||
+		f.opts.MaxAge > 0 && time.Since(f.openedAt) >= f.opts.MaxAge
+}
+
+// append дописывает данные в файл и синхронизирует его с диском:
+// сразу или, при FsyncInterval, в фоновом syncLoop. Вызывается под f.mu.
+func (f *FileAuditObserver) append(data []byte) error {
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	if err != nil {
 		return fmt.Errorf("failed to write audit event to file: %w", err)
 	}
+	if f.opts.FsyncInterval > 0 {
+		f.dirty = true
+		return nil
+	}
+	return f.sync()
+}
 
-	// Синхронизируем запись с диском
+// sync синхронизирует файл с диском. Вызывается под f.mu.
+func (f *FileAuditObserver) sync() error {
 	if err := f.file.Sync(); err != nil {
 		return fmt.Errorf("failed to sync audit file: %w", err)
 	}
+	f.dirty = false
+	return nil
+}
 
+// syncLoop — group commit: один fsync на все записи за FsyncInterval.
+func (f *FileAuditObserver) syncLoop() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.opts.FsyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.mu.Lock()
+			if f.dirty && f.file != nil {
+				f.record(f.sync())
+			}
+			f.mu.Unlock()
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// writeCheckpoint дописывает подписанную контрольную точку. Вызывается под f.mu
+// (или до того, как наблюдатель стал доступен).
+func (f *FileAuditObserver) writeCheckpoint(reason, file string) error {
+	return f.writePoint(Checkpoint{Reason: reason, File: file})
+}
+
+// writePoint дописывает контрольную точку cp с текущим временем.
+func (f *FileAuditObserver) writePoint(cp Checkpoint) error {
+	cp.TS = time.Now().Unix()
+	line, err := f.chain.checkpoint(cp)
+	if err != nil {
+		return fmt.Errorf("failed to build audit checkpoint: %w", err)
+	}
+	return f.append(append(line, '\n'))
+}
+
+// seal закрывает текущий файл контрольной точкой rotate с именем file
+// (пустым, если файл переименовал кто-то снаружи) и синхронизирует его.
+// Дескриптор остаётся открытым до switchFile. Вызывается под f.mu.
+func (f *FileAuditObserver) seal(file string) error {
+	if err := f.writeCheckpoint(CheckpointRotate, file); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// switchFile открывает файл заново по f.filePath и закрывает прежний
+// дескриптор. Если новый файл не открылся, запись продолжается в прежний:
+// события не теряются, цепочка не рвётся, а следующая попытка — после ещё
+// MaxSize байт или MaxAge. Контрольную точку open пишет вызывающий.
+// Вызывается под f.mu.
+func (f *FileAuditObserver) switchFile() error {
+	old, chain := f.file, f.chain
+	if err := f.open(); err != nil {
+		f.file, f.chain = old, chain
+		f.size, f.openedAt = 0, time.Now()
+		return err
+	}
+	if err := old.Close(); err != nil {
+		logger.GetLogger().Warn("Failed to close previous audit file", zap.Error(err))
+	}
 	return nil
 }
 
-// Close закрывает файл
-func (f *FileAuditObserver) Close() error {
+// rotate закрывает текущий файл контрольной точкой rotate, сохраняет его
+// под именем с временем ротации и начинает новый с контрольной точки open.
+// Цепочка продолжается: первая строка нового файла ссылается на последнюю строку старого.
+// Сжатие и удаление старых файлов идут в фоне. Вызывается под f.mu.
+func (f *FileAuditObserver) rotate() error {
+	rotated := rotatedName(f.filePath, time.Now(), f.lastRotated)
+	if err := f.seal(rotated); err != nil {
+		return err
+	}
+	if err := os.Rename(f.filePath, rotated); err != nil {
+		// Пишем дальше в тот же файл (цепочку точка rotate не ломает),
+		// следующая попытка — после ещё MaxSize байт или MaxAge
+		logger.GetLogger().Error("Failed to rotate audit file", zap.String("file", f.filePath), zap.Error(err))
+		f.size, f.openedAt = 0, time.Now()
+		return nil
+	}
+	if err := f.switchFile(); err != nil {
+		// Запись осталась в прежнем дескрипторе — возвращаем ему его имя
+		if rerr := os.Rename(rotated, f.filePath); rerr != nil {
+			logger.GetLogger().Error("Failed to restore audit file name", zap.String("file", rotated), zap.Error(rerr))
+		}
+		return fmt.Errorf("failed to rotate audit file: %w", err)
+	}
+	f.lastRotated = rotated
+	if f.opts.Compress || f.opts.MaxBackups > 0 {
+		f.wg.Add(1)
+		go f.afterRotate(rotated)
+	}
+	// Новый файл уже открыт: при ошибке точки open запись идёт в него,
+	// а ошибка попадает в Check
+	return f.writeCheckpoint(CheckpointOpen, "")
+}
+
+// Reopen закрывает файл контрольной точкой и открывает его заново по тому же
+// пути. Нужен внешней ротации (logrotate): она переименовывает файл и шлёт
+// серверу SIGHUP. Цепочка продолжается в новом файле. Если новый файл
+// не открылся, запись продолжается в переименованный.
+func (f *FileAuditObserver) Reopen() error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	if f.file != nil {
-		err := f.file.Close()
-		f.file = nil // Устанавливаем в nil, чтобы избежать повторного закрытия
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	if err := f.seal(""); err != nil {
+		return f.record(err)
+	}
+	if err := f.switchFile(); err != nil {
+		return f.record(err)
+	}
+	return f.record(f.writeCheckpoint(CheckpointOpen, ""))
+}
+
+// afterRotate сжимает ротированный файл и удаляет лишние старые.
+func (f *FileAuditObserver) afterRotate(rotated string) {
+	defer f.wg.Done()
+	f.bgMu.Lock()
+	defer f.bgMu.Unlock()
+
+	if f.opts.Compress {
+		if err := compressFile(rotated); err != nil {
+			logger.GetLogger().Error("Failed to compress audit file", zap.String("file", rotated), zap.Error(err))
+		}
+	}
+	if f.opts.MaxBackups > 0 {
+		if err := pruneBackups(f.filePath, f.opts.MaxBackups); err != nil {
+			logger.GetLogger().Error("Failed to remove old audit files", zap.Error(err))
+		}
+	}
+}
+
+// compressFile сжимает name в name.gz и удаляет исходный файл.
+// Пишет во временный файл, чтобы оборванное сжатие не оставило битый .gz.
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
 		return err
 	}
-	return nil
+	defer src.Close()
+
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	err = errors.Join(err, zw.Close(), dst.Sync(), dst.Close())
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// backups возвращает ротированные файлы path (сжатые и нет) от старых к новым.
+// Ротированным считается только имя вида rotatedName (с .gz или без):
+// прочие файлы с тем же префиксом (audit.log.bak) не трогаются.
+func backups(path string) ([]string, error) {
+	dir, base := filepath.Dir(path), filepath.Base(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !isRotated(base, name) {
+			continue
+		}
+		names = append(names, filepath.Join(dir, name))
+	}
+	sort.Strings(names) // имена содержат время ротации
+	return names, nil
+}
+
+// isRotated сообщает, что name — ротированный файл base: base.<время>[.gz].
+func isRotated(base, name string) bool {
+	stamp, ok := strings.CutPrefix(name, base+".")
+	if !ok {
+		return false
+	}
+	stamp = strings.TrimSuffix(stamp, ".gz")
+	_, err := time.Parse(rotatedLayout, stamp)
+	return err == nil
+}
+
+// pruneBackups оставляет keep последних ротированных файлов.
+func pruneBackups(path string, keep int) error {
+	names, err := backups(path)
+	if err != nil || len(names) <= keep {
+		return err
+	}
+	var errs []error
+	for _, name := range names[:len(names)-keep] {
+		errs = append(errs, os.Remove(name))
+	}
+	return errors.Join(errs...)
+}
+
+// rotatedLayout — формат времени в имени ротированного файла.
+const rotatedLayout = "20060102T150405.000"
+
+// rotatedName — имя ротированного файла: path.<время UTC с миллисекундами>.
+// Если такое имя уже занято (две ротации за миллисекунду) или не больше
+// предыдущего имени after, время сдвигается, чтобы имена оставались
+// уникальными и упорядоченными по времени, даже если старый файл с тем же
+// временем уже удалён pruneBackups.
+func rotatedName(path string, now time.Time, after string) string {
+	for {
+		name := path + "." + now.UTC().Format(rotatedLayout)
+		if name > after && !exists(name) && !exists(name+".gz") {
+			return name
+		}
+		now = now.Add(time.Millisecond)
+	}
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return !os.IsNotExist(err)
+}
+
+// Close закрывает файл контрольной точкой close и ждёт фоновых сжатий
+func (f *FileAuditObserver) Close() error {
+	var err error
+	f.closeOnce.Do(func() {
+		close(f.done)
+
+		f.mu.Lock()
+		if f.file != nil {
+			err = f.writeCheckpoint(CheckpointClose, "")
+			err = errors.Join(err, f.sync(), f.file.Close())
+			f.file = nil // Устанавливаем в nil, чтобы избежать повторной записи
+		}
+		f.mu.Unlock()
+
+		f.wg.Wait()
+	})
+	return err
 }
@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// verifyLogs проверяет цепочку файлов, в том числе сжатых.
+func verifyLogs(t *testing.T, key []byte, files ...string) *ChainVerifier {
+	t.Helper()
+	v := NewChainVerifier(key)
+	for _, name := range files {
+		r, err := OpenLog(name)
+		require.NoError(t, err)
+		require.NoError(t, v.VerifyFile(name, r), name)
+		require.NoError(t, r.Close())
+	}
+	return v
+}
+
+func TestFileRotationCompressAndPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	key := []byte("secret")
+	writeAudit(t, path, FileOptions{
+		Key:           key,
+		MaxSize:       512,
+		MaxBackups:    2,
+		Compress:      true,
+		FsyncInterval: time.Millisecond,
+	}, 40, 1000)
+
+	rotated, err := backups(path)
+	require.NoError(t, err)
+	require.Len(t, rotated, 2, "старые файлы удалены")
+	for _, name := range rotated {
+		assert.True(t, strings.HasSuffix(name, ".gz"), name)
+	}
+
+	// Удалённые файлы обрывают начало цепочки, но оставшиеся связаны
+	v := verifyLogs(t, key, append(rotated, path)...)
+	assert.Greater(t, v.FirstSeq, uint64(1))
+	assert.Equal(t, uint64(v.Lines), v.LastSeq()-v.FirstSeq+1)
+}
+
+func TestFileRotationByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	obs, err := NewFileAuditObserver(path, FileOptions{MaxAge: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, obs.Notify(AuditEvent{RequestID: "1"}))
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, obs.Notify(AuditEvent{RequestID: "2"}))
+	require.NoError(t, obs.Close())
+
+	rotated, err := backups(path)
+	require.NoError(t, err)
+	require.Len(t, rotated, 1)
+	verifyLogs(t, nil, rotated[0], path)
+}
+
+func TestFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	obs, err := NewFileAuditObserver(path, FileOptions{})
+	require.NoError(t, err)
+	require.NoError(t, obs.Notify(AuditEvent{RequestID: "1"}))
+
+	// logrotate переименовал файл и прислал SIGHUP
+	moved := filepath.Join(dir, "audit.log.1")
+	require.NoError(t, os.Rename(path, moved))
+	require.NoError(t, obs.Reopen())
+	require.NoError(t, obs.Notify(AuditEvent{RequestID: "2"}))
+	require.NoError(t, obs.Close())
+
+	v := verifyLogs(t, nil, moved, path)
+	assert.Equal(t, uint64(1), v.FirstSeq)
+	assert.Equal(t, 6, v.Lines, "open, 1, rotate | open, 2, close")
+	assert.Zero(t, v.Unsealed)
+
+	assert.ErrorIs(t, obs.Reopen(), os.ErrClosed)
+}
+
+func TestFileReopenFailureKeepsWriting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	obs, err := NewFileAuditObserver(path, FileOptions{})
+	require.NoError(t, err)
+	require.NoError(t, obs.Notify(AuditEvent{RequestID: "1"}))
+
+	// файл переименован, а новый по тому же пути создать нельзя
+	moved := filepath.Join(dir, "audit.log.1")
+	require.NoError(t, os.Rename(path, moved))
+	require.NoError(t, os.Mkdir(path, 0o755))
+	require.Error(t, obs.Reopen())
+	assert.Error(t, obs.Check(context.Background()), "сбой виден в /readyz")
+
+	// запись продолжается в прежний файл
+	require.NoError(t, obs.Notify(AuditEvent{RequestID: "2"}))
+	assert.NoError(t, obs.Check(context.Background()))
+
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, obs.Reopen())
+	require.NoError(t, obs.Notify(AuditEvent{RequestID: "3"}))
+	require.NoError(t, obs.Close())
+
+	v := verifyLogs(t, nil, moved, path)
+	assert.Equal(t, 8, v.Lines, "open, 1, rotate, 2, rotate | open, 3, close")
+}
+
+func TestFileReopenCheckpointFailureIsReported(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("нет /dev/full")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	obs, err := NewFileAuditObserver(path, FileOptions{})
+	require.NoError(t, err)
+
+	// новый файл открывается, но запись в него не проходит
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "audit.log.1")))
+	require.NoError(t, os.Symlink("/dev/full", path))
+	require.Error(t, obs.Reopen())
+	assert.Error(t, obs.Check(context.Background()), "сбой виден в /readyz")
+
+	// события не пропадают молча: запись в новый файл возвращает ошибку
+	assert.Error(t, obs.Notify(AuditEvent{RequestID: "1"}))
+	assert.Error(t, obs.Check(context.Background()))
+	_ = obs.Close()
+}
+
+func TestRotatedNameIncreases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	first := rotatedName(path, now, "")
+	// файл с тем же временем уже удалён, но новое имя всё равно идёт после него
+	assert.Greater(t, rotatedName(path, now, first), first)
+}
+
+func TestBackupsMatchOnlyRotatedNames(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	rotated := rotatedName(path, time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC), "")
+	for _, name := range []string{rotated, rotated + ".gz", path + ".bak", path + ".sig", path + ".1", rotated + ".gz.tmp"} {
+		require.NoError(t, os.WriteFile(name, nil, 0o644))
+	}
+
+	names, err := backups(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{rotated, rotated + ".gz"}, names)
+
+	require.NoError(t, pruneBackups(path, 1))
+	for _, name := range []string{path + ".bak", path + ".sig", path + ".1"} {
+		assert.FileExists(t, name, "посторонние файлы не удаляются")
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 // URLAuditObserver наблюдатель для отправки на удаленный сервер
 type URLAuditObserver struct {
+	sinkStatus
 	url    string
 	client *http.Client
 }
@@ -28,28 +29,41 @@ func NewURLAuditObserver(url string) *URLAuditObserver {
 
 // Notify отправляет событие на удаленный сервер
 func (u *URLAuditObserver) Notify(event AuditEvent) error {
-	data, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal audit event: %w", err)
+	return u.NotifyBatch(context.Background(), []AuditEvent{event})
+}
+
+// NotifyBatch отправляет события одним POST-запросом в формате NDJSON
+// (по JSON-объекту на строку). Ответ 4xx, кроме 408 и 429, повторять
+// бесполезно — такая ошибка помечается как окончательная.
+func (u *URLAuditObserver) NotifyBatch(ctx context.Context, events []AuditEvent) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf) // Encode дописывает перевод строки после каждого объекта
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return permanent(fmt.Errorf("failed to marshal audit event: %w", err))
+		}
 	}
 
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, u.url, bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url, &buf)
 	if err != nil {
-		return fmt.Errorf("failed to create audit request: %w", err)
+		return permanent(u.record(fmt.Errorf("failed to create audit request: %w", err)))
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", "application/x-ndjson")
 
 	resp, err := u.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send audit event: %w", err)
+		return u.record(fmt.Errorf("failed to send audit events: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("audit server returned status: %d", resp.StatusCode)
+		err = u.record(fmt.Errorf("failed to send audit events: server returned status: %d", resp.StatusCode))
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return permanent(err)
+		}
+		return err
 	}
-
-	return nil
+	return u.record(nil)
 }
 
 // Close закрывает HTTP клиент
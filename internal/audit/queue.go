@@ -0,0 +1,250 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
+)
+
+// Политики при переполнении очереди наблюдателя
+const (
+	OverflowBlock  = "block"  // NotifyAll ждёт места в очереди (запрос тормозит, события не теряются)
+	OverflowOldest = "oldest" // вытесняем самое старое событие из очереди
+	OverflowNewest = "newest" // отбрасываем новое событие
+)
+
+// ErrClosed — событие пришло после закрытия издателя.
+var ErrClosed = errors.New("audit: publisher closed")
+
+// BatchObserver — наблюдатель, принимающий несколько событий за одну доставку.
+// Очередь отдаёт ему батчи; остальным наблюдателям события идут по одному через Notify.
+type BatchObserver interface {
+	NotifyBatch(ctx context.Context, events []AuditEvent) error
+}
+
+// QueueConfig — параметры очереди доставки, общие для всех наблюдателей издателя.
+type QueueConfig struct {
+	Size         int           // ёмкость очереди событий на одного наблюдателя
+	BatchSize    int           // максимум событий в одной доставке
+	Overflow     string        // политика при переполнении: block | oldest | newest
+	MaxRetries   int           // повторы неудачной доставки (0 — без повторов)
+	RetryBase    time.Duration // пауза перед первым повтором, дальше удваивается
+	RetryMax     time.Duration // потолок паузы между повторами
+	DrainTimeout time.Duration // сколько Close ждёт доставки оставшихся событий
+}
+
+// DefaultQueueConfig — параметры очереди по умолчанию.
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Size:         1024,
+		BatchSize:    100,
+		Overflow:     OverflowOldest,
+		MaxRetries:   5,
+		RetryBase:    500 * time.Millisecond,
+		RetryMax:     30 * time.Second,
+		DrainTimeout: 5 * time.Second,
+	}
+}
+
+// validate проверяет параметры и подставляет минимальные значения.
+func (c *QueueConfig) validate() error {
+	switch c.Overflow {
+	case OverflowBlock, OverflowOldest, OverflowNewest:
+	default:
+		return fmt.Errorf("audit: unknown overflow policy %q (want %s | %s | %s)",
+			c.Overflow, OverflowBlock, OverflowOldest, OverflowNewest)
+	}
+	c.Size = max(c.Size, 1)
+	c.BatchSize = max(c.BatchSize, 1)
+	c.MaxRetries = max(c.MaxRetries, 0)
+	c.RetryMax = max(c.RetryMax, c.RetryBase)
+	return nil
+}
+
+// permanentError — ошибка доставки, которую бесполезно повторять (например, 4xx).
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error { return permanentError{err} }
+
+// queue — ограниченная очередь событий одного наблюдателя с фоновым
+// доставщиком: собирает батчи из накопившихся событий и повторяет
+// неудачные доставки с экспоненциальной паузой.
+type queue struct {
+	sink Observer
+	cfg  QueueConfig
+
+	mu      sync.RWMutex // защищает закрытие ch от параллельной отправки
+	ch      chan AuditEvent
+	closed  bool
+	closing chan struct{} // закрывается первым: будит ждущих при OverflowBlock
+
+	ctx    context.Context // отменяется, когда истёк срок дочитки в Close
+	cancel context.CancelFunc
+	done   chan struct{} // доставщик завершился
+}
+
+func newQueue(sink Observer, cfg QueueConfig) *queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &queue{
+		sink:    sink,
+		cfg:     cfg,
+		ch:      make(chan AuditEvent, cfg.Size),
+		closing: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// push ставит событие в очередь согласно политике переполнения.
+func (q *queue) push(event AuditEvent) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	select {
+	case q.ch <- event:
+		return nil
+	default:
+	}
+
+	switch q.cfg.Overflow {
+	case OverflowBlock:
+		select {
+		case q.ch <- event:
+			return nil
+		case <-q.closing:
+			return ErrClosed
+		}
+	case OverflowNewest:
+		q.drop(event)
+		return nil
+	default: // OverflowOldest
+		// Вытесняем по одному и пробуем снова: место может занять параллельный push
+		for {
+			select {
+			case old := <-q.ch:
+				q.drop(old)
+			default:
+			}
+			select {
+			case q.ch <- event:
+				return nil
+			default:
+			}
+		}
+	}
+}
+
+// drop учитывает событие, вытесненное из переполненной очереди.
+func (q *queue) drop(event AuditEvent) {
+	selfmetrics.Add("audit.dropped", 1)
+	logger.GetLogger().Warn("Audit queue is full, event dropped",
+		zap.String("policy", q.cfg.Overflow), zap.String("request_id", event.RequestID))
+}
+
+// run доставляет события, пока очередь не закрыта и не вычитана.
+// Батч — первое событие плюс всё, что успело накопиться, до BatchSize:
+// при малой нагрузке события уходят сразу, при большой — пачками.
+func (q *queue) run() {
+	defer close(q.done)
+	batch := make([]AuditEvent, 0, q.cfg.BatchSize)
+	for event := range q.ch {
+		batch = append(batch[:0], event)
+	fill:
+		for len(batch) < q.cfg.BatchSize {
+			select {
+			case e, ok := <-q.ch:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, e)
+			default:
+				break fill
+			}
+		}
+		q.deliver(batch)
+	}
+}
+
+// deliver отправляет батч с повторами; недоставленные события учитываются как отказы.
+func (q *queue) deliver(batch []AuditEvent) {
+	pending := batch
+	pause := q.cfg.RetryBase
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = q.ctx.Err(); err != nil {
+			break // срок дочитки истёк
+		}
+		var sent int
+		if sent, err = q.send(pending); err == nil {
+			return
+		}
+		pending = pending[sent:]
+		if attempt == q.cfg.MaxRetries || errors.As(err, new(permanentError)) {
+			break
+		}
+		select {
+		case <-time.After(pause):
+			pause = min(pause*2, q.cfg.RetryMax)
+		case <-q.ctx.Done():
+		}
+	}
+
+	selfmetrics.Add("audit.failures", int64(len(pending)))
+	logger.GetLogger().Error("Failed to deliver audit events",
+		zap.Int("events", len(pending)),
+		zap.String("first_request_id", pending[0].RequestID),
+		zap.Error(err))
+}
+
+// send передаёт события наблюдателю и возвращает, сколько из них доставлено.
+func (q *queue) send(events []AuditEvent) (int, error) {
+	if b, ok := q.sink.(BatchObserver); ok {
+		if err := b.NotifyBatch(q.ctx, events); err != nil {
+			return 0, err
+		}
+		return len(events), nil
+	}
+	for i, e := range events {
+		if err := q.sink.Notify(e); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// close прекращает приём событий и ждёт доставки оставшихся до отмены ctx.
+// Что не успело уйти к этому моменту, учитывается как отказ. Затем закрывает наблюдателя.
+func (q *queue) close(ctx context.Context) error {
+	close(q.closing)
+	q.mu.Lock()
+	q.closed = true
+	close(q.ch)
+	q.mu.Unlock()
+
+	var err error
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		err = fmt.Errorf("audit: drain: %d events not delivered: %w", len(q.ch), ctx.Err())
+		q.cancel()
+		<-q.done
+	}
+	q.cancel()
+	return errors.Join(err, q.sink.Close())
+}
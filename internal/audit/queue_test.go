@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gateSink — наблюдатель, который сообщает о начале доставки и ждёт разрешения.
+type gateSink struct {
+	started chan struct{}
+	gate    chan struct{}
+	mu      sync.Mutex
+	got     []string
+}
+
+func newGateSink() *gateSink {
+	return &gateSink{started: make(chan struct{}, 16), gate: make(chan struct{})}
+}
+
+func (s *gateSink) Notify(e AuditEvent) error {
+	s.started <- struct{}{}
+	<-s.gate
+	s.mu.Lock()
+	s.got = append(s.got, e.RequestID)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *gateSink) Close() error { return nil }
+
+func testQueueConfig() QueueConfig {
+	cfg := DefaultQueueConfig()
+	cfg.RetryBase, cfg.RetryMax = time.Millisecond, 4*time.Millisecond
+	cfg.DrainTimeout = time.Second
+	return cfg
+}
+
+func TestQueueOverflow(t *testing.T) {
+	tests := map[string][]string{
+		OverflowOldest: {"1", "3", "4"},
+		OverflowNewest: {"1", "2", "3"},
+		OverflowBlock:  {"1", "2", "3", "4"},
+	}
+	for policy, want := range tests {
+		t.Run(policy, func(t *testing.T) {
+			cfg := testQueueConfig()
+			cfg.Size, cfg.BatchSize, cfg.Overflow = 2, 1, policy
+			p := NewAuditPublisher()
+			require.NoError(t, p.SetQueue(cfg))
+			sink := newGateSink()
+			p.Register(sink)
+
+			// "1" занял доставщика, "2" и "3" заполнили очередь
+			p.NotifyAll(AuditEvent{RequestID: "1"})
+			<-sink.started
+			p.NotifyAll(AuditEvent{RequestID: "2"})
+			p.NotifyAll(AuditEvent{RequestID: "3"})
+
+			pushed := make(chan struct{})
+			go func() {
+				p.NotifyAll(AuditEvent{RequestID: "4"})
+				close(pushed)
+			}()
+			if policy == OverflowBlock {
+				select {
+				case <-pushed:
+					t.Fatal("NotifyAll не должен возвращаться при полной очереди")
+				case <-time.After(20 * time.Millisecond):
+				}
+			} else {
+				<-pushed // отбрасывание не ждёт доставщика
+			}
+
+			close(sink.gate)
+			<-pushed
+			require.NoError(t, p.Close())
+			assert.Equal(t, want, sink.got)
+		})
+	}
+}
+
+func TestURLObserverBatchRetry(t *testing.T) {
+	var calls atomic.Int32
+	var mu sync.Mutex
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			var e AuditEvent
+			if assert.NoError(t, json.Unmarshal(sc.Bytes(), &e)) {
+				mu.Lock()
+				got = append(got, e.RequestID)
+				mu.Unlock()
+			}
+		}
+	}))
+	defer srv.Close()
+
+	p := NewAuditPublisher()
+	require.NoError(t, p.SetQueue(testQueueConfig()))
+	obs := NewURLAuditObserver(srv.URL)
+	p.Register(obs)
+	for _, id := range []string{"a", "b", "c"} {
+		p.NotifyAll(AuditEvent{RequestID: id})
+	}
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, []string{"a", "b", "c"}, got, "после ретрая доставлены все события по порядку")
+	assert.GreaterOrEqual(t, calls.Load(), int32(2))
+	assert.NoError(t, obs.Check(t.Context()))
+}
+
+func TestURLObserverPermanentError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	p := NewAuditPublisher()
+	require.NoError(t, p.SetQueue(testQueueConfig()))
+	obs := NewURLAuditObserver(srv.URL)
+	p.Register(obs)
+	p.NotifyAll(AuditEvent{RequestID: "a"})
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, int32(1), calls.Load(), "4xx не повторяется")
+	assert.Error(t, obs.Check(t.Context()))
+}
+
+// failSink всегда отказывает с временной ошибкой.
+type failSink struct{ closed atomic.Bool }
+
+func (s *failSink) Notify(AuditEvent) error { return errors.New("unavailable") }
+func (s *failSink) Close() error            { s.closed.Store(true); return nil }
+
+func TestCloseDrainDeadline(t *testing.T) {
+	cfg := testQueueConfig()
+	cfg.MaxRetries, cfg.RetryBase, cfg.RetryMax = 100, time.Hour, time.Hour
+	cfg.DrainTimeout = 50 * time.Millisecond
+	p := NewAuditPublisher()
+	require.NoError(t, p.SetQueue(cfg))
+	sink := &failSink{}
+	p.Register(sink)
+	p.NotifyAll(AuditEvent{RequestID: "a"})
+	p.NotifyAll(AuditEvent{RequestID: "b"})
+
+	start := time.Now()
+	assert.Error(t, p.Close(), "недоставленные события — ошибка Close")
+	assert.Less(t, time.Since(start), time.Second)
+	assert.True(t, sink.closed.Load())
+
+	// после Close события не принимаются и не блокируют
+	p.NotifyAll(AuditEvent{RequestID: "c"})
+}
+
+func TestSetQueue(t *testing.T) {
+	p := NewAuditPublisher()
+	cfg := DefaultQueueConfig()
+	cfg.Overflow = "drop_all"
+	assert.Error(t, p.SetQueue(cfg))
+}
@@ -0,0 +1,168 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+)
+
+// Подробность аудита (см. AuditPublisher.SetVerbosity).
+const (
+	// VerbosityBasic — только успешные обновления: имена метрик и сведения о запросе.
+	VerbosityBasic = "basic"
+	// VerbosityFailures — ещё и отклонённые (неверный HMAC, 4xx) и неудавшиеся (5xx) запросы.
+	VerbosityFailures = "failures"
+	// VerbosityValues — как failures, плюс типы и значения метрик из запроса
+	// (для одиночного counter — ещё итог после записи). Значения до обновления
+	// не пишутся: для них пришлось бы читать хранилище на каждую метрику.
+	VerbosityValues = "values"
+)
+
+// Исход запроса в событии аудита.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeRejected = "rejected" // отклонён из-за ошибки клиента (4xx)
+	OutcomeFailure  = "failure"  // не выполнен из-за сервера или хранилища (5xx)
+)
+
+// Коды ошибок в событии аудита.
+const (
+	ErrCodeBadHMAC     = "bad_hmac"
+	ErrCodeUnsigned    = "unsigned" // операция требует подписи HashSHA256
+	ErrCodeBadRequest  = "bad_request"
+	ErrCodeInvalidType = "invalid_type"
+	ErrCodeBadValue    = "bad_value"
+	ErrCodeReserved    = "reserved_name" // имя метрики с префиксом server. или up.
+	ErrCodeUnavailable = "storage_unavailable"
+	ErrCodeInternal    = "internal_error"
+)
+
+// MetricChange — метрика запроса (VerbosityValues): тип и значения из самого
+// запроса — новое значение gauge или приращение counter. Для одиночного
+// обновления counter дописывается итог после записи, который вернул сервис.
+type MetricChange struct {
+	ID    string   `json:"id"`
+	MType string   `json:"type"`
+	Value *float64 `json:"value,omitempty"`
+	Delta *int64   `json:"delta,omitempty"`
+	Total *int64   `json:"total,omitempty"` // counter после приращения
+}
+
+// Record собирает сведения о запросе для события аудита: его заполняют
+// обработчики и middleware (Note, Reject), а событие строится после ответа (Event).
+type Record struct {
+	mu      sync.Mutex
+	values  bool
+	metrics []MetricChange
+	errCode string
+}
+
+type recordKey struct{}
+
+// WithRecord кладёт в ctx новую запись аудита; values — сохранять значения метрик.
+func WithRecord(ctx context.Context, values bool) (context.Context, *Record) {
+	rec := &Record{values: values}
+	return context.WithValue(ctx, recordKey{}, rec), rec
+}
+
+func recordFrom(ctx context.Context) *Record {
+	rec, _ := ctx.Value(recordKey{}).(*Record)
+	return rec
+}
+
+// Recording сообщает, ведётся ли аудит запроса из ctx.
+func Recording(ctx context.Context) bool {
+	return recordFrom(ctx) != nil
+}
+
+// WantValues сообщает, нужны ли аудиту значения метрик.
+func WantValues(ctx context.Context) bool {
+	rec := recordFrom(ctx)
+	return rec != nil && rec.values
+}
+
+// Note добавляет метрики запроса в запись аудита (вне аудита — no-op).
+func Note(ctx context.Context, changes ...MetricChange) {
+	if rec := recordFrom(ctx); rec != nil {
+		rec.mu.Lock()
+		rec.metrics = append(rec.metrics, changes...)
+		rec.mu.Unlock()
+	}
+}
+
+// NoteTotal дописывает итог counter id после записи (только VerbosityValues).
+func NoteTotal(ctx context.Context, id string, total int64) {
+	rec := recordFrom(ctx)
+	if rec == nil || !rec.values {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for i := len(rec.metrics) - 1; i >= 0; i-- {
+		if rec.metrics[i].ID == id && rec.metrics[i].MType == consts.MetricTypeCounter {
+			rec.metrics[i].Total = &total
+			return
+		}
+	}
+}
+
+// Reject задаёт код ошибки запроса; без него код выводится из HTTP-статуса.
+func Reject(ctx context.Context, code string) {
+	if rec := recordFrom(ctx); rec != nil {
+		rec.mu.Lock()
+		if rec.errCode == "" {
+			rec.errCode = code
+		}
+		rec.mu.Unlock()
+	}
+}
+
+// Event строит событие по записи и коду ответа status: метрики, исход и код ошибки.
+// Сведения о самом запросе (время, IP, endpoint) дописывает вызывающий.
+func (r *Record) Event(status int) AuditEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := AuditEvent{Metrics: make([]string, len(r.metrics)), Status: status, Outcome: outcome(status)}
+	for i, m := range r.metrics {
+		e.Metrics[i] = m.ID
+	}
+	if r.values {
+		e.Values = append([]MetricChange(nil), r.metrics...)
+	}
+	if e.Outcome != OutcomeSuccess {
+		e.Error = r.errCode
+		if e.Error == "" {
+			e.Error = errCode(status)
+		}
+	}
+	return e
+}
+
+func outcome(status int) string {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return OutcomeFailure
+	case status >= http.StatusBadRequest:
+		return OutcomeRejected
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// errCode — код ошибки по HTTP-статусу, если обработчик не задал свой.
+func errCode(status int) string {
+	switch {
+	case status == http.StatusBadRequest:
+		return ErrCodeBadRequest
+	case status == http.StatusServiceUnavailable:
+		return ErrCodeUnavailable
+	case status >= http.StatusInternalServerError:
+		return ErrCodeInternal
+	default:
+		return fmt.Sprintf("http_%d", status)
+	}
+}
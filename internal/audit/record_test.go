@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordEvent(t *testing.T) {
+	v := 1.5
+	ctx, rec := WithRecord(context.Background(), false)
+	Note(ctx, MetricChange{ID: "a", MType: "gauge", Value: &v}, MetricChange{ID: "b", MType: "counter"})
+
+	e := rec.Event(200)
+	assert.Equal(t, []string{"a", "b"}, e.Metrics)
+	assert.Equal(t, OutcomeSuccess, e.Outcome)
+	assert.Empty(t, e.Error)
+	assert.Nil(t, e.Values, "значения только при VerbosityValues")
+
+	// код ошибки по статусу, если обработчик его не задал
+	assert.Equal(t, ErrCodeBadRequest, rec.Event(400).Error)
+	assert.Equal(t, OutcomeRejected, rec.Event(400).Outcome)
+	assert.Equal(t, ErrCodeUnavailable, rec.Event(503).Error)
+	assert.Equal(t, ErrCodeInternal, rec.Event(500).Error)
+	assert.Equal(t, OutcomeFailure, rec.Event(500).Outcome)
+	assert.Equal(t, "http_404", rec.Event(404).Error)
+
+	// первый заданный код побеждает
+	Reject(ctx, ErrCodeBadHMAC)
+	Reject(ctx, ErrCodeBadValue)
+	assert.Equal(t, ErrCodeBadHMAC, rec.Event(400).Error)
+
+	ctx, rec = WithRecord(context.Background(), true)
+	assert.True(t, WantValues(ctx))
+	Note(ctx, MetricChange{ID: "a", MType: "gauge", Value: &v})
+	assert.Equal(t, []MetricChange{{ID: "a", MType: "gauge", Value: &v}}, rec.Event(200).Values)
+
+	// итог counter дописывается к его записи
+	d, total := int64(2), int64(7)
+	Note(ctx, MetricChange{ID: "c", MType: "counter", Delta: &d})
+	NoteTotal(ctx, "c", total)
+	NoteTotal(ctx, "a", total) // gauge итога не имеет
+	assert.Equal(t, []MetricChange{{ID: "a", MType: "gauge", Value: &v}, {ID: "c", MType: "counter", Delta: &d, Total: &total}},
+		rec.Event(200).Values)
+
+	// вне аудита — no-op
+	assert.False(t, Recording(context.Background()))
+	Note(context.Background(), MetricChange{ID: "x"})
+	Reject(context.Background(), ErrCodeBadHMAC)
+}
+
+func TestSetVerbosity(t *testing.T) {
+	p := NewAuditPublisher()
+	assert.Equal(t, VerbosityBasic, p.Verbosity())
+	assert.NoError(t, p.SetVerbosity(VerbosityValues))
+	assert.Equal(t, VerbosityValues, p.Verbosity())
+	assert.Error(t, p.SetVerbosity("everything"))
+	assert.Equal(t, VerbosityValues, p.Verbosity())
+}
@@ -3,10 +3,17 @@ package compressor
 import (
 	"compress/gzip"
 	"io"
-	"log"
 	"net/http"
 	"strings"
 	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
+	"github.com/SamSafonov2025/metrics-tpl/internal/tracing"
 )
 
 // GzipMiddleware содержит конфигурацию и пул для gzip compression middleware.
@@ -29,13 +36,21 @@ func NewGzipMiddleware() *GzipMiddleware {
 // Handler возвращает HTTP middleware для обработки gzip compression/decompression.
 func (gm *GzipMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Request URL: %s, Content-Encoding: %s, Accept-Encoding: %s", r.URL, r.Header.Get("Content-Encoding"), r.Header.Get("Accept-Encoding"))
+		logger.GetLogger().Debug("gzip middleware",
+			zap.String("path", r.URL.Path),
+			zap.String("Content-Encoding", r.Header.Get("Content-Encoding")),
+			zap.String("Accept-Encoding", r.Header.Get("Accept-Encoding")),
+		)
 
 		if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
 			// Создаем новый reader для каждого запроса
 			// gzip.Reader содержит внутреннее состояние, поэтому пулинг не эффективен
-			gzipReader, err := gzip.NewReader(r.Body)
+			body := &countingReader{r: r.Body}
+			defer func() { selfmetrics.Add("gzip.bytes_in", body.n) }()
+			_, span := tracing.Start(r.Context(), "gzip.decompress")
+			gzipReader, err := gzip.NewReader(body)
 			if err != nil {
+				tracing.End(span, err)
 				http.Error(w, "Unable to read gzip data", http.StatusBadRequest)
 				return
 			}
@@ -45,7 +60,9 @@ func (gm *GzipMiddleware) Handler(next http.Handler) http.Handler {
 				}
 			}()
 
-			r.Body = io.NopCloser(gzipReader)
+			plain := &tracedReader{r: gzipReader, compressed: body, span: span}
+			defer plain.end(nil)
+			r.Body = io.NopCloser(plain)
 		}
 
 		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
@@ -54,7 +71,9 @@ func (gm *GzipMiddleware) Handler(next http.Handler) http.Handler {
 			defer gm.gzipWriterPool.Put(gz)
 
 			// Переинициализируем writer для нового response
-			gz.Reset(w)
+			out := &countingWriter{w: w}
+			defer func() { selfmetrics.Add("gzip.bytes_out", out.n) }()
+			gz.Reset(out)
 			defer func() {
 				if err := gz.Close(); err != nil {
 					http.Error(w, "Unable to close gzip data", http.StatusBadRequest)
@@ -72,6 +91,63 @@ func (gm *GzipMiddleware) Handler(next http.Handler) http.Handler {
 	})
 }
 
+// countingReader считает сжатые байты тела запроса (self-метрика gzip.bytes_in).
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// tracedReader закрывает спан gzip.decompress, когда тело дочитано
+// (обычно это делает первый middleware, читающий тело целиком) или запрос завершён.
+type tracedReader struct {
+	r          io.Reader
+	compressed *countingReader
+	n          int64
+	span       trace.Span
+	done       bool
+}
+
+func (t *tracedReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+	if err == io.EOF {
+		t.end(nil)
+	} else if err != nil {
+		t.end(err)
+	}
+	return n, err
+}
+
+func (t *tracedReader) end(err error) {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.span.SetAttributes(
+		attribute.Int64("gzip.bytes_in", t.compressed.n),
+		attribute.Int64("gzip.bytes_out", t.n),
+	)
+	tracing.End(t.span, err)
+}
+
+// countingWriter считает сжатые байты ответа (self-метрика gzip.bytes_out).
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
 type gzipResponseWriter struct {
 	http.ResponseWriter
 	Writer io.Writer
@@ -80,3 +156,13 @@ type gzipResponseWriter struct {
 func (g *gzipResponseWriter) Write(b []byte) (int, error) {
 	return g.Writer.Write(b)
 }
+
+// Flush выталкивает накопленные gzip-данные клиенту (нужно для потоковых ответов, например SSE).
+func (g *gzipResponseWriter) Flush() {
+	if f, ok := g.Writer.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
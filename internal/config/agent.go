@@ -2,7 +2,6 @@ package config
 
 import (
 	"flag"
-	"fmt"
 	"os"
 	"strconv"
 	"time"
@@ -14,6 +13,12 @@ type AgentConfig struct {
 	ReportInterval time.Duration
 	CryptoKey      string
 	RateLimit      int
+	AgentID        string // идентификатор агента для сервера (по умолчанию hostname)
+	TraceExporter  string // экспорт спанов: none | stdout | otlp
+	OTLPEndpoint   string // адрес OTLP/HTTP коллектора для -trace-exporter=otlp
+	LogLevel       string // уровень логов: debug | info | warn | error
+	LogFormat      string // формат логов: json | console
+	LogSampling    bool   // сэмплирование повторяющихся сообщений лога
 }
 
 func ParseAgentFlags() *AgentConfig {
@@ -26,6 +31,13 @@ func ParseAgentFlags() *AgentConfig {
 	report := atoiEnv("REPORT_INTERVAL", 10)
 	key := getEnv("KEY", "")
 	rate := atoiEnv("RATE_LIMIT", 4)
+	hostname, _ := os.Hostname()
+	agentID := getEnv("AGENT_ID", hostname)
+	traceExporter := getEnv("TRACE_EXPORTER", "none")
+	otlpEndpoint := getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4318")
+	logLevel := getEnv("LOG_LEVEL", "info")
+	logFormat := getEnv("LOG_FORMAT", "json")
+	logSampling := boolEnv("LOG_SAMPLING", true)
 
 	// flags (флаг имеет приоритет над env)
 	flag.StringVar(&cfg.ServerAddress, "a", addr, "HTTP server endpoint address")
@@ -33,6 +45,12 @@ func ParseAgentFlags() *AgentConfig {
 	flag.IntVar(&reportSeconds, "r", report, "Report interval in seconds")
 	flag.StringVar(&cfg.CryptoKey, "k", key, "Key for hash calculation")
 	flag.IntVar(&cfg.RateLimit, "l", rate, "Max concurrent outbound requests (rate limit)")
+	flag.StringVar(&cfg.AgentID, "id", agentID, "Agent identifier reported to the server")
+	flag.StringVar(&cfg.TraceExporter, "trace-exporter", traceExporter, "Trace exporter: none | stdout | otlp")
+	flag.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", otlpEndpoint, "OTLP/HTTP collector endpoint (host:port or URL) for -trace-exporter=otlp")
+	flag.StringVar(&cfg.LogLevel, "log-level", logLevel, "Log level: debug | info | warn | error")
+	flag.StringVar(&cfg.LogFormat, "log-format", logFormat, "Log format: json | console")
+	flag.BoolVar(&cfg.LogSampling, "log-sampling", logSampling, "Sample repeated log messages")
 	flag.Parse()
 
 	// нормализация и перевод в duration
@@ -42,11 +60,6 @@ func ParseAgentFlags() *AgentConfig {
 	cfg.PollInterval = time.Duration(pollSeconds) * time.Second
 	cfg.ReportInterval = time.Duration(reportSeconds) * time.Second
 
-	// debug-выводы (оставил как в исходнике)
-	fmt.Printf("AGENT: key (%s) !!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!", key)
-	fmt.Printf("AGENT: cfg.CryptoKey (%s) !!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!", cfg.CryptoKey)
-	fmt.Printf("AGENT: rate_limit (%d)\n", cfg.RateLimit)
-
 	return cfg
 }
 
@@ -59,6 +72,15 @@ func atoiEnv(k string, def int) int {
 	return def
 }
 
+func boolEnv(k string, def bool) bool {
+	if v, ok := os.LookupEnv(k); ok {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
 func getEnv(k, def string) string {
 	if v, ok := os.LookupEnv(k); ok {
 		return v
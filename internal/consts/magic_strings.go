@@ -4,3 +4,14 @@ const (
 	MetricTypeGauge   = "gauge"
 	MetricTypeCounter = "counter"
 )
+
+// HTTP-заголовки, которыми агент представляется серверу
+const (
+	HeaderAgentID      = "X-Agent-ID"
+	HeaderAgentVersion = "X-Agent-Version"
+)
+
+// HeaderRequestID — идентификатор запроса для сквозной корреляции логов
+// агента, сервера и аудита. Сервер принимает его от клиента или генерирует сам
+// и возвращает в ответе.
+const HeaderRequestID = "X-Request-ID"
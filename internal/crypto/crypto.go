@@ -1,19 +1,27 @@
 package crypto
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt" // <— добавлено для форматирования сообщения об ошибке
+	"errors"
 	"io"
 	"net/http"
 	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
+	"github.com/SamSafonov2025/metrics-tpl/internal/audit"
 	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
+	"github.com/SamSafonov2025/metrics-tpl/internal/tracing"
 )
 
+// errInvalidHash отмечает спан hmac.validate при несовпадении подписи.
+var errInvalidHash = errors.New("invalid hash")
+
 func GenerateHash(data []byte, key string) string {
 	h := hmac.New(sha256.New, []byte(key))
 	h.Write(data)
@@ -24,6 +32,16 @@ type Crypto struct {
 	Key string
 }
 
+type verifiedKey struct{}
+
+// Verified сообщает, что запрос из ctx подписан ключом сервера и подпись
+// проверена HashValidationMiddleware. Без ключа на сервере или без заголовка
+// HashSHA256 возвращает false.
+func Verified(ctx context.Context) bool {
+	ok, _ := ctx.Value(verifiedKey{}).(bool)
+	return ok
+}
+
 func (c *Crypto) HashValidationMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -32,12 +50,12 @@ func (c *Crypto) HashValidationMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		logger.GetLogger().Info("HMAC: CryptoKey !!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!", zapString("cryptoKey: ", c.Key))
-
+		_, span := tracing.Start(r.Context(), "hmac.validate")
 		bodyBytes, err := io.ReadAll(r.Body)
 		if err != nil {
+			tracing.End(span, err)
 			// логирование ошибки чтения тела
-			logger.GetLogger().Warn("HMAC: unable to read request body", zapError(err))
+			logger.FromContext(r.Context()).Warn("HMAC: unable to read request body", zapError(err))
 			http.Error(w, "Unable to read request body", http.StatusInternalServerError)
 			return
 		}
@@ -46,19 +64,23 @@ func (c *Crypto) HashValidationMiddleware(next http.Handler) http.Handler {
 		expectedHash := GenerateHash(bodyBytes, c.Key)
 
 		receivedHash := r.Header.Get("HashSHA256")
+		span.SetAttributes(attribute.Int("hmac.body_bytes", len(bodyBytes)))
 		if receivedHash != expectedHash {
-			// логирование несовпадения хэша
-			logger.GetLogger().Warn(
-				"HMAC: invalid hash",
-				zapError(fmt.Errorf("received=%s expected=%s", receivedHash, expectedHash)),
-			)
+			tracing.End(span, errInvalidHash)
+			selfmetrics.Add("hmac.failures", 1)
+			audit.Reject(r.Context(), audit.ErrCodeBadHMAC)
+			// логирование несовпадения хэша (сами подписи не пишем: ожидаемая —
+			// валидная подпись для этого тела)
+			logger.FromContext(r.Context()).Warn("HMAC: invalid hash", zap.Int("body_bytes", len(bodyBytes)))
 			http.Error(w, "Invalid hash", http.StatusBadRequest)
 			return
 		}
 
+		span.End()
+
 		responseWriter := &responseHashWriter{ResponseWriter: w, key: c.Key}
 
-		next.ServeHTTP(responseWriter, r)
+		next.ServeHTTP(responseWriter, r.WithContext(context.WithValue(r.Context(), verifiedKey{}, true)))
 	})
 }
 
@@ -85,5 +107,4 @@ func (rw *responseHashWriter) WriteHeader(statusCode int) {
 
 // маленьк
 // ие помощники, чтобы не тащить zap в каждое место
-func zapError(err error) zap.Field    { return zap.Error(err) }
-func zapString(k, v string) zap.Field { return zap.String(k, v) }
+func zapError(err error) zap.Field { return zap.Error(err) }
@@ -0,0 +1,110 @@
+// Package dashboard содержит встроенный (embed.FS) HTML-дашборд сервера метрик.
+//
+// Страницы рендерятся на сервере и полностью работоспособны без JavaScript:
+// таблицы отсортированы по имени, фильтр передаётся параметром ?q=.
+// При включённом JavaScript страница сама обновляет значения опросом
+// /api/metrics и рисует sparkline по накопленной в браузере истории.
+package dashboard
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+//go:embed static
+var staticFS embed.FS
+
+var templates = template.Must(template.ParseFS(templatesFS, "templates/*.html"))
+
+// StaticPrefix — URL-префикс, под которым отдаются статические файлы дашборда.
+const StaticPrefix = "/static/"
+
+// RefreshSeconds — период автообновления страниц дашборда.
+const RefreshSeconds = 5
+
+// Row — строка таблицы метрик.
+type Row struct {
+	Name  string `json:"id"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// IndexPage — данные главной страницы.
+type IndexPage struct {
+	Query    string
+	Gauges   []Row
+	Counters []Row
+	Refresh  int
+}
+
+// MetricPage — данные страницы отдельной метрики.
+type MetricPage struct {
+	Row
+	Refresh int
+}
+
+// Rows превращает наборы gauge и counter в отсортированные по имени строки,
+// оставляя только имена, содержащие query (без учёта регистра).
+func Rows(gauges map[string]float64, counters map[string]int64, query string) (g []Row, c []Row) {
+	q := strings.ToLower(strings.TrimSpace(query))
+	match := func(name string) bool {
+		return q == "" || strings.Contains(strings.ToLower(name), q)
+	}
+
+	g = make([]Row, 0, len(gauges))
+	for name, v := range gauges {
+		if match(name) {
+			g = append(g, Row{Name: name, Type: "gauge", Value: FormatGauge(v)})
+		}
+	}
+	c = make([]Row, 0, len(counters))
+	for name, v := range counters {
+		if match(name) {
+			c = append(c, Row{Name: name, Type: "counter", Value: FormatCounter(v)})
+		}
+	}
+	sort.Slice(g, func(i, j int) bool { return g[i].Name < g[j].Name })
+	sort.Slice(c, func(i, j int) bool { return c[i].Name < c[j].Name })
+	return g, c
+}
+
+// FormatGauge форматирует значение gauge так же, как GET /value.
+func FormatGauge(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+// FormatCounter форматирует значение counter так же, как GET /value.
+func FormatCounter(v int64) string { return strconv.FormatInt(v, 10) }
+
+// RenderIndex рендерит главную страницу.
+func RenderIndex(w io.Writer, p IndexPage) error {
+	if p.Refresh == 0 {
+		p.Refresh = RefreshSeconds
+	}
+	return templates.ExecuteTemplate(w, "index.html", p)
+}
+
+// RenderMetric рендерит страницу отдельной метрики.
+func RenderMetric(w io.Writer, p MetricPage) error {
+	if p.Refresh == 0 {
+		p.Refresh = RefreshSeconds
+	}
+	return templates.ExecuteTemplate(w, "metric.html", p)
+}
+
+// Static возвращает обработчик статических файлов (js/css) под StaticPrefix.
+func Static() http.Handler {
+	sub, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		// embed гарантирует наличие каталога — сюда попасть нельзя
+		return http.NotFoundHandler()
+	}
+	return http.StripPrefix(StaticPrefix, http.FileServer(http.FS(sub)))
+}
@@ -0,0 +1,156 @@
+// Дашборд метрик: фильтрация, сортировка, автообновление и sparkline.
+// Без JavaScript страница остаётся рабочей (серверный рендер + meta refresh).
+(function () {
+  "use strict";
+
+  var HISTORY = 60; // сколько последних значений держим для sparkline
+  var refresh = parseInt(document.body.getAttribute("data-refresh"), 10) || 5;
+  var history = {}; // "type/name" -> [values]
+
+  function key(type, name) { return type + "/" + name; }
+
+  function remember(type, name, value) {
+    var k = key(type, name);
+    var h = history[k] || (history[k] = []);
+    h.push(value);
+    if (h.length > HISTORY) h.shift();
+    return h;
+  }
+
+  function sparkline(values, width, height) {
+    if (values.length < 2) return "";
+    var min = Math.min.apply(null, values), max = Math.max.apply(null, values);
+    var span = max - min || 1;
+    var step = width / (values.length - 1);
+    var pts = values.map(function (v, i) {
+      return (i * step).toFixed(1) + "," + (height - 1 - ((v - min) / span) * (height - 2)).toFixed(1);
+    }).join(" ");
+    return '<svg width="' + width + '" height="' + height + '"><polyline fill="none" stroke="#3572b0" ' +
+      'stroke-width="1.5" points="' + pts + '"/></svg>';
+  }
+
+  function drawSpark(cell, values) {
+    if (!cell) return;
+    var large = cell.classList.contains("large");
+    cell.innerHTML = sparkline(values, large ? 400 : 120, large ? 80 : 20);
+  }
+
+  // ---- главная страница ----
+
+  function applyFilter() {
+    var input = document.getElementById("filter");
+    if (!input) return;
+    var q = input.value.trim().toLowerCase();
+    document.querySelectorAll("table.metrics tbody tr[data-name]").forEach(function (tr) {
+      var match = !q || tr.getAttribute("data-name").toLowerCase().indexOf(q) !== -1;
+      tr.classList.toggle("hidden", !match);
+    });
+  }
+
+  function sortTable(table, by, desc) {
+    var tbody = table.tBodies[0];
+    var rows = Array.prototype.slice.call(tbody.querySelectorAll("tr[data-name]"));
+    rows.sort(function (a, b) {
+      var x, y;
+      if (by === "value") {
+        x = parseFloat(a.querySelector(".value").textContent);
+        y = parseFloat(b.querySelector(".value").textContent);
+      } else {
+        x = a.getAttribute("data-name");
+        y = b.getAttribute("data-name");
+      }
+      var r = x < y ? -1 : x > y ? 1 : 0;
+      return desc ? -r : r;
+    });
+    rows.forEach(function (tr) { tbody.appendChild(tr); });
+    table.querySelectorAll("th[data-sort]").forEach(function (th) {
+      th.classList.remove("asc", "desc");
+      if (th.getAttribute("data-sort") === by) th.classList.add(desc ? "desc" : "asc");
+    });
+  }
+
+  function currentSort(table) {
+    var th = table.querySelector("th.asc, th.desc");
+    return th ? { by: th.getAttribute("data-sort"), desc: th.classList.contains("desc") } : { by: "name", desc: false };
+  }
+
+  function addRow(table, m) {
+    var empty = table.querySelector("tr.empty");
+    if (empty) empty.remove();
+    var tr = document.createElement("tr");
+    tr.setAttribute("data-name", m.id);
+    var a = document.createElement("a");
+    a.href = "/metric/" + encodeURIComponent(m.type) + "/" + encodeURIComponent(m.id);
+    a.textContent = m.id;
+    var name = document.createElement("td"); name.className = "name"; name.appendChild(a);
+    var value = document.createElement("td"); value.className = "value";
+    var spark = document.createElement("td"); spark.className = "spark";
+    tr.appendChild(name); tr.appendChild(value); tr.appendChild(spark);
+    table.tBodies[0].appendChild(tr);
+    return tr;
+  }
+
+  function updateIndex(metrics) {
+    var tables = { gauge: document.getElementById("gauges"), counter: document.getElementById("counters") };
+    var added = { gauge: false, counter: false };
+    metrics.forEach(function (m) {
+      var table = tables[m.type];
+      if (!table) return;
+      var tr = table.querySelector('tr[data-name="' + CSS.escape(m.id) + '"]');
+      if (!tr) { tr = addRow(table, m); added[m.type] = true; }
+      var cell = tr.querySelector(".value");
+      if (cell.textContent !== m.value) {
+        cell.textContent = m.value;
+        tr.classList.add("updated");
+        setTimeout(function () { tr.classList.remove("updated"); }, 800);
+      }
+      drawSpark(tr.querySelector(".spark"), remember(m.type, m.id, parseFloat(m.value)));
+    });
+    Object.keys(tables).forEach(function (t) {
+      if (added[t] && tables[t]) { var s = currentSort(tables[t]); sortTable(tables[t], s.by, s.desc); }
+    });
+    applyFilter();
+  }
+
+  // ---- страница метрики ----
+
+  function updateMetric(metrics) {
+    var el = document.getElementById("metric");
+    var name = el.getAttribute("data-name"), type = el.getAttribute("data-type");
+    metrics.forEach(function (m) {
+      if (m.id !== name || m.type !== type) return;
+      el.querySelector(".value").textContent = m.value;
+      drawSpark(el.querySelector(".spark"), remember(type, name, parseFloat(m.value)));
+    });
+  }
+
+  function poll(update) {
+    fetch("/api/metrics", { headers: { "Accept": "application/json" } })
+      .then(function (r) { return r.ok ? r.json() : []; })
+      .then(update)
+      .catch(function () { /* сервер недоступен — попробуем в следующий раз */ });
+  }
+
+  function start(update) {
+    poll(update);
+    setInterval(function () { poll(update); }, refresh * 1000);
+  }
+
+  if (document.getElementById("metric")) {
+    start(updateMetric);
+    return;
+  }
+
+  var filter = document.getElementById("filter");
+  if (filter) filter.addEventListener("input", applyFilter);
+  document.querySelectorAll("table.metrics").forEach(function (table) {
+    table.querySelectorAll("th[data-sort]").forEach(function (th) {
+      th.addEventListener("click", function () {
+        var s = currentSort(table);
+        var by = th.getAttribute("data-sort");
+        sortTable(table, by, s.by === by ? !s.desc : false);
+      });
+    });
+  });
+  start(updateIndex);
+})();
@@ -1,6 +1,17 @@
 // Package dto содержит объекты передачи данных (Data Transfer Objects) для метрик.
 package dto
 
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+)
+
+// ErrInvalidMetric возвращается Validate для метрики с неизвестным типом
+// или без значения, соответствующего типу.
+var ErrInvalidMetric = errors.New("invalid metric")
+
 // Metrics представляет структуру данных для передачи метрики между клиентом и сервером.
 // Поддерживает два типа метрик: gauge (вещественные значения) и counter (целочисленные счетчики).
 //
@@ -25,3 +36,26 @@ type Metrics struct {
 	// Value содержит значение для gauge метрик (вещественное число)
 	Value *float64 `json:"value,omitempty"`
 }
+
+// Validate проверяет, что тип метрики известен и для него задано значение
+// (Value для gauge, Delta для counter).
+func (m Metrics) Validate() error {
+	switch {
+	case m.MType == consts.MetricTypeGauge && m.Value != nil:
+	case m.MType == consts.MetricTypeCounter && m.Delta != nil:
+	default:
+		return fmt.Errorf("%w: %s/%s", ErrInvalidMetric, m.MType, m.ID)
+	}
+	return nil
+}
+
+// ValidateBatch проверяет все метрики батча и возвращает ошибку первой некорректной.
+// Хранилища вызывают её до применения, чтобы батч либо применялся целиком, либо не применялся.
+func ValidateBatch(items []Metrics) error {
+	for _, m := range items {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
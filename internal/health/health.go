@@ -0,0 +1,140 @@
+// Package health — проверки живости и готовности сервера.
+//
+// Checker выполняет зарегистрированные проверки параллельно, каждую со своим
+// таймаутом, и собирает Report с результатом по каждой проверке. Готовность —
+// это все проверки успешны; живость (GET /healthz) проверок не требует.
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Статусы проверки и отчёта.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// DefaultTimeout — сколько ждать одну проверку.
+const DefaultTimeout = 2 * time.Second
+
+// Check — одна проверка; nil означает, что компонент исправен.
+type Check func(ctx context.Context) error
+
+// CheckResult — результат одной проверки.
+type CheckResult struct {
+	Status     string  `json:"status"`          // ok | fail
+	Error      string  `json:"error,omitempty"` // причина отказа
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// Report — сводный результат всех проверок.
+type Report struct {
+	Status string                 `json:"status"` // ok, если все проверки успешны
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// OK сообщает, что все проверки успешны.
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Checker хранит именованные проверки готовности.
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// New создаёт Checker; timeout <= 0 означает DefaultTimeout.
+func New(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{timeout: timeout, checks: make(map[string]Check)}
+}
+
+// Register добавляет проверку name (повторная регистрация заменяет прежнюю).
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Names возвращает имена зарегистрированных проверок по алфавиту.
+func (c *Checker) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run выполняет все проверки параллельно и ждёт их завершения.
+// Проверка, не уложившаяся в таймаут, считается проваленной.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	rep := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := c.run(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			rep.Checks[name] = res
+			if res.Status != StatusOK {
+				rep.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+	return rep
+}
+
+// run выполняет одну проверку; зависшая проверка не задерживает ответ дольше таймаута.
+func (c *Checker) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := CheckResult{Status: StatusOK, DurationMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status, res.Error = StatusFail, err.Error()
+	}
+	return res
+}
+
+// BuildInfo — сведения о сборке для GET /version (задаются через -ldflags -X).
+type BuildInfo struct {
+	Version string `json:"version"`
+	Date    string `json:"date"`
+	Commit  string `json:"commit"`
+}
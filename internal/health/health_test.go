@@ -0,0 +1,44 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_Run(t *testing.T) {
+	c := New(50 * time.Millisecond)
+	assert.True(t, c.Run(context.Background()).OK(), "no checks — ready")
+
+	c.Register("storage", func(context.Context) error { return nil })
+	rep := c.Run(context.Background())
+	assert.True(t, rep.OK())
+	assert.Equal(t, StatusOK, rep.Checks["storage"].Status)
+
+	c.Register("audit_url", func(context.Context) error { return errors.New("connection refused") })
+	rep = c.Run(context.Background())
+	assert.False(t, rep.OK())
+	assert.Equal(t, StatusOK, rep.Checks["storage"].Status)
+	assert.Equal(t, CheckResult{Status: StatusFail, Error: "connection refused", DurationMs: rep.Checks["audit_url"].DurationMs},
+		rep.Checks["audit_url"])
+	assert.Equal(t, []string{"audit_url", "storage"}, c.Names())
+}
+
+func TestChecker_RunTimesOutHangingCheck(t *testing.T) {
+	c := New(20 * time.Millisecond)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	// проверка игнорирует ctx и висит — отчёт всё равно приходит вовремя
+	c.Register("stuck", func(context.Context) error { <-release; return nil })
+
+	start := time.Now()
+	rep := c.Run(context.Background())
+	assert.Less(t, time.Since(start), time.Second)
+	require.Contains(t, rep.Checks, "stuck")
+	assert.Equal(t, StatusFail, rep.Checks["stuck"].Status)
+	assert.Contains(t, rep.Checks["stuck"].Error, context.DeadlineExceeded.Error())
+}
@@ -3,10 +3,16 @@ package interfaces
 
 import (
 	"context"
+	"errors"
 
 	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
 )
 
+// ErrUnavailable — хранилище временно недоступно (нет соединения, истёк таймаут).
+// Реализации оборачивают им такие ошибки, чтобы вызывающий код мог отличить
+// сбой инфраструктуры (503) от прочих ошибок чтения и записи (500).
+var ErrUnavailable = errors.New("storage unavailable")
+
 // Store определяет интерфейс хранилища метрик.
 // Реализации могут использовать различные backend'ы: память, файловую систему, базу данных.
 //
@@ -32,15 +38,43 @@ type Store interface {
 
 	// GetGauge возвращает значение gauge метрики.
 	// Второй параметр (bool) указывает, существует ли метрика.
-	GetGauge(ctx context.Context, metricName string) (float64, bool)
+	// Ошибка означает, что прочитать метрику не удалось; отсутствие метрики ошибкой не считается.
+	GetGauge(ctx context.Context, metricName string) (float64, bool, error)
 
 	// GetCounter возвращает значение counter метрики.
 	// Второй параметр (bool) указывает, существует ли метрика.
-	GetCounter(ctx context.Context, metricName string) (int64, bool)
+	// Ошибка означает, что прочитать метрику не удалось; отсутствие метрики ошибкой не считается.
+	GetCounter(ctx context.Context, metricName string) (int64, bool, error)
 
 	// GetAllGauges возвращает все gauge метрики в виде map[имя]значение.
-	GetAllGauges(ctx context.Context) map[string]float64
+	GetAllGauges(ctx context.Context) (map[string]float64, error)
 
 	// GetAllCounters возвращает все counter метрики в виде map[имя]значение.
-	GetAllCounters(ctx context.Context) map[string]int64
+	GetAllCounters(ctx context.Context) (map[string]int64, error)
+}
+
+// Snapshotter — необязательное расширение Store: согласованный снимок всех метрик.
+// В отличие от пары GetAllGauges/GetAllCounters, gauge и counter читаются
+// в одной точке времени, даже при параллельной записи.
+type Snapshotter interface {
+	Snapshot(ctx context.Context) (gauges map[string]float64, counters map[string]int64, err error)
+}
+
+// Replacer — необязательное расширение Store: атомарная замена всего содержимого хранилища.
+type Replacer interface {
+	Replace(ctx context.Context, gauges map[string]float64, counters map[string]int64) error
+}
+
+// Merger — необязательное расширение Store: атомарное слияние снимка с хранилищем.
+// Gauge перезаписываются, counter устанавливаются в абсолютные значения counters
+// (а не увеличиваются); метрики, которых нет в снимке, не меняются.
+type Merger interface {
+	Merge(ctx context.Context, gauges map[string]float64, counters map[string]int64) error
+}
+
+// Compactor — необязательное расширение Store для хранилищ с журналом.
+// Compact снимает согласованный снимок, передаёт его в save и,
+// если сохранение прошло успешно, отбрасывает вошедшие в снимок записи журнала.
+type Compactor interface {
+	Compact(ctx context.Context, save func(items []dto.Metrics) error) error
 }
@@ -0,0 +1,137 @@
+// Package leader — выбор лидера среди реплик сервера через advisory lock PostgreSQL.
+//
+// Лидер — реплика, удерживающая сессионный pg_advisory_lock на выделенном
+// соединении. Singleton-задачи (бэкап в файл, вычисление алертов), зарегистрированные
+// через Go, работают только на лидере: при потере соединения их контекст отменяется,
+// и блокировку может взять другая реплика. Если лидер упал, PostgreSQL снимает
+// блокировку вместе с его сессией.
+package leader
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
+)
+
+// DefaultKey — ключ advisory lock лидерства (отличается от ключа миграций).
+const DefaultKey int64 = 0x6c6561646572 // "leader"
+
+// defaultInterval — период попыток захвата и проверки удерживаемого соединения.
+const defaultInterval = 2 * time.Second
+
+type job struct {
+	name string
+	fn   func(ctx context.Context)
+}
+
+// Elector борется за лидерство и запускает singleton-задачи, пока лидирует.
+type Elector struct {
+	pool     *pgxpool.Pool
+	key      int64
+	interval time.Duration
+
+	leader atomic.Bool
+
+	mu   sync.Mutex
+	jobs []job
+}
+
+// New создаёт Elector для пула pool и ключа блокировки key.
+func New(pool *pgxpool.Pool, key int64) *Elector {
+	return &Elector{pool: pool, key: key, interval: defaultInterval}
+}
+
+// IsLeader сообщает, лидирует ли эта реплика сейчас.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Go регистрирует singleton-задачу. fn запускается при каждом получении
+// лидерства и должна вернуться после отмены переданного ей ctx.
+// Регистрировать задачи нужно до Run.
+func (e *Elector) Go(name string, fn func(ctx context.Context)) {
+	e.mu.Lock()
+	e.jobs = append(e.jobs, job{name: name, fn: fn})
+	e.mu.Unlock()
+}
+
+// Run борется за лидерство до отмены ctx.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		e.campaign(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// campaign делает одну попытку захватить блокировку; если удалось — лидирует,
+// пока живо соединение и не отменён ctx.
+func (e *Elector) campaign(ctx context.Context) {
+	conn, err := e.pool.Acquire(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1);`, e.key).Scan(&locked); err != nil || !locked {
+		return
+	}
+	defer func() {
+		// на живом соединении снимаем блокировку явно; на оборванном её уже сняла БД
+		_, _ = conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1);`, e.key)
+	}()
+
+	logger.GetLogger().Info("Leadership acquired")
+	e.lead(ctx, func(ctx context.Context) error { return conn.Ping(ctx) })
+	logger.GetLogger().Info("Leadership released")
+}
+
+// lead запускает задачи и ждёт, пока проверка alive не упадёт или не отменят ctx.
+func (e *Elector) lead(ctx context.Context, alive func(ctx context.Context) error) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	e.mu.Lock()
+	jobs := append([]job(nil), e.jobs...)
+	e.mu.Unlock()
+
+	e.leader.Store(true)
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			j.fn(leadCtx)
+		}()
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for leadCtx.Err() == nil {
+		select {
+		case <-ticker.C:
+			if err := alive(leadCtx); err != nil && leadCtx.Err() == nil {
+				logger.GetLogger().Warn("Leader connection lost", zap.Error(err))
+				cancel()
+			}
+		case <-leadCtx.Done():
+		}
+	}
+
+	// задачи должны остановиться до того, как лидерство возьмёт другая реплика
+	e.leader.Store(false)
+	wg.Wait()
+}
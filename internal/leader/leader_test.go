@@ -0,0 +1,81 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/postgres"
+)
+
+func TestLead_StopsJobsWhenConnectionLost(t *testing.T) {
+	e := &Elector{interval: 10 * time.Millisecond}
+	var running atomic.Int32
+	stopped := make(chan struct{})
+	e.Go("job", func(ctx context.Context) {
+		running.Add(1)
+		<-ctx.Done()
+		running.Add(-1)
+		close(stopped)
+	})
+
+	var pings atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.lead(context.Background(), func(context.Context) error {
+			if pings.Add(1) > 3 {
+				return errors.New("connection reset")
+			}
+			return nil
+		})
+	}()
+
+	require.Eventually(t, e.IsLeader, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return running.Load() == 1 }, time.Second, time.Millisecond)
+
+	<-done
+	<-stopped
+	assert.False(t, e.IsLeader())
+	assert.Equal(t, int32(0), running.Load())
+}
+
+// TestElector_SingleLeader запускается только при заданном TEST_DATABASE_DSN.
+func TestElector_SingleLeader(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var electors []*Elector
+	for i := 0; i < 2; i++ {
+		pool, err := postgres.Open(dsn)
+		require.NoError(t, err)
+		t.Cleanup(pool.Close)
+		e := New(pool, DefaultKey+1) // отдельный ключ, чтобы не мешать живым серверам
+		e.interval = 20 * time.Millisecond
+		electors = append(electors, e)
+		go e.Run(ctx)
+	}
+
+	leaders := func() int {
+		n := 0
+		for _, e := range electors {
+			if e.IsLeader() {
+				n++
+			}
+		}
+		return n
+	}
+	require.Eventually(t, func() bool { return leaders() == 1 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, leaders())
+}
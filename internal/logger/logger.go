@@ -2,16 +2,42 @@ package logger
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
+)
+
+// Форматы вывода логов.
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
 )
 
+// Config — настройки логгера агента и сервера.
+type Config struct {
+	Level    string // debug | info | warn | error
+	Format   string // json | console
+	Sampling bool   // сэмплировать повторяющиеся сообщения (первые 100 в секунду, дальше каждое 100-е)
+	Body     bool   // логировать тела HTTP-запросов (только при Level=debug)
+}
+
 var (
 	loggerInstance *zap.Logger
+	logBody        bool
 	once           sync.Once
 	initErr        error
 	nopLogger      = zap.NewNop()
@@ -38,21 +64,61 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 }
 
-// Init пытается сконфигурировать production-логгер; при ошибке тихо падаем на no-op,
-// чтобы не сносить тесты. Safe для многократных вызовов.
-func Init() error {
+// Flush пробрасывает http.Flusher, чтобы работали потоковые ответы (SSE).
+func (r *loggingResponseWriter) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Init конфигурирует логгер по cfg: уровень, формат, сэмплирование и маскирование
+// секретов (см. redactCore). Стандартный log перенаправляется в тот же логгер.
+// При ошибке тихо падаем на no-op, чтобы не сносить тесты. Safe для многократных
+// вызовов: действует только первый.
+func Init(cfg Config) error {
 	once.Do(func() {
-		l, err := zap.NewProduction()
+		l, err := build(cfg)
 		if err != nil {
 			// fallback, чтобы не было паники в тех местах, где GetLogger() уже используется
 			l = nopLogger
+		} else {
+			zap.RedirectStdLog(l)
 		}
 		loggerInstance = l
+		logBody = cfg.Body
 		initErr = err
 	})
 	return initErr
 }
 
+func build(cfg Config) (*zap.Logger, error) {
+	zc := zap.NewProductionConfig()
+
+	level := cfg.Level
+	if level == "" {
+		level = "info"
+	}
+	lvl, err := zap.ParseAtomicLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("logger: %w", err)
+	}
+	zc.Level = lvl
+
+	switch cfg.Format {
+	case "", FormatJSON:
+	case FormatConsole:
+		zc.Encoding = FormatConsole
+		zc.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("logger: unknown format %q (want %s | %s)", cfg.Format, FormatJSON, FormatConsole)
+	}
+	if !cfg.Sampling {
+		zc.Sampling = nil
+	}
+
+	return zc.Build(zap.WrapCore(func(c zapcore.Core) zapcore.Core { return redactCore{c} }))
+}
+
 // GetLogger всегда возвращает валидный *zap.Logger.
 // Если Init() не вызывали — вернёт no-op и тесты не упадут.
 func GetLogger() *zap.Logger {
@@ -62,15 +128,82 @@ func GetLogger() *zap.Logger {
 	return loggerInstance
 }
 
-// ---- NEW: глобальный middleware-логгер ----
-// Он логирует запросы даже если следующий middleware (например, HashValidation) вернёт 400
+type (
+	loggerKey    struct{}
+	requestIDKey struct{}
+)
+
+// FromContext возвращает логгер запроса (с полем request_id, см. WithRequestID),
+// а вне запроса — общий логгер.
+func FromContext(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return l
+	}
+	return GetLogger()
+}
+
+// WithRequestID кладёт в ctx идентификатор запроса и логгер с полем request_id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return context.WithValue(ctx, loggerKey{}, GetLogger().With(zap.String("request_id", id)))
+}
+
+// RequestID возвращает идентификатор запроса из ctx ("" вне запроса).
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID — случайный идентификатор запроса для корреляции строк лога.
+func NewRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// maxRequestIDLen ограничивает X-Request-ID от клиента.
+const maxRequestIDLen = 128
+
+// validRequestID — X-Request-ID от клиента можно писать в логи и аудит как есть:
+// непустой, не длиннее maxRequestIDLen, из букв, цифр и символов "-_.:".
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware — глобальный логгер запросов. Он логирует запросы даже если
+// следующий middleware (например, HashValidation) вернёт 400. Каждый запрос
+// получает request_id: из заголовка X-Request-ID клиента (если он корректен)
+// или новый. Он возвращается в ответе тем же заголовком, а логгер с ним
+// доступен обработчикам через FromContext.
+// Тела запросов пишутся только при Config.Body и уровне debug.
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		id := r.Header.Get(consts.HeaderRequestID)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(consts.HeaderRequestID, id)
+		r = r.WithContext(WithRequestID(r.Context(), id))
+		// связываем трассу запроса (если она есть) с его request_id
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("request_id", id))
+		l := FromContext(r.Context())
+
 		// читаем тело (как есть после предыдущих middleware) и возвращаем в r.Body
 		var raw []byte
-		if r.Body != nil {
+		if logBody && r.Body != nil && l.Core().Enabled(zap.DebugLevel) {
 			b, err := io.ReadAll(r.Body)
 			if err == nil {
 				raw = b
@@ -81,82 +214,41 @@ func Middleware(next http.Handler) http.Handler {
 		rd := &responseData{}
 		lw := &loggingResponseWriter{ResponseWriter: w, responseData: rd}
 		next.ServeHTTP(lw, r)
+		selfmetrics.Observe(selfmetrics.Name("http", routeName(r)), time.Since(start))
 
-		// безопасно укоротим тело в лог (чтобы не засорять)
-		const maxBody = 512
-		bodyForLog := raw
-		if len(bodyForLog) > maxBody {
-			bodyForLog = bodyForLog[:maxBody]
-		}
-
-		GetLogger().Info("HTTP request",
+		l.Info("HTTP request",
 			zap.String("method", r.Method),
-			zap.String("url", r.URL.String()),
 			zap.String("path", r.URL.Path),
-			zap.String("host", r.Host),
+			zap.String("route", routeName(r)),
 			zap.String("remote", r.RemoteAddr),
 			zap.String("userAgent", r.UserAgent()),
-			zap.String("Content-Type", r.Header.Get("Content-Type")),
 			zap.String("Content-Encoding", r.Header.Get("Content-Encoding")),
-			zap.String("Accept-Encoding", r.Header.Get("Accept-Encoding")),
-			zap.String("SHA256", r.Header.Get("HashSHA256")),
+			zap.Bool("signed", r.Header.Get("HashSHA256") != ""),
 			zap.Int64("Content-Length", r.ContentLength),
-			zap.Int("body_bytes", len(raw)),
-			zap.String("body", string(bodyForLog)),
 			zap.Int("status", rd.status),
 			zap.Int("size", rd.size),
 			zap.Duration("duration", time.Since(start)),
 		)
-	})
-}
 
-// Оставляем ваш обёрточный логгер — но он не нужен, если используете Middleware глобально.
-// Можно убрать после проверки.
-func HandlerLog(h http.HandlerFunc) http.HandlerFunc {
-	logFn := func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		var requestBody []byte
-		if r.Body != nil {
-			bodyBytes, err := io.ReadAll(r.Body)
-			if err != nil {
-				return
+		if raw != nil {
+			// безопасно укоротим тело в лог (чтобы не засорять)
+			const maxBody = 512
+			if len(raw) > maxBody {
+				raw = raw[:maxBody]
 			}
-			requestBody = bodyBytes
-			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-		}
-
-		responseData := &responseData{
-			status: 0,
-			size:   0,
+			l.Debug("HTTP request body", zap.String("body", string(raw)))
 		}
-		lw := loggingResponseWriter{
-			ResponseWriter: w,
-			responseData:   responseData,
-		}
-		h.ServeHTTP(&lw, r)
-
-		duration := time.Since(start)
+	})
+}
 
-		const maxBody = 512
-		bodyForLog := requestBody
-		if len(bodyForLog) > maxBody {
-			bodyForLog = bodyForLog[:maxBody]
+// routeName — метод и шаблон маршрута chi ("POST /update/{metricType}/..."),
+// чтобы запросы к одному маршруту попадали в одну self-метрику.
+// Для запросов, не нашедших маршрут, — "unmatched".
+func routeName(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if p := rctx.RoutePattern(); p != "" {
+			return r.Method + " " + p
 		}
-
-		GetLogger().Info("HTTP request",
-			zap.String("SHA256", r.Header.Get("HashSHA256")),
-			zap.String("method", r.Method),
-			zap.String("url", r.URL.String()),
-			zap.String("path", r.URL.Path),
-			zap.String("Content-Type", r.Header.Get("Content-Type")),
-			zap.String("Content-Encoding", r.Header.Get("Content-Encoding")),
-			zap.String("Accept-Encoding", r.Header.Get("Accept-Encoding")),
-			zap.String("body", string(bodyForLog)),
-			zap.Int("status", responseData.status),
-			zap.Int("size", responseData.size),
-			zap.Duration("duration", duration),
-		)
 	}
-	return logFn
+	return "unmatched"
 }
@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MetricsChangedChannel — канал, в который триггеры таблиц gauge и counter
+// отправляют "<таблица>:<id>" изменённой строки, а при TRUNCATE — только
+// имя таблицы (см. миграцию 000003 и EnableNotify).
+const MetricsChangedChannel = "metrics_changed"
+
+// Триггеры уведомлений ставятся только по EnableNotify (-cache-notify):
+// без слушателей NOTIFY на каждую строку — лишняя работа для записи.
+const (
+	enableNotifySQL = `
+		DROP TRIGGER IF EXISTS gauge_changed ON gauge;
+		CREATE TRIGGER gauge_changed AFTER INSERT OR UPDATE OR DELETE ON gauge
+			FOR EACH ROW EXECUTE FUNCTION notify_metric_row_changed();
+		DROP TRIGGER IF EXISTS gauge_truncated ON gauge;
+		CREATE TRIGGER gauge_truncated AFTER TRUNCATE ON gauge
+			FOR EACH STATEMENT EXECUTE FUNCTION notify_metrics_changed();
+		DROP TRIGGER IF EXISTS counter_changed ON counter;
+		CREATE TRIGGER counter_changed AFTER INSERT OR UPDATE OR DELETE ON counter
+			FOR EACH ROW EXECUTE FUNCTION notify_metric_row_changed();
+		DROP TRIGGER IF EXISTS counter_truncated ON counter;
+		CREATE TRIGGER counter_truncated AFTER TRUNCATE ON counter
+			FOR EACH STATEMENT EXECUTE FUNCTION notify_metrics_changed();
+	`
+	disableNotifySQL = `
+		DROP TRIGGER IF EXISTS gauge_changed ON gauge;
+		DROP TRIGGER IF EXISTS gauge_truncated ON gauge;
+		DROP TRIGGER IF EXISTS counter_changed ON counter;
+		DROP TRIGGER IF EXISTS counter_truncated ON counter;
+	`
+)
+
+// EnableNotify ставит триггеры, которые шлют в MetricsChangedChannel
+// уведомление на каждую изменённую строку gauge и counter. Триггеры общие
+// для всех реплик и остаются в базе, пока их не снимет DisableNotify.
+// Выполняется под блокировкой миграций, поэтому реплики могут стартовать одновременно.
+func EnableNotify(ctx context.Context, pool *pgxpool.Pool) error {
+	return execLocked(ctx, pool, enableNotifySQL)
+}
+
+// DisableNotify снимает триггеры уведомлений (cmd/migrate notify-off).
+func DisableNotify(ctx context.Context, pool *pgxpool.Pool) error {
+	return execLocked(ctx, pool, disableNotifySQL)
+}
+
+// execLocked выполняет скрипт одной неявной транзакцией под блокировкой миграций.
+func execLocked(ctx context.Context, pool *pgxpool.Pool, script string) error {
+	return withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		if _, err := conn.Exec(ctx, script); err != nil {
+			return fmt.Errorf("notify triggers: %w", err)
+		}
+		return nil
+	})
+}
+
+// ownPIDs — backend PID соединений пулов этого процесса (см. Open).
+// Свои изменения кеш уже учёл при записи, поэтому уведомления от этих
+// соединений Listen пропускает.
+var ownPIDs sync.Map
+
+// own сообщает, что уведомление отправило соединение этого процесса.
+func own(pid uint32) bool {
+	_, ok := ownPIDs.Load(pid)
+	return ok
+}
+
+// listenRetry — пауза перед переподключением слушателя.
+const listenRetry = time.Second
+
+// Listen слушает канал channel на выделенном соединении из pool и вызывает
+// onNotify с payload каждого уведомления, пока не отменён ctx.
+// Уведомления от соединений этого же процесса пропускаются.
+// При обрыве соединения переподключается; пока соединения не было,
+// уведомления могли потеряться, поэтому после каждого (пере)подключения
+// вызывается onReconnect.
+func Listen(ctx context.Context, pool *pgxpool.Pool, channel string, onNotify func(payload string), onReconnect func()) {
+	for ctx.Err() == nil {
+		err := listenOnce(ctx, pool, channel, onNotify, onReconnect)
+		if err == nil || errors.Is(err, context.Canceled) {
+			return
+		}
+		select {
+		case <-time.After(listenRetry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func listenOnce(ctx context.Context, pool *pgxpool.Pool, channel string, onNotify func(string), onReconnect func()) error {
+	pooled, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// соединение в режиме LISTEN в пул не возвращаем
+	conn := pooled.Hijack()
+	pid := conn.PgConn().PID()
+	defer func() {
+		ownPIDs.Delete(pid)
+		conn.Close(context.Background())
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+	if onReconnect != nil {
+		onReconnect()
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if own(n.PID) {
+			continue
+		}
+		onNotify(n.Payload)
+	}
+}
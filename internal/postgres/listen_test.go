@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListenMetricID запускается только при заданном TEST_DATABASE_DSN.
+func TestListenMetricID(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	pool, err := Open(dsn)
+	require.NoError(t, err)
+	defer pool.Close()
+	_, err = MigrateUp(ctx, pool, 0)
+	require.NoError(t, err)
+	require.NoError(t, EnableNotify(ctx, pool))
+	defer func() { assert.NoError(t, DisableNotify(context.Background(), pool)) }()
+
+	got := make(chan string, 16)
+	listenCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	ready := make(chan struct{})
+	go Listen(listenCtx, pool, MetricsChangedChannel, func(p string) { got <- p }, func() { close(ready) })
+	<-ready
+
+	// своя запись (соединение пула) не приходит, чужая — с id метрики
+	_, err = pool.Exec(ctx, `INSERT INTO gauge (id, value) VALUES ('own', 1) ON CONFLICT (id) DO UPDATE SET value = 1;`)
+	require.NoError(t, err)
+	other, err := pgx.Connect(ctx, normalizeDSN(dsn))
+	require.NoError(t, err)
+	defer other.Close(context.Background())
+	_, err = other.Exec(ctx, `INSERT INTO gauge (id, value) VALUES ('other', 1) ON CONFLICT (id) DO UPDATE SET value = 1;`)
+	require.NoError(t, err)
+
+	select {
+	case p := <-got:
+		assert.Equal(t, "gauge:other", p)
+	case <-ctx.Done():
+		t.Fatal("no notification")
+	}
+}
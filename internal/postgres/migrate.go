@@ -0,0 +1,257 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Миграции схемы лежат в migrations/ как пары NNNNNN_name.up.sql / NNNNNN_name.down.sql
+// и встраиваются в бинарник. Применённые версии записываются в schema_migrations.
+// Изменяющие операции выполняются под advisory lock, поэтому несколько серверов,
+// стартующих одновременно, не применяют одну миграцию дважды.
+// MigrationStatus только читает: без блокировки и без DDL.
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockID — ключ pg_advisory_lock для миграций.
+const migrationLockID int64 = 0x6d6574726963 // "metric"
+
+// ErrNotInitialized возвращается MigrationStatus, если таблицы schema_migrations
+// ещё нет: ни одна миграция не применялась.
+var ErrNotInitialized = errors.New("migrations: schema_migrations does not exist")
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration — одна версионированная миграция.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState — миграция и время её применения (nil — не применена).
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations возвращает встроенные миграции, упорядоченные по версии.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migrations: unexpected file %q", e.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrations: bad version in %q: %w", e.Name(), err)
+		}
+		body, err := migrationsFS.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrations: version %d has two names: %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migrations: version %d has no up script", mig.Version)
+		}
+		out = append(out, *mig)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// MigrateUp применяет до steps ещё не применённых миграций (steps <= 0 — все).
+// Возвращает применённые версии.
+func MigrateUp(ctx context.Context, pool *pgxpool.Pool, steps int) ([]int64, error) {
+	var done []int64
+	err := withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		all, applied, err := loadState(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range all {
+			if steps > 0 && len(done) == steps {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err := apply(ctx, conn, m.Up, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`, m.Version, m.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDown откатывает steps последних применённых миграций (steps <= 0 — одну).
+// Возвращает откаченные версии.
+func MigrateDown(ctx context.Context, pool *pgxpool.Pool, steps int) ([]int64, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	var done []int64
+	err := withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		all, applied, err := loadState(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(all) - 1; i >= 0 && len(done) < steps; i-- {
+			m := all[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+			}
+			if err := apply(ctx, conn, m.Down, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1;`, m.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrationStatus возвращает все встроенные миграции с отметкой о применении.
+// Только читает базу: не берёт блокировку миграций и не создаёт schema_migrations.
+// Если таблицы нет, возвращает ErrNotInitialized.
+func MigrationStatus(ctx context.Context, pool *pgxpool.Pool) ([]MigrationState, error) {
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL;`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("migrations: check schema_migrations: %w", err)
+	}
+	if !exists {
+		return nil, ErrNotInitialized
+	}
+
+	all, applied, err := loadState(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]MigrationState, 0, len(all))
+	for _, m := range all {
+		st := MigrationState{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			st.AppliedAt = &at
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// withMigrationLock выполняет fn на выделенном соединении под pg_advisory_lock.
+// Блокировка сессионная, поэтому берётся и снимается на одном и том же соединении.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("migrations: acquire: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1);`, migrationLockID); err != nil {
+		return fmt.Errorf("migrations: lock: %w", err)
+	}
+	defer func() {
+		// снимаем блокировку даже при отменённом ctx запроса
+		_, _ = conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationLockID)
+	}()
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`); err != nil {
+		return fmt.Errorf("migrations: create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// querier — общее у пула и выделенного соединения.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// loadState читает встроенные миграции и уже применённые версии.
+func loadState(ctx context.Context, conn querier) ([]Migration, map[int64]time.Time, error) {
+	all, err := Migrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations;`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("migrations: read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var v int64
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, nil, err
+		}
+		applied[v] = at
+	}
+	return all, applied, rows.Err()
+}
+
+// apply выполняет скрипт миграции и запись в schema_migrations в одной транзакции.
+func apply(ctx context.Context, conn *pgxpool.Conn, script string, record func(tx pgx.Tx) error) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
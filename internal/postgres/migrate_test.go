@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_EmbeddedAndOrdered(t *testing.T) {
+	all, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, all)
+
+	assert.Equal(t, int64(1), all[0].Version)
+	assert.Equal(t, "create_tables", all[0].Name)
+	for i, m := range all {
+		assert.NotEmpty(t, m.Up, "version %d", m.Version)
+		assert.NotEmpty(t, m.Down, "version %d", m.Version)
+		if i > 0 {
+			assert.Greater(t, m.Version, all[i-1].Version)
+		}
+	}
+}
+
+// TestMigrateUpDown запускается только при заданном TEST_DATABASE_DSN
+// (схема в этой базе откатывается и накатывается заново).
+func TestMigrateUpDown(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	ctx := context.Background()
+	pool, err := Open(dsn)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	all, err := Migrations()
+	require.NoError(t, err)
+
+	_, err = MigrateUp(ctx, pool, 0)
+	require.NoError(t, err)
+	// повторный up — ничего не делает
+	done, err := MigrateUp(ctx, pool, 0)
+	require.NoError(t, err)
+	assert.Empty(t, done)
+
+	done, err = MigrateDown(ctx, pool, len(all))
+	require.NoError(t, err)
+	assert.Len(t, done, len(all))
+
+	states, err := MigrationStatus(ctx, pool)
+	require.NoError(t, err)
+	for _, st := range states {
+		assert.Nil(t, st.AppliedAt)
+	}
+
+	done, err = MigrateUp(ctx, pool, 0)
+	require.NoError(t, err)
+	assert.Len(t, done, len(all))
+}
@@ -1,9 +1,9 @@
-CREATE TABLE gauge (
+CREATE TABLE IF NOT EXISTS gauge (
                        id VARCHAR(256) PRIMARY KEY,
                        value DOUBLE PRECISION NOT NULL
 );
 
-CREATE TABLE counter (
+CREATE TABLE IF NOT EXISTS counter (
                          id VARCHAR(256) PRIMARY KEY,
                          value BIGINT NOT NULL
-);
\ No newline at end of file
+);
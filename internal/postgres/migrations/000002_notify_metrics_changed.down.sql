@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS gauge_changed ON gauge;
+
+DROP TRIGGER IF EXISTS counter_changed ON counter;
+
+DROP FUNCTION IF EXISTS notify_metrics_changed();
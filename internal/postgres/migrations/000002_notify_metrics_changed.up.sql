@@ -0,0 +1,18 @@
+-- Уведомление в канал metrics_changed после каждого изменения таблиц метрик.
+-- Триггер уровня оператора: один NOTIFY на запрос, payload — имя таблицы (gauge/counter).
+CREATE OR REPLACE FUNCTION notify_metrics_changed() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('metrics_changed', TG_TABLE_NAME);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS gauge_changed ON gauge;
+CREATE TRIGGER gauge_changed
+    AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON gauge
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_metrics_changed();
+
+DROP TRIGGER IF EXISTS counter_changed ON counter;
+CREATE TRIGGER counter_changed
+    AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON counter
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_metrics_changed();
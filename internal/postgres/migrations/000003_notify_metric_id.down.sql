@@ -0,0 +1,14 @@
+DROP TRIGGER IF EXISTS gauge_truncated ON gauge;
+DROP TRIGGER IF EXISTS counter_truncated ON counter;
+
+DROP TRIGGER IF EXISTS gauge_changed ON gauge;
+CREATE TRIGGER gauge_changed
+    AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON gauge
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_metrics_changed();
+
+DROP TRIGGER IF EXISTS counter_changed ON counter;
+CREATE TRIGGER counter_changed
+    AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON counter
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_metrics_changed();
+
+DROP FUNCTION IF EXISTS notify_metric_row_changed();
@@ -0,0 +1,18 @@
+-- Уведомления metrics_changed нужны только репликам с -cache-notify: триггеры
+-- ставит postgres.EnableNotify, а миграция их снимает, чтобы без кеша записи
+-- не платили за NOTIFY.
+-- Payload строкового триггера — "<таблица>:<id>" изменённой строки,
+-- для TRUNCATE (notify_metrics_changed) — только имя таблицы.
+DROP TRIGGER IF EXISTS gauge_changed ON gauge;
+DROP TRIGGER IF EXISTS counter_changed ON counter;
+
+CREATE OR REPLACE FUNCTION notify_metric_row_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('metrics_changed', TG_TABLE_NAME || ':' || OLD.id);
+    ELSE
+        PERFORM pg_notify('metrics_changed', TG_TABLE_NAME || ':' || NEW.id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
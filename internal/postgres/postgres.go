@@ -2,24 +2,58 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/tracing"
 )
 
 var Pool *pgxpool.Pool
 
-// Connect открывает пул соединений и инициализирует таблицы.
+// Connect открывает пул соединений и применяет миграции схемы (см. MigrateUp).
 // Возвращает ошибку вместо log.Fatalf — можно мягко откатиться на memstorage.
 func Connect(dsn string) (*pgxpool.Pool, error) {
+	pool, err := Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Миграции могут ждать advisory lock, пока их применяет соседний сервер
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := MigrateUp(ctx, pool, 0); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	Pool = pool
+	return Pool, nil
+}
+
+// Open открывает пул соединений и проверяет его, не трогая схему
+// и не выставляя глобальный Pool (используется cmd/migrate).
+func Open(dsn string) (*pgxpool.Pool, error) {
 	dsn = normalizeDSN(dsn)
 
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("parse dsn: %w", err)
 	}
+	// спаны на каждый SQL-запрос внутри трассы запроса (см. tracing.QueryTracer)
+	cfg.ConnConfig.Tracer = tracing.QueryTracer{}
+	// свои соединения запоминаем, чтобы Listen пропускал их уведомления
+	cfg.AfterConnect = func(_ context.Context, conn *pgx.Conn) error {
+		ownPIDs.Store(conn.PgConn().PID(), struct{}{})
+		return nil
+	}
+	cfg.BeforeClose = func(conn *pgx.Conn) {
+		ownPIDs.Delete(conn.PgConn().PID())
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -34,46 +68,18 @@ func Connect(dsn string) (*pgxpool.Pool, error) {
 		pool.Close()
 		return nil, fmt.Errorf("ping: %w", err)
 	}
-
-	Pool = pool
-
-	// Инициализация схемы
-	if err := initDB(ctx); err != nil {
-		pool.Close()
-		Pool = nil
-		return nil, err
-	}
-
-	return Pool, nil
+	return pool, nil
 }
 
-// initDB создаёт таблицы, если их нет.
-func initDB(ctx context.Context) error {
-	if Pool == nil {
-		return fmt.Errorf("pool is nil")
-	}
-
-	_, err := Pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS gauge (
-			id    varchar(256) PRIMARY KEY,
-			value double precision NOT NULL
-		);
-	`)
-	if err != nil {
-		return fmt.Errorf("create table gauge: %w", err)
-	}
+// ErrNotConfigured возвращается Ping, если пул не открыт.
+var ErrNotConfigured = errors.New("postgres: database is not configured")
 
-	_, err = Pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS counter (
-			id    varchar(256) PRIMARY KEY,
-			value BIGINT NOT NULL
-		);
-	`)
-	if err != nil {
-		return fmt.Errorf("create table counter: %w", err)
+// Ping проверяет доступность БД через глобальный Pool.
+func Ping(ctx context.Context) error {
+	if Pool == nil {
+		return ErrNotConfigured
 	}
-
-	return nil
+	return Pool.Ping(ctx)
 }
 
 // Close безопасно закрывает пул.
@@ -3,42 +3,89 @@ package router
 import (
 	"github.com/go-chi/chi/v5"
 
+	"github.com/SamSafonov2025/metrics-tpl/internal/agents"
+	"github.com/SamSafonov2025/metrics-tpl/internal/alerting"
+	"github.com/SamSafonov2025/metrics-tpl/internal/health"
+	"github.com/SamSafonov2025/metrics-tpl/internal/leader"
 	"github.com/SamSafonov2025/metrics-tpl/internal/service"
+	"github.com/SamSafonov2025/metrics-tpl/internal/stream"
+	"github.com/SamSafonov2025/metrics-tpl/internal/tracing"
 
 	"github.com/SamSafonov2025/metrics-tpl/cmd/server/handlers"
 	"github.com/SamSafonov2025/metrics-tpl/internal/audit"
 	"github.com/SamSafonov2025/metrics-tpl/internal/compressor"
 	"github.com/SamSafonov2025/metrics-tpl/internal/crypto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dashboard"
 	"github.com/SamSafonov2025/metrics-tpl/internal/logger"
 )
 
+// Deps — зависимости, из которых собирается роутер.
+// Необязательные поля (AuditPublisher, Alerts, Agents, Stream, Health, Leader) могут быть nil.
+type Deps struct {
+	Svc            service.MetricsService
+	Key            string
+	AuditPublisher *audit.AuditPublisher
+	Alerts         *alerting.Engine
+	Agents         *agents.Registry
+	Stream         *stream.Hub
+	Health         *health.Checker
+	Build          health.BuildInfo
+	Leader         *leader.Elector
+}
+
 // New строит chi.Router и регистрирует все маршруты приложения.
-func New(svc service.MetricsService, key string, auditPublisher *audit.AuditPublisher) *chi.Mux {
+func New(d Deps) *chi.Mux {
 	r := chi.NewRouter()
 
 	// порядок важен:
+	// 0) серверный спан трассы — накрывает все остальные middleware
+	r.Use(tracing.Middleware)
 	// 1) распаковка gzip (если есть)
 	gzipMW := compressor.NewGzipMiddleware()
 	r.Use(gzipMW.Handler)
 	// 2) Глобальный логгер — увидит и 400 от HashValidationMiddleware
 	r.Use(logger.Middleware)
 
-	h := handlers.NewHandler(svc, auditPublisher)
-	c := crypto.Crypto{Key: key}
+	h := handlers.NewHandler(d.Svc, d.AuditPublisher)
+	h.Alerts = d.Alerts
+	h.Agents = d.Agents
+	h.Stream = d.Stream
+	h.Health = d.Health
+	h.Build = d.Build
+	h.Leader = d.Leader
+	c := crypto.Crypto{Key: d.Key}
+
+	// Аудит стоит перед проверкой HMAC, чтобы видеть и отклонённые ею запросы
+	update := r.With(h.Audit, c.HashValidationMiddleware)
+	// Агенты представляются заголовками на каждом запросе с метриками
+	updates := update
+	if d.Agents != nil {
+		updates = updates.With(d.Agents.Middleware)
+	}
 
-	// Можно убрать HandlerLog(...) здесь, чтобы не было дублей.
-	// Я оставлю чистые хендлеры; если хотите оставить старые — просто верните logger.HandlerLog(...)
-	r.With(c.HashValidationMiddleware).Post("/update", h.UpdateHandlerJSON)
-	r.With(c.HashValidationMiddleware).Post("/update/", h.UpdateHandlerJSON)
-	r.With(c.HashValidationMiddleware).Post("/update/{metricType}/{metricName}/{metricValue}", h.UpdateHandler)
-	r.With(c.HashValidationMiddleware).Post("/updates", h.UpdateMetrics)
-	r.With(c.HashValidationMiddleware).Post("/updates/", h.UpdateMetrics)
+	update.Post("/update", h.UpdateHandlerJSON)
+	update.Post("/update/", h.UpdateHandlerJSON)
+	update.Post("/update/{metricType}/{metricName}/{metricValue}", h.UpdateHandler)
+	updates.Post("/updates", h.UpdateMetrics)
+	updates.Post("/updates/", h.UpdateMetrics)
 	r.With(c.HashValidationMiddleware).Post("/value", h.ValueHandlerJSON)
 	r.With(c.HashValidationMiddleware).Post("/value/", h.ValueHandlerJSON)
+	// replace стирает хранилище: импорт снимка аудируется, replace требует подписи
+	update.Post("/snapshot", h.ImportSnapshot)
 
 	r.Get("/", h.HomeHandler)
+	r.Get("/metric/{metricType}/{metricName}", h.MetricPageHandler)
+	r.Get("/api/metrics", h.MetricsListHandler)
+	r.Handle(dashboard.StaticPrefix+"*", dashboard.Static())
 	r.Get("/value/{metricType}/{metricName}", h.GetHandler)
 	r.Get("/ping", h.Ping)
+	r.Get("/healthz", h.HealthzHandler)
+	r.Get("/readyz", h.ReadyHandler)
+	r.Get("/version", h.VersionHandler)
+	r.Get("/alerts", h.AlertsHandler)
+	r.Get("/agents", h.AgentsHandler)
+	r.Get("/stream", h.StreamHandler)
+	r.Get("/snapshot", h.ExportSnapshot)
 
 	return r
 }
@@ -0,0 +1,205 @@
+// Package selfmetrics — самонаблюдение сервера.
+//
+// Middleware, хранилище, бэкап и аудит отмечают события в Registry (Add, Observe),
+// а Run периодически записывает накопленное в хранилище как обычные метрики
+// с префиксом Prefix — рядом с данными агентов:
+//   - счётчик name → counter Prefix+name (прирост с прошлой записи);
+//   - тайминг name → counter Prefix+name+".count" и gauge Prefix+name+".avg_ms",
+//     Prefix+name+".max_ms" (среднее и максимум за период записи).
+//
+// Пакетные функции Add и Observe пишут в общий Registry (см. Default),
+// чтобы не протаскивать его через все слои.
+//
+// Если несколько реплик сервера пишут в одну БД, каждая задаёт свой
+// идентификатор (SetReplica), и её метрики пишутся под Prefix+"<replica>.":
+// иначе тайминги и gauge реплик перезаписывали бы друг друга.
+package selfmetrics
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+)
+
+// Prefix — зарезервированный префикс имён self-метрик.
+const Prefix = "server."
+
+type timer struct {
+	count    int64
+	sum, max time.Duration
+}
+
+// Registry накапливает счётчики и тайминги между записями в хранилище.
+type Registry struct {
+	mu       sync.Mutex
+	prefix   string
+	counters map[string]int64
+	timers   map[string]*timer
+}
+
+// New создаёт пустой Registry.
+func New() *Registry {
+	return &Registry{prefix: Prefix, counters: make(map[string]int64), timers: make(map[string]*timer)}
+}
+
+// SetReplica задаёт идентификатор реплики: метрики пишутся под Prefix+replica+".".
+// replica — один сегмент имени без точек (см. Name).
+func (r *Registry) SetReplica(replica string) {
+	r.mu.Lock()
+	r.prefix = Prefix + replica + "."
+	r.mu.Unlock()
+}
+
+var std = New()
+
+// Default возвращает общий Registry пакета.
+func Default() *Registry {
+	return std
+}
+
+// Add увеличивает счётчик name общего Registry на delta.
+func Add(name string, delta int64) {
+	std.Add(name, delta)
+}
+
+// Observe добавляет длительность d к таймингу name общего Registry.
+func Observe(name string, d time.Duration) {
+	std.Observe(name, d)
+}
+
+// Add увеличивает счётчик name на delta.
+func (r *Registry) Add(name string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.counters[name] += delta
+	r.mu.Unlock()
+}
+
+// Observe добавляет длительность d к таймингу name.
+func (r *Registry) Observe(name string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.timers[name]
+	if !ok {
+		t = &timer{}
+		r.timers[name] = t
+	}
+	t.count++
+	t.sum += d
+	if d > t.max {
+		t.max = d
+	}
+}
+
+// Collect забирает накопленное с прошлого вызова в виде метрик, отсортированных по имени.
+func (r *Registry) Collect() []dto.Metrics {
+	prefix, counters, timers := r.take()
+	return toMetrics(prefix, counters, timers)
+}
+
+// Flush записывает накопленное в store одним батчем.
+// Если запись не удалась, приращения счётчиков возвращаются в Registry
+// и уйдут со следующей записью; тайминги за период теряются.
+func (r *Registry) Flush(ctx context.Context, store interfaces.Store) error {
+	prefix, counters, timers := r.take()
+	items := toMetrics(prefix, counters, timers)
+	if len(items) == 0 {
+		return nil
+	}
+	if err := store.SetMetrics(ctx, items); err != nil {
+		for name, v := range counters {
+			r.Add(name, v)
+		}
+		return err
+	}
+	return nil
+}
+
+// take забирает накопленное, оставляя Registry пустым.
+func (r *Registry) take() (string, map[string]int64, map[string]*timer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counters, timers := r.counters, r.timers
+	r.counters, r.timers = make(map[string]int64), make(map[string]*timer)
+	return r.prefix, counters, timers
+}
+
+func toMetrics(prefix string, counters map[string]int64, timers map[string]*timer) []dto.Metrics {
+	out := make([]dto.Metrics, 0, len(counters)+3*len(timers))
+	for name, v := range counters {
+		out = append(out, counter(prefix+name, v))
+	}
+	for name, t := range timers {
+		out = append(out,
+			counter(prefix+name+".count", t.count),
+			gauge(prefix+name+".avg_ms", ms(t.sum)/float64(t.count)),
+			gauge(prefix+name+".max_ms", ms(t.max)),
+		)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Run записывает накопленное в store каждые interval до отмены ctx.
+func (r *Registry) Run(ctx context.Context, store interfaces.Store, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Flush(ctx, store); err != nil {
+				log.Printf("selfmetrics: flush failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Name собирает имя метрики из частей, заменяя в них всё, кроме букв, цифр,
+// '-' и '_', на '_': Name("http", "POST /update/") == "http.post_update".
+func Name(parts ...string) string {
+	clean := make([]string, 0, len(parts))
+	for _, p := range parts {
+		var b strings.Builder
+		underscore := false
+		for _, c := range strings.ToLower(p) {
+			if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' {
+				b.WriteRune(c)
+				underscore = false
+			} else if !underscore && b.Len() > 0 {
+				b.WriteByte('_')
+				underscore = true
+			}
+		}
+		if s := strings.TrimSuffix(b.String(), "_"); s != "" {
+			clean = append(clean, s)
+		}
+	}
+	return strings.Join(clean, ".")
+}
+
+func counter(id string, v int64) dto.Metrics {
+	return dto.Metrics{ID: id, MType: consts.MetricTypeCounter, Delta: &v}
+}
+
+func gauge(id string, v float64) dto.Metrics {
+	return dto.Metrics{ID: id, MType: consts.MetricTypeGauge, Value: &v}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
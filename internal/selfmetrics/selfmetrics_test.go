@@ -0,0 +1,88 @@
+package selfmetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/memstorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+)
+
+func TestRegistry_FlushWritesPrefixedMetrics(t *testing.T) {
+	ctx := context.Background()
+	reg := New()
+	store := memstorage.New()
+
+	reg.Add("hmac.failures", 1)
+	reg.Add("hmac.failures", 2)
+	reg.Observe("backup", 10*time.Millisecond)
+	reg.Observe("backup", 30*time.Millisecond)
+	require.NoError(t, reg.Flush(ctx, store))
+
+	c, _, _ := store.GetCounter(ctx, "server.hmac.failures")
+	assert.Equal(t, int64(3), c)
+	c, _, _ = store.GetCounter(ctx, "server.backup.count")
+	assert.Equal(t, int64(2), c)
+	g, _, _ := store.GetGauge(ctx, "server.backup.avg_ms")
+	assert.Equal(t, 20.0, g)
+	g, _, _ = store.GetGauge(ctx, "server.backup.max_ms")
+	assert.Equal(t, 30.0, g)
+
+	// следующая запись несёт только прирост
+	reg.Add("hmac.failures", 1)
+	require.NoError(t, reg.Flush(ctx, store))
+	c, _, _ = store.GetCounter(ctx, "server.hmac.failures")
+	assert.Equal(t, int64(4), c)
+	assert.Empty(t, reg.Collect())
+}
+
+func TestRegistry_FlushFailureKeepsCounters(t *testing.T) {
+	ctx := context.Background()
+	reg := New()
+	reg.Add("audit.failures", 2)
+	reg.Observe("backup", time.Millisecond)
+
+	err := reg.Flush(ctx, storetest.Failing{Err: interfaces.ErrUnavailable})
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+
+	store := memstorage.New()
+	require.NoError(t, reg.Flush(ctx, store))
+	c, _, _ := store.GetCounter(ctx, "server.audit.failures")
+	assert.Equal(t, int64(2), c, "counter increments survive a failed flush")
+	_, ok, _ := store.GetCounter(ctx, "server.backup.count")
+	assert.False(t, ok, "timings of the failed period are dropped")
+
+	assert.NoError(t, New().Flush(ctx, storetest.Failing{Err: errors.New("unused")}), "nothing to flush")
+}
+
+func TestRegistry_SetReplica(t *testing.T) {
+	reg := New()
+	reg.SetReplica(Name("web-1.example"))
+	reg.Add("hmac.failures", 1)
+	reg.Observe("backup", time.Millisecond)
+
+	var ids []string
+	for _, m := range reg.Collect() {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []string{
+		"server.web-1_example.backup.avg_ms",
+		"server.web-1_example.backup.count",
+		"server.web-1_example.backup.max_ms",
+		"server.web-1_example.hmac.failures",
+	}, ids)
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "http.post_update_metrictype_metricname_metricvalue",
+		Name("http", "POST /update/{metricType}/{metricName}/{metricValue}"))
+	assert.Equal(t, "http.get", Name("http", "GET /"))
+	assert.Equal(t, "http.unmatched", Name("http", "unmatched"))
+	assert.Equal(t, "storage.set_gauge", Name("storage", "set_gauge"))
+}
@@ -4,10 +4,18 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/agents"
 	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
 	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
+	"github.com/SamSafonov2025/metrics-tpl/internal/snapshot"
+	"github.com/SamSafonov2025/metrics-tpl/internal/tracing"
 )
 
 // Стандартные ошибки сервиса метрик
@@ -22,8 +30,26 @@ var (
 	// ErrBadValue возвращается при некорректном значении метрики.
 	// Например, nil значение для gauge или counter.
 	ErrBadValue = errors.New("bad metric value")
+
+	// ErrReservedName возвращается при обновлении метрики с зарезервированным
+	// префиксом имени: self-метрики сервера и gauge доступности агентов пишет
+	// только сам сервер.
+	ErrReservedName = errors.New("metric name uses a reserved prefix")
 )
 
+// reservedPrefixes — префиксы имён, которые клиенты обновлять не могут.
+var reservedPrefixes = []string{selfmetrics.Prefix, agents.UpMetricPrefix}
+
+// checkName возвращает ErrReservedName для имени с зарезервированным префиксом.
+func checkName(id string) error {
+	for _, p := range reservedPrefixes {
+		if strings.HasPrefix(id, p) {
+			return ErrReservedName
+		}
+	}
+	return nil
+}
+
 // MetricsService определяет интерфейс сервиса для работы с метриками.
 // Предоставляет методы для обновления, получения и управления метриками.
 //
@@ -36,21 +62,34 @@ type MetricsService interface {
 
 	// List возвращает все gauge и counter метрики.
 	// Возвращает два map: первый для gauge, второй для counter метрик.
+	// Ошибка хранилища возвращается как есть; недоступность хранилища
+	// распознаётся через errors.Is(err, interfaces.ErrUnavailable).
 	List(ctx context.Context) (gauges map[string]float64, counters map[string]int64, err error)
 
 	// Update обновляет одну метрику.
 	// Для counter выполняет инкремент, для gauge устанавливает новое значение.
 	// Возвращает обновленную метрику с актуальным значением.
+	// Возвращает ErrReservedName для имён с префиксом server. или up.
 	Update(ctx context.Context, m dto.Metrics) (dto.Metrics, error)
 
 	// Get возвращает метрику по типу и имени.
 	// Возвращает ErrNotFound, если метрика не существует.
 	// Возвращает ErrInvalidType, если тип метрики некорректен.
+	// Прочие ошибки — ошибки хранилища (см. List).
 	Get(ctx context.Context, typ, id string) (dto.Metrics, error)
 
 	// UpdateBatch атомарно обновляет несколько метрик.
 	// Все метрики должны быть валидными, иначе операция отменяется целиком.
+	// Имя с зарезервированным префиксом отклоняет весь батч (ErrReservedName).
 	UpdateBatch(ctx context.Context, items []dto.Metrics) error
+
+	// Snapshot возвращает согласованный снимок всех метрик.
+	// У counter в поле Delta — абсолютное значение счётчика.
+	Snapshot(ctx context.Context) ([]dto.Metrics, error)
+
+	// Restore применяет снимок в режиме snapshot.ModeMerge или snapshot.ModeReplace.
+	// Зарезервированные имена разрешены: снимок содержит и self-метрики.
+	Restore(ctx context.Context, items []dto.Metrics, mode string) error
 }
 
 type metricsService struct {
@@ -82,13 +121,24 @@ func (s *metricsService) Ping(ctx context.Context) error {
 func (s *metricsService) List(ctx context.Context) (map[string]float64, map[string]int64, error) {
 	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
-	return s.repo.GetAllGauges(ctx), s.repo.GetAllCounters(ctx), nil
+	gauges, err := s.repo.GetAllGauges(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	counters, err := s.repo.GetAllCounters(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gauges, counters, nil
 }
 
 func (s *metricsService) Update(ctx context.Context, m dto.Metrics) (dto.Metrics, error) {
 	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
+	if err := checkName(m.ID); err != nil {
+		return m, err
+	}
 	switch m.MType {
 	case "gauge":
 		if m.Value == nil {
@@ -97,7 +147,11 @@ func (s *metricsService) Update(ctx context.Context, m dto.Metrics) (dto.Metrics
 		if err := s.repo.SetGauge(ctx, m.ID, *m.Value); err != nil {
 			return m, err
 		}
-		if v, ok := s.repo.GetGauge(ctx, m.ID); ok {
+		v, ok, err := s.repo.GetGauge(ctx, m.ID)
+		if err != nil {
+			return m, err
+		}
+		if ok {
 			m.Value = &v
 		}
 	case "counter":
@@ -107,7 +161,11 @@ func (s *metricsService) Update(ctx context.Context, m dto.Metrics) (dto.Metrics
 		if err := s.repo.IncrementCounter(ctx, m.ID, *m.Delta); err != nil {
 			return m, err
 		}
-		if v, ok := s.repo.GetCounter(ctx, m.ID); ok {
+		v, ok, err := s.repo.GetCounter(ctx, m.ID)
+		if err != nil {
+			return m, err
+		}
+		if ok {
 			m.Delta = &v
 		}
 	default:
@@ -122,12 +180,20 @@ func (s *metricsService) Get(ctx context.Context, typ, id string) (dto.Metrics,
 
 	switch typ {
 	case "gauge":
-		if v, ok := s.repo.GetGauge(ctx, id); ok {
+		v, ok, err := s.repo.GetGauge(ctx, id)
+		if err != nil {
+			return dto.Metrics{}, err
+		}
+		if ok {
 			return dto.Metrics{ID: id, MType: "gauge", Value: &v}, nil
 		}
 		return dto.Metrics{}, ErrNotFound
 	case "counter":
-		if v, ok := s.repo.GetCounter(ctx, id); ok {
+		v, ok, err := s.repo.GetCounter(ctx, id)
+		if err != nil {
+			return dto.Metrics{}, err
+		}
+		if ok {
 			return dto.Metrics{ID: id, MType: "counter", Delta: &v}, nil
 		}
 		return dto.Metrics{}, ErrNotFound
@@ -136,7 +202,11 @@ func (s *metricsService) Get(ctx context.Context, typ, id string) (dto.Metrics,
 	}
 }
 
-func (s *metricsService) UpdateBatch(ctx context.Context, items []dto.Metrics) error {
+func (s *metricsService) UpdateBatch(ctx context.Context, items []dto.Metrics) (err error) {
+	ctx, span := tracing.Start(ctx, "service.UpdateBatch",
+		trace.WithAttributes(attribute.Int("metrics.count", len(items))))
+	defer func() { tracing.End(span, err) }()
+
 	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 	// Валидация списка (типы/поля)
@@ -150,7 +220,27 @@ func (s *metricsService) UpdateBatch(ctx context.Context, items []dto.Metrics) e
 		if it.MType != "gauge" && it.MType != "counter" {
 			return ErrInvalidType
 		}
+		if err := checkName(it.ID); err != nil {
+			return err
+		}
 	}
 	// Делегируем атомарность в репозиторий (транзакция в БД / единый блок в памяти/файле)
 	return s.repo.SetMetrics(ctx, items)
 }
+
+func (s *metricsService) Snapshot(ctx context.Context) ([]dto.Metrics, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return snapshot.Take(ctx, s.repo)
+}
+
+func (s *metricsService) Restore(ctx context.Context, items []dto.Metrics, mode string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	// Некорректный снимок отклоняется до применения; сами Merge и Replace
+	// атомарны на уровне хранилища (одна транзакция или блокировка)
+	if err := snapshot.Validate(items); err != nil {
+		return err
+	}
+	return snapshot.Apply(ctx, s.repo, items, mode)
+}
@@ -0,0 +1,196 @@
+// Package snapshot снимает и применяет полные снимки метрик хранилища.
+//
+// Снимок — это список dto.Metrics, где у counter в поле Delta лежит
+// абсолютное значение счётчика (а не приращение). При применении в режиме
+// merge счётчики устанавливаются в это абсолютное значение, gauge перезаписываются,
+// остальные метрики хранилища не трогаются. В режиме replace содержимое
+// хранилища целиком заменяется снимком. Оба режима атомарны и требуют
+// от хранилища interfaces.Merger и interfaces.Replacer соответственно.
+//
+// Этим же форматом пользуется filemanager для файла бэкапа.
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+)
+
+// Режимы применения снимка
+const (
+	ModeMerge   = "merge"
+	ModeReplace = "replace"
+)
+
+// Форматы сериализации снимка
+const (
+	FormatJSON   = "json"   // один JSON-массив
+	FormatNDJSON = "ndjson" // по одной метрике JSON на строку
+)
+
+var (
+	// ErrBadMode возвращается при неизвестном режиме применения.
+	ErrBadMode = errors.New("snapshot: unknown mode")
+	// ErrBadFormat возвращается при неизвестном формате.
+	ErrBadFormat = errors.New("snapshot: unknown format")
+	// ErrReplaceUnsupported возвращается, если хранилище не умеет атомарную замену.
+	ErrReplaceUnsupported = errors.New("snapshot: storage does not support replace")
+	// ErrMergeUnsupported возвращается, если хранилище не умеет атомарное слияние.
+	ErrMergeUnsupported = errors.New("snapshot: storage does not support merge")
+	// ErrBadItem возвращается при некорректной метрике в снимке.
+	ErrBadItem = errors.New("snapshot: bad metric")
+)
+
+// Read читает все метрики хранилища. Если хранилище реализует
+// interfaces.Snapshotter, gauge и counter читаются согласованно.
+func Read(ctx context.Context, store interfaces.Store) (map[string]float64, map[string]int64, error) {
+	if sn, ok := store.(interfaces.Snapshotter); ok {
+		return sn.Snapshot(ctx)
+	}
+	gauges, err := store.GetAllGauges(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	counters, err := store.GetAllCounters(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gauges, counters, nil
+}
+
+// Take снимает полный снимок хранилища, отсортированный по типу и имени.
+// Если хранилище реализует interfaces.Snapshotter, снимок согласован.
+func Take(ctx context.Context, store interfaces.Store) ([]dto.Metrics, error) {
+	gauges, counters, err := Read(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]dto.Metrics, 0, len(gauges)+len(counters))
+	for k, v := range counters {
+		val := v
+		out = append(out, dto.Metrics{ID: k, MType: consts.MetricTypeCounter, Delta: &val})
+	}
+	for k, v := range gauges {
+		val := v
+		out = append(out, dto.Metrics{ID: k, MType: consts.MetricTypeGauge, Value: &val})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].MType != out[j].MType {
+			return out[i].MType < out[j].MType
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// Validate проверяет, что все метрики снимка корректны.
+func Validate(items []dto.Metrics) error {
+	for _, m := range items {
+		switch {
+		case m.MType == consts.MetricTypeGauge && m.Value != nil:
+		case m.MType == consts.MetricTypeCounter && m.Delta != nil:
+		default:
+			return fmt.Errorf("%w: %s/%s", ErrBadItem, m.MType, m.ID)
+		}
+	}
+	return nil
+}
+
+// Apply применяет снимок к хранилищу в режиме mode.
+// В режиме replace снимок с некорректной метрикой отклоняется целиком,
+// в режиме merge такие метрики пропускаются (так исторически ведёт себя
+// восстановление из файла).
+func Apply(ctx context.Context, store interfaces.Store, items []dto.Metrics, mode string) error {
+	switch mode {
+	case ModeMerge:
+		mg, ok := store.(interfaces.Merger)
+		if !ok {
+			return ErrMergeUnsupported
+		}
+		gauges, counters := split(items)
+		return mg.Merge(ctx, gauges, counters)
+	case ModeReplace:
+		rp, ok := store.(interfaces.Replacer)
+		if !ok {
+			return ErrReplaceUnsupported
+		}
+		if err := Validate(items); err != nil {
+			return err
+		}
+		gauges, counters := split(items)
+		return rp.Replace(ctx, gauges, counters)
+	default:
+		return fmt.Errorf("%w: %q", ErrBadMode, mode)
+	}
+}
+
+// split раскладывает снимок по типам, пропуская некорректные метрики.
+// При повторе ID берётся последнее значение: у counter в снимке оно абсолютное.
+func split(items []dto.Metrics) (map[string]float64, map[string]int64) {
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	for _, m := range items {
+		switch {
+		case m.MType == consts.MetricTypeGauge && m.Value != nil:
+			gauges[m.ID] = *m.Value
+		case m.MType == consts.MetricTypeCounter && m.Delta != nil:
+			counters[m.ID] = *m.Delta
+		}
+	}
+	return gauges, counters
+}
+
+// Encode пишет снимок в w в формате format.
+func Encode(w io.Writer, items []dto.Metrics, format string) error {
+	switch format {
+	case FormatJSON, "":
+		return json.NewEncoder(w).Encode(items)
+	case FormatNDJSON:
+		enc := json.NewEncoder(w) // Encode сам добавляет перевод строки
+		for _, m := range items {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrBadFormat, format)
+	}
+}
+
+// Decode читает снимок из r в формате format.
+func Decode(r io.Reader, format string) ([]dto.Metrics, error) {
+	switch format {
+	case FormatJSON, "":
+		var items []dto.Metrics
+		if err := json.NewDecoder(r).Decode(&items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	case FormatNDJSON:
+		var items []dto.Metrics
+		dec := json.NewDecoder(bufio.NewReader(r))
+		for {
+			var m dto.Metrics
+			err := dec.Decode(&m)
+			if errors.Is(err, io.EOF) {
+				return items, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, m)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrBadFormat, format)
+	}
+}
@@ -0,0 +1,79 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/memstorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+)
+
+func TestTakeEncodeDecode(t *testing.T) {
+	ctx := context.Background()
+	s := memstorage.New()
+	require.NoError(t, s.SetGauge(ctx, "b", 2.5))
+	require.NoError(t, s.SetGauge(ctx, "a", 1))
+	require.NoError(t, s.IncrementCounter(ctx, "c", 7))
+
+	items, err := Take(ctx, s)
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	assert.Equal(t, []string{"c", "a", "b"}, []string{items[0].ID, items[1].ID, items[2].ID})
+
+	for _, format := range []string{FormatJSON, FormatNDJSON} {
+		var buf bytes.Buffer
+		require.NoError(t, Encode(&buf, items, format))
+		got, err := Decode(&buf, format)
+		require.NoError(t, err, format)
+		assert.Equal(t, items, got, format)
+	}
+
+	assert.ErrorIs(t, Encode(&bytes.Buffer{}, items, "xml"), ErrBadFormat)
+}
+
+func TestApplyMergeUsesAbsoluteCounters(t *testing.T) {
+	ctx := context.Background()
+	s := memstorage.New()
+	require.NoError(t, s.IncrementCounter(ctx, "hits", 10))
+	require.NoError(t, s.SetGauge(ctx, "keep", 1))
+
+	delta, value := int64(25), 3.5
+	items := []dto.Metrics{
+		{ID: "hits", MType: "counter", Delta: &delta},
+		{ID: "temp", MType: "gauge", Value: &value},
+	}
+	require.NoError(t, Apply(ctx, s, items, ModeMerge))
+	require.NoError(t, Apply(ctx, s, items, ModeMerge)) // повторное применение идемпотентно
+
+	v, _, _ := s.GetCounter(ctx, "hits")
+	assert.Equal(t, int64(25), v)
+	g, _, _ := s.GetGauge(ctx, "temp")
+	assert.Equal(t, 3.5, g)
+	_, ok, _ := s.GetGauge(ctx, "keep")
+	assert.True(t, ok, "merge must keep metrics missing from the snapshot")
+
+	assert.ErrorIs(t, Apply(ctx, storetest.Failing{}, items, ModeMerge), ErrMergeUnsupported)
+}
+
+func TestApplyReplace(t *testing.T) {
+	ctx := context.Background()
+	s := memstorage.New()
+	require.NoError(t, s.SetGauge(ctx, "old", 1))
+
+	value := 2.0
+	require.NoError(t, Apply(ctx, s, []dto.Metrics{{ID: "new", MType: "gauge", Value: &value}}, ModeReplace))
+
+	_, ok, _ := s.GetGauge(ctx, "old")
+	assert.False(t, ok)
+	v, ok, _ := s.GetGauge(ctx, "new")
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, v)
+
+	assert.ErrorIs(t, Apply(ctx, s, []dto.Metrics{{ID: "x", MType: "gauge"}}, ModeReplace), ErrBadItem)
+	assert.ErrorIs(t, Apply(ctx, s, nil, "append"), ErrBadMode)
+}
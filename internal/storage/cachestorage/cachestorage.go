@@ -0,0 +1,281 @@
+// Package cachestorage — кеширующий декоратор interfaces.Store (обычно перед dbstorage).
+//
+// Чтение — read-through: значение берётся из кеша, пока не истёк TTL, иначе из
+// внутреннего хранилища. Запись — write-through: изменение сначала уходит во
+// внутреннее хранилище, затем gauge обновляется в кеше, а counter (его итоговое
+// значение известно только БД) из кеша удаляется.
+//
+// Если несколько реплик сервера работают с одной БД, чужие изменения видны
+// не позже чем через TTL; для немедленной согласованности кеш сбрасывается
+// по уведомлениям БД (см. Invalidate и postgres.Listen).
+package cachestorage
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
+	"github.com/SamSafonov2025/metrics-tpl/internal/snapshot"
+)
+
+// Имена self-метрик кеша (counter, см. selfmetrics).
+const (
+	HitsMetric   = "cache.hits"
+	MissesMetric = "cache.misses"
+)
+
+type entry[T any] struct {
+	v   T
+	exp time.Time
+}
+
+// typeCache — кеш метрик одного типа.
+type typeCache[T any] struct {
+	byID map[string]entry[T]
+	all  *entry[map[string]T] // результат GetAll*, nil — не закеширован
+	gen  uint64               // растёт при каждой инвалидации
+}
+
+func newTypeCache[T any]() typeCache[T] {
+	return typeCache[T]{byID: make(map[string]entry[T])}
+}
+
+// reset сбрасывает кеш типа; чтения, начатые до сброса, свой результат не сохранят.
+func (c *typeCache[T]) reset() {
+	c.byID = make(map[string]entry[T])
+	c.all = nil
+	c.gen++
+}
+
+// Stats — счётчики попаданий и промахов кеша.
+type Stats struct {
+	Hits   int64
+	Misses int64
+}
+
+// Store кеширует чтения внутреннего хранилища.
+type Store struct {
+	interfaces.Store
+
+	ttl time.Duration
+	now func() time.Time // подменяется в тестах
+
+	mu       sync.Mutex
+	gauges   typeCache[float64]
+	counters typeCache[int64]
+
+	hits, misses atomic.Int64
+}
+
+// New оборачивает inner кешем с временем жизни записей ttl.
+func New(inner interfaces.Store, ttl time.Duration) *Store {
+	return &Store{
+		Store:    inner,
+		ttl:      ttl,
+		now:      time.Now,
+		gauges:   newTypeCache[float64](),
+		counters: newTypeCache[int64](),
+	}
+}
+
+// lookup — общий read-through для одиночного значения.
+// Ошибки внутреннего хранилища не кешируются.
+func lookup[T any](s *Store, c *typeCache[T], name string, load func() (T, bool, error)) (T, bool, error) {
+	s.mu.Lock()
+	e, ok := c.byID[name]
+	gen := c.gen
+	s.mu.Unlock()
+	if ok && s.now().Before(e.exp) {
+		s.hit()
+		return e.v, true, nil
+	}
+
+	s.miss()
+	v, found, err := load()
+	if err != nil {
+		return v, false, err
+	}
+	if found {
+		s.mu.Lock()
+		if c.gen == gen {
+			c.byID[name] = entry[T]{v: v, exp: s.now().Add(s.ttl)}
+		}
+		s.mu.Unlock()
+	}
+	return v, found, nil
+}
+
+// lookupAll — общий read-through для GetAll*. Возвращает копию.
+func lookupAll[T any](s *Store, c *typeCache[T], load func() (map[string]T, error)) (map[string]T, error) {
+	s.mu.Lock()
+	all := c.all
+	gen := c.gen
+	s.mu.Unlock()
+	if all != nil && s.now().Before(all.exp) {
+		s.hit()
+		return maps.Clone(all.v), nil
+	}
+
+	s.miss()
+	v, err := load()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if c.gen == gen {
+		c.all = &entry[map[string]T]{v: maps.Clone(v), exp: s.now().Add(s.ttl)}
+	}
+	s.mu.Unlock()
+	return v, nil
+}
+
+func (s *Store) GetGauge(ctx context.Context, name string) (float64, bool, error) {
+	return lookup(s, &s.gauges, name, func() (float64, bool, error) { return s.Store.GetGauge(ctx, name) })
+}
+
+func (s *Store) GetCounter(ctx context.Context, name string) (int64, bool, error) {
+	return lookup(s, &s.counters, name, func() (int64, bool, error) { return s.Store.GetCounter(ctx, name) })
+}
+
+func (s *Store) GetAllGauges(ctx context.Context) (map[string]float64, error) {
+	return lookupAll(s, &s.gauges, func() (map[string]float64, error) { return s.Store.GetAllGauges(ctx) })
+}
+
+func (s *Store) GetAllCounters(ctx context.Context) (map[string]int64, error) {
+	return lookupAll(s, &s.counters, func() (map[string]int64, error) { return s.Store.GetAllCounters(ctx) })
+}
+
+func (s *Store) SetGauge(ctx context.Context, name string, value float64) error {
+	if err := s.Store.SetGauge(ctx, name, value); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.writeGauge(name, value)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) IncrementCounter(ctx context.Context, name string, value int64) error {
+	if err := s.Store.IncrementCounter(ctx, name, value); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.dropCounter(name)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) SetMetrics(ctx context.Context, items []dto.Metrics) error {
+	if err := s.Store.SetMetrics(ctx, items); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	for _, m := range items {
+		if m.MType == consts.MetricTypeGauge {
+			s.writeGauge(m.ID, *m.Value)
+		} else {
+			s.dropCounter(m.ID)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// writeGauge кладёт записанное значение в кеш. Вызывается под s.mu.
+func (s *Store) writeGauge(name string, value float64) {
+	s.gauges.gen++ // параллельное чтение могло достать из БД старое значение
+	s.gauges.byID[name] = entry[float64]{v: value, exp: s.now().Add(s.ttl)}
+	s.gauges.all = nil
+}
+
+// dropCounter удаляет counter из кеша. Вызывается под s.mu.
+func (s *Store) dropCounter(name string) {
+	s.counters.gen++
+	delete(s.counters.byID, name)
+	s.counters.all = nil
+}
+
+// Snapshot всегда читает внутреннее хранилище: снимок должен быть согласованным.
+func (s *Store) Snapshot(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	return snapshot.Read(ctx, s.Store)
+}
+
+// Replace заменяет содержимое внутреннего хранилища и сбрасывает кеш.
+func (s *Store) Replace(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	rp, ok := s.Store.(interfaces.Replacer)
+	if !ok {
+		return snapshot.ErrReplaceUnsupported
+	}
+	err := rp.Replace(ctx, gauges, counters)
+	s.InvalidateAll()
+	return err
+}
+
+// Merge сливает снимок с внутренним хранилищем и сбрасывает кеш.
+func (s *Store) Merge(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	mg, ok := s.Store.(interfaces.Merger)
+	if !ok {
+		return snapshot.ErrMergeUnsupported
+	}
+	err := mg.Merge(ctx, gauges, counters)
+	s.InvalidateAll()
+	return err
+}
+
+// Invalidate обрабатывает уведомление об изменении метрик (payload
+// postgres.Listen): "<тип>:<id>" удаляет из кеша одну метрику, "<тип>"
+// ("gauge" или "counter") сбрасывает кеш этого типа, любое другое значение —
+// весь кеш.
+func (s *Store) Invalidate(payload string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kind, id, one := strings.Cut(payload, ":")
+	switch {
+	case kind == consts.MetricTypeGauge && one:
+		s.gauges.gen++
+		delete(s.gauges.byID, id)
+		s.gauges.all = nil
+	case kind == consts.MetricTypeCounter && one:
+		s.dropCounter(id)
+	case kind == consts.MetricTypeGauge:
+		s.gauges.reset()
+	case kind == consts.MetricTypeCounter:
+		s.counters.reset()
+	default:
+		s.gauges.reset()
+		s.counters.reset()
+	}
+}
+
+// InvalidateAll сбрасывает весь кеш.
+func (s *Store) InvalidateAll() {
+	s.Invalidate("")
+}
+
+// hit и miss считают попадания и промахи; в хранилище их записывает
+// selfmetrics вместе с остальными self-метриками сервера.
+func (s *Store) hit() {
+	s.hits.Add(1)
+	selfmetrics.Add(HitsMetric, 1)
+}
+
+func (s *Store) miss() {
+	s.misses.Add(1)
+	selfmetrics.Add(MissesMetric, 1)
+}
+
+// Stats возвращает накопленные счётчики попаданий и промахов.
+func (s *Store) Stats() Stats {
+	return Stats{Hits: s.hits.Load(), Misses: s.misses.Load()}
+}
+
+func (s *Store) StorageType() string {
+	return s.Store.StorageType() + "+cache"
+}
@@ -0,0 +1,157 @@
+package cachestorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/memstorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.Store { return New(memstorage.New(), time.Minute) })
+}
+
+func TestReadThroughAndTTL(t *testing.T) {
+	ctx := context.Background()
+	inner := memstorage.New()
+	s := New(inner, time.Second)
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, inner.SetGauge(ctx, "Alloc", 1))
+	v, _, _ := s.GetGauge(ctx, "Alloc")
+	assert.Equal(t, 1.0, v)
+
+	// изменение в обход кеша (другая реплика) не видно до истечения TTL
+	require.NoError(t, inner.SetGauge(ctx, "Alloc", 2))
+	v, _, _ = s.GetGauge(ctx, "Alloc")
+	assert.Equal(t, 1.0, v)
+	assert.Equal(t, Stats{Hits: 1, Misses: 1}, s.Stats())
+
+	now = now.Add(2 * time.Second)
+	v, _, _ = s.GetGauge(ctx, "Alloc")
+	assert.Equal(t, 2.0, v)
+
+	// ...или до сброса по уведомлению
+	require.NoError(t, inner.SetGauge(ctx, "Alloc", 3))
+	s.Invalidate("gauge")
+	v, _, _ = s.GetGauge(ctx, "Alloc")
+	assert.Equal(t, 3.0, v)
+}
+
+func TestInvalidateOneMetric(t *testing.T) {
+	ctx := context.Background()
+	inner := memstorage.New()
+	s := New(inner, time.Hour)
+	require.NoError(t, s.SetGauge(ctx, "a", 1))
+	require.NoError(t, s.SetGauge(ctx, "b", 1))
+
+	// другая реплика изменила обе метрики, а уведомление пришло только о "a"
+	require.NoError(t, inner.SetGauge(ctx, "a", 2))
+	require.NoError(t, inner.SetGauge(ctx, "b", 2))
+	s.Invalidate("gauge:a")
+
+	v, _, _ := s.GetGauge(ctx, "a")
+	assert.Equal(t, 2.0, v, "метрика из уведомления читается заново")
+	v, _, _ = s.GetGauge(ctx, "b")
+	assert.Equal(t, 1.0, v, "остальные остаются в кеше")
+
+	// id может содержать двоеточие
+	require.NoError(t, s.IncrementCounter(ctx, "x:y", 1))
+	_, _, _ = s.GetCounter(ctx, "x:y")
+	require.NoError(t, inner.IncrementCounter(ctx, "x:y", 1))
+	s.Invalidate("counter:x:y")
+	c, _, _ := s.GetCounter(ctx, "x:y")
+	assert.Equal(t, int64(2), c)
+}
+
+// flaky отказывает на чтении gauge, пока задана err.
+type flaky struct {
+	interfaces.Store
+	err error
+}
+
+func (f *flaky) GetGauge(ctx context.Context, name string) (float64, bool, error) {
+	if f.err != nil {
+		return 0, false, f.err
+	}
+	return f.Store.GetGauge(ctx, name)
+}
+
+func (f *flaky) GetAllGauges(ctx context.Context) (map[string]float64, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Store.GetAllGauges(ctx)
+}
+
+func TestReadErrorsAreNotCached(t *testing.T) {
+	ctx := context.Background()
+	inner := &flaky{Store: memstorage.New(), err: interfaces.ErrUnavailable}
+	s := New(inner, time.Minute)
+
+	storetest.RunFailing(t, New(storetest.Failing{Err: interfaces.ErrUnavailable}, time.Minute))
+
+	_, ok, err := s.GetGauge(ctx, "Alloc")
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+	assert.False(t, ok)
+	_, err = s.GetAllGauges(ctx)
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+
+	// после восстановления БД значение читается, а не отдаётся закешированный отказ
+	inner.err = nil
+	require.NoError(t, inner.SetGauge(ctx, "Alloc", 1))
+	v, ok, err := s.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, v)
+	gauges, err := s.GetAllGauges(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Alloc": 1}, gauges)
+}
+
+func TestWriteThrough(t *testing.T) {
+	ctx := context.Background()
+	s := New(memstorage.New(), time.Minute)
+
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 1))
+	counters, err := s.GetAllCounters(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"PollCount": 1}, counters)
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 2))
+	counters, err = s.GetAllCounters(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"PollCount": 3}, counters)
+	c, _, _ := s.GetCounter(ctx, "PollCount")
+	assert.Equal(t, int64(3), c)
+
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 5))
+	before := s.Stats()
+	v, _, _ := s.GetGauge(ctx, "Alloc")
+	assert.Equal(t, 5.0, v)
+	assert.Equal(t, before.Hits+1, s.Stats().Hits, "written gauge is served from cache")
+}
+
+func TestStatsGoToSelfMetrics(t *testing.T) {
+	ctx := context.Background()
+	selfmetrics.Default().Collect() // сбрасываем накопленное другими тестами
+	s := New(memstorage.New(), time.Minute)
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 1))
+	_, _, _ = s.GetGauge(ctx, "missing")
+	_, _, _ = s.GetGauge(ctx, "missing")
+	_, _, _ = s.GetGauge(ctx, "Alloc")
+
+	got := map[string]int64{}
+	for _, m := range selfmetrics.Default().Collect() {
+		got[m.ID] = *m.Delta
+	}
+	assert.Equal(t, map[string]int64{selfmetrics.Prefix + HitsMetric: 1, selfmetrics.Prefix + MissesMetric: 2}, got)
+	assert.Equal(t, Stats{Hits: 1, Misses: 2}, s.Stats())
+}
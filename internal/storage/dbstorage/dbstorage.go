@@ -7,17 +7,21 @@ import (
 
 	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
 	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
 
 	//"github.com/jackc/pgx/v5/pgconn"
-	"log"
+	"net"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	pgconnv5 "github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/puddle/v2"
 )
 
 type DBStorage struct {
@@ -41,10 +45,14 @@ func (db *DBStorage) SetGauge(ctx context.Context, metricName string, value floa
 		VALUES ($1, $2)
 		ON CONFLICT (id) DO UPDATE SET value = EXCLUDED.value;
 	`
-	return retryCtx(ctx, func(ctx context.Context) error {
+	err := retryCtx(ctx, func(ctx context.Context) error {
 		_, err := db.Pool.Exec(ctx, q, metricName, value)
 		return err
 	})
+	if err != nil {
+		return storeErr("set gauge", err)
+	}
+	return nil
 }
 
 func (db *DBStorage) IncrementCounter(ctx context.Context, metricName string, value int64) error {
@@ -54,52 +62,50 @@ func (db *DBStorage) IncrementCounter(ctx context.Context, metricName string, va
 		VALUES ($1, $2)
 		ON CONFLICT (id) DO UPDATE SET value = counter.value + EXCLUDED.value;
 	`
-	return retryCtx(ctx, func(ctx context.Context) error {
+	err := retryCtx(ctx, func(ctx context.Context) error {
 		_, err := db.Pool.Exec(ctx, q, metricName, value)
 		return err
 	})
+	if err != nil {
+		return storeErr("increment counter", err)
+	}
+	return nil
 }
 
-func (db *DBStorage) GetGauge(ctx context.Context, metricName string) (float64, bool) {
-	//ctx := context.Background()
+func (db *DBStorage) GetGauge(ctx context.Context, metricName string) (float64, bool, error) {
 	const q = `SELECT value FROM gauge WHERE id = $1;`
 
 	var v float64
 	err := db.Pool.QueryRow(ctx, q, metricName).Scan(&v)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, false
+			return 0, false, nil
 		}
-		log.Printf("GetGauge: query %q: %v", metricName, err)
-		return 0, false
+		return 0, false, storeErr("get gauge", err)
 	}
-	return v, true
+	return v, true, nil
 }
 
-func (db *DBStorage) GetCounter(ctx context.Context, metricName string) (int64, bool) {
-	//ctx := context.Background()
+func (db *DBStorage) GetCounter(ctx context.Context, metricName string) (int64, bool, error) {
 	const q = `SELECT value FROM counter WHERE id = $1;`
 
 	var v int64
 	err := db.Pool.QueryRow(ctx, q, metricName).Scan(&v)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, false
+			return 0, false, nil
 		}
-		log.Printf("GetCounter: query %q: %v", metricName, err)
-		return 0, false
+		return 0, false, storeErr("get counter", err)
 	}
-	return v, true
+	return v, true, nil
 }
 
-func (db *DBStorage) GetAllGauges(ctx context.Context) map[string]float64 {
-	//ctx := context.Background()
+func (db *DBStorage) GetAllGauges(ctx context.Context) (map[string]float64, error) {
 	const q = `SELECT id, value FROM gauge;`
 
 	rows, err := db.Pool.Query(ctx, q)
 	if err != nil {
-		log.Printf("GetAllGauges: query: %v", err)
-		return nil
+		return nil, storeErr("get all gauges", err)
 	}
 	defer rows.Close()
 
@@ -108,26 +114,22 @@ func (db *DBStorage) GetAllGauges(ctx context.Context) map[string]float64 {
 		var id string
 		var v float64
 		if err := rows.Scan(&id, &v); err != nil {
-			log.Printf("GetAllGauges: scan: %v", err)
-			return nil
+			return nil, storeErr("get all gauges: scan", err)
 		}
 		gauges[id] = v
 	}
 	if err := rows.Err(); err != nil {
-		log.Printf("GetAllGauges: rows err: %v", err)
-		return nil
+		return nil, storeErr("get all gauges", err)
 	}
-	return gauges
+	return gauges, nil
 }
 
-func (db *DBStorage) GetAllCounters(ctx context.Context) map[string]int64 {
-	//ctx := context.Background()
+func (db *DBStorage) GetAllCounters(ctx context.Context) (map[string]int64, error) {
 	const q = `SELECT id, value FROM counter;`
 
 	rows, err := db.Pool.Query(ctx, q)
 	if err != nil {
-		log.Printf("GetAllCounters: query: %v", err)
-		return nil
+		return nil, storeErr("get all counters", err)
 	}
 	defer rows.Close()
 
@@ -136,63 +138,162 @@ func (db *DBStorage) GetAllCounters(ctx context.Context) map[string]int64 {
 		var id string
 		var v int64
 		if err := rows.Scan(&id, &v); err != nil {
-			log.Printf("GetAllCounters: scan: %v", err)
-			return nil
+			return nil, storeErr("get all counters: scan", err)
 		}
 		counters[id] = v
 	}
 	if err := rows.Err(); err != nil {
-		log.Printf("GetAllCounters: rows err: %v", err)
-		return nil
+		return nil, storeErr("get all counters", err)
 	}
-	return counters
+	return counters, nil
 }
 
+// SetMetrics записывает батч двумя запросами INSERT ... SELECT FROM unnest(...)
+// в одной транзакции. Повторы одного ID заранее схлопываются (для gauge —
+// последнее значение, для counter — сумма), иначе ON CONFLICT не сможет
+// обновить одну строку дважды. ID сортируются, чтобы параллельные батчи
+// брали блокировки строк в одном порядке и не упирались в deadlock.
+// Любая ошибка откатывает транзакцию и возвращается вызывающему.
+// Батч с некорректной метрикой отклоняется целиком, до обращения к БД.
 func (db *DBStorage) SetMetrics(ctx context.Context, metrics []dto.Metrics) error {
-	tx, err := db.Pool.Begin(context.Background())
-	if err != nil {
-		log.Printf("Error starting transaction: %s", err)
+	if err := dto.ValidateBatch(metrics); err != nil {
 		return err
 	}
-	defer func() {
+	b := aggregate(metrics)
+	if len(b.gaugeIDs) == 0 && len(b.counterIDs) == 0 {
+		return nil
+	}
+
+	err := retryCtx(ctx, func(ctx context.Context) error {
+		tx, err := db.Pool.Begin(ctx)
 		if err != nil {
-			if rollbackErr := tx.Rollback(context.Background()); rollbackErr != nil {
-				log.Printf("Unable to rollback transaction: %v", rollbackErr)
-			}
-		}
-	}()
-
-	for _, metric := range metrics {
-		if metric.MType == consts.MetricTypeGauge && metric.Value != nil {
-			err = db.InsertOrUpdateGauge(ctx, metric.ID, *metric.Value)
-			if err != nil {
-				log.Printf("Error inserting gauge metric: %v", err)
-			}
-		} else if metric.MType == consts.MetricTypeCounter && metric.Delta != nil {
-			err = db.InsertOrUpdateCounter(ctx, metric.ID, *metric.Delta)
-			if err != nil {
-				log.Printf("Error inserting counter metric: %v", err)
-			}
-		} else {
-			log.Printf("Unknown metric type or metric value is nil: %s, %s", metric.MType, metric.ID)
+			return fmt.Errorf("begin: %w", err)
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		if err := b.upsert(ctx, tx, addCounter); err != nil {
+			return err
 		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return storeErr("set metrics", err)
 	}
+	return nil
+}
 
-	err = tx.Commit(context.Background())
+// Merge в одной транзакции записывает gauge и абсолютные значения counter.
+func (db *DBStorage) Merge(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	b := columns(gauges, counters)
+	err := retryCtx(ctx, func(ctx context.Context) error {
+		tx, err := db.Pool.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("begin: %w", err)
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		if err := b.upsert(ctx, tx, setCounter); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
 	if err != nil {
-		return fmt.Errorf("unable to commit transaction: %w", err)
+		return storeErr("merge", err)
 	}
+	return nil
+}
+
+// Обновление существующего counter при upsert батча
+const (
+	addCounter = "counter.value + EXCLUDED.value" // приращение (SetMetrics)
+	setCounter = "EXCLUDED.value"                 // абсолютное значение (Merge, Replace)
+)
 
+// upsert записывает батч одним INSERT ... SELECT FROM unnest на тип
+// в открытой транзакции. counterValue — новое значение существующего counter.
+func (b batch) upsert(ctx context.Context, tx pgx.Tx, counterValue string) error {
+	if len(b.gaugeIDs) > 0 {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO gauge (id, value)
+			SELECT * FROM unnest($1::varchar[], $2::double precision[])
+			ON CONFLICT (id) DO UPDATE SET value = EXCLUDED.value;
+		`, b.gaugeIDs, b.gaugeValues); err != nil {
+			return fmt.Errorf("upsert gauge: %w", err)
+		}
+	}
+	if len(b.counterIDs) > 0 {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO counter (id, value)
+			SELECT * FROM unnest($1::varchar[], $2::bigint[])
+			ON CONFLICT (id) DO UPDATE SET value = `+counterValue+`;
+		`, b.counterIDs, b.counterDeltas); err != nil {
+			return fmt.Errorf("upsert counter: %w", err)
+		}
+	}
 	return nil
 }
 
+// batch — батч метрик, разложенный по колонкам для unnest.
+type batch struct {
+	gaugeIDs      []string
+	gaugeValues   []float64
+	counterIDs    []string
+	counterDeltas []int64 // приращения или абсолютные значения, в зависимости от операции
+}
+
+// aggregate схлопывает повторы ID и раскладывает батч по колонкам,
+// отсортированным по ID. Метрики должны быть заранее провалидированы.
+func aggregate(metrics []dto.Metrics) batch {
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	for _, m := range metrics {
+		if m.MType == consts.MetricTypeGauge {
+			gauges[m.ID] = *m.Value
+		} else {
+			counters[m.ID] += *m.Delta
+		}
+	}
+	return columns(gauges, counters)
+}
+
+// columns раскладывает gauge и counter по колонкам, отсортированным по ID:
+// параллельные транзакции блокируют строки в одном порядке.
+func columns(gauges map[string]float64, counters map[string]int64) batch {
+	var b batch
+	b.gaugeIDs = sortedKeys(gauges)
+	b.gaugeValues = make([]float64, len(b.gaugeIDs))
+	for i, id := range b.gaugeIDs {
+		b.gaugeValues[i] = gauges[id]
+	}
+	b.counterIDs = sortedKeys(counters)
+	b.counterDeltas = make([]int64, len(b.counterIDs))
+	for i, id := range b.counterIDs {
+		b.counterDeltas[i] = counters[id]
+	}
+	return b
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (db *DBStorage) InsertOrUpdateGauge(ctx context.Context, metricID string, value float64) error {
 	q := `INSERT INTO gauge (id, value)
 			VALUES ($1, $2)
 			ON CONFLICT (id) DO UPDATE
 			SET value = excluded.value;`
-	_, err := db.Pool.Exec(ctx, q, metricID, value)
-	return err
+	if _, err := db.Pool.Exec(ctx, q, metricID, value); err != nil {
+		return storeErr("insert or update gauge", err)
+	}
+	return nil
 }
 
 func (db *DBStorage) InsertOrUpdateCounter(ctx context.Context, metricID string, delta int64) error {
@@ -200,8 +301,96 @@ func (db *DBStorage) InsertOrUpdateCounter(ctx context.Context, metricID string,
 			VALUES ($1, $2)
 			ON CONFLICT (id) DO UPDATE
 			SET value = public.counter.value + excluded.value;`
-	_, err := db.Pool.Exec(ctx, q, metricID, delta)
-	return err
+	if _, err := db.Pool.Exec(ctx, q, metricID, delta); err != nil {
+		return storeErr("insert or update counter", err)
+	}
+	return nil
+}
+
+// Snapshot читает обе таблицы в одной REPEATABLE READ транзакции,
+// поэтому снимок согласован даже при параллельной записи.
+func (db *DBStorage) Snapshot(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	gauges, counters, err := db.snapshot(ctx)
+	if err != nil {
+		return nil, nil, storeErr("snapshot", err)
+	}
+	return gauges, counters, nil
+}
+
+func (db *DBStorage) snapshot(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	tx, err := db.Pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	gauges := make(map[string]float64)
+	rows, err := tx.Query(ctx, `SELECT id, value FROM gauge;`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query gauge: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		var v float64
+		if err := rows.Scan(&id, &v); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan gauge: %w", err)
+		}
+		gauges[id] = v
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("rows gauge: %w", err)
+	}
+
+	counters := make(map[string]int64)
+	rows, err = tx.Query(ctx, `SELECT id, value FROM counter;`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query counter: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		var v int64
+		if err := rows.Scan(&id, &v); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan counter: %w", err)
+		}
+		counters[id] = v
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("rows counter: %w", err)
+	}
+
+	return gauges, counters, tx.Commit(ctx)
+}
+
+// Replace в одной транзакции очищает таблицы и записывает новое содержимое
+// тем же unnest-запросом, что и SetMetrics.
+func (db *DBStorage) Replace(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	b := columns(gauges, counters)
+	err := retryCtx(ctx, func(ctx context.Context) error {
+		tx, err := db.Pool.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("begin: %w", err)
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		if _, err := tx.Exec(ctx, `DELETE FROM gauge;`); err != nil {
+			return fmt.Errorf("clear gauge: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM counter;`); err != nil {
+			return fmt.Errorf("clear counter: %w", err)
+		}
+		if err := b.upsert(ctx, tx, setCounter); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
+	if err != nil {
+		return storeErr("replace", err)
+	}
+	return nil
 }
 
 func (db *DBStorage) StorageType() string {
@@ -229,6 +418,37 @@ func retryCtx(ctx context.Context, fn func(context.Context) error) error {
 	return nil
 }
 
+// storeErr оборачивает ошибку чтения или записи; сбои соединения и таймауты
+// дополнительно помечаются interfaces.ErrUnavailable (503 у обработчиков).
+func storeErr(op string, err error) error {
+	if isUnavailable(err) {
+		return fmt.Errorf("%s: %w: %w", op, interfaces.ErrUnavailable, err)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// isUnavailable сообщает, что ошибка вызвана недоступностью БД,
+// а не самим запросом: не удалось подключиться, истёк таймаут,
+// пул закрыт или сервер вернул ошибку класса 08 (Connection Exception).
+func isUnavailable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || pgconnv5.Timeout(err) {
+		return true
+	}
+	var connErr *pgconnv5.ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pgErr *pgconnv5.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+	return errors.Is(err, puddle.ErrClosedPool)
+}
+
 func isRetryablePgErr(err error) bool {
 	if err == nil {
 		return false
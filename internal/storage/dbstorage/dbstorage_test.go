@@ -0,0 +1,83 @@
+package dbstorage
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/postgres"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+)
+
+// TestConformance запускается только при заданном TEST_DATABASE_DSN
+// (таблицы gauge и counter в этой базе очищаются перед каждым подтестом).
+func TestConformance(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	pool, err := postgres.Connect(dsn)
+	require.NoError(t, err)
+	t.Cleanup(postgres.Close)
+
+	storetest.Run(t, func(t *testing.T) interfaces.Store {
+		_, err := pool.Exec(context.Background(), `TRUNCATE gauge, counter;`)
+		require.NoError(t, err)
+		return &DBStorage{Pool: pool}
+	})
+}
+
+// TestFailsOnUnreachablePool подменяет БД пулом, который не может
+// подключиться: чтения должны вернуть ErrUnavailable, а не «не найдено»,
+// записи — тоже ErrUnavailable, а не сырую ошибку pgx.
+func TestFailsOnUnreachablePool(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "postgres://metrics@127.0.0.1:1/metrics?connect_timeout=1")
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	s := &DBStorage{Pool: pool}
+
+	storetest.RunFailing(t, s)
+	_, _, err = s.GetCounter(context.Background(), "PollCount")
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+	_, err = s.GetAllGauges(context.Background())
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+	_, _, err = s.Snapshot(context.Background())
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+	assert.ErrorIs(t, s.Replace(context.Background(), map[string]float64{"Alloc": 1}, nil), interfaces.ErrUnavailable)
+	assert.ErrorIs(t, s.Merge(context.Background(), nil, map[string]int64{"PollCount": 1}), interfaces.ErrUnavailable)
+
+	v, d := 1.0, int64(1)
+	assert.ErrorIs(t, s.SetGauge(context.Background(), "Alloc", v), interfaces.ErrUnavailable)
+	assert.ErrorIs(t, s.IncrementCounter(context.Background(), "PollCount", d), interfaces.ErrUnavailable)
+	assert.ErrorIs(t, s.SetMetrics(context.Background(), []dto.Metrics{{ID: "Alloc", MType: "gauge", Value: &v}}),
+		interfaces.ErrUnavailable)
+
+	// закрытый пул — тоже недоступность
+	pool.Close()
+	_, _, err = s.GetGauge(context.Background(), "Alloc")
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+}
+
+func TestAggregate_CollapsesDuplicatesInIDOrder(t *testing.T) {
+	g1, g2, g3 := 1.0, 2.0, 3.0
+	d1, d2, d3 := int64(1), int64(2), int64(5)
+	b := aggregate([]dto.Metrics{
+		{ID: "b", MType: "gauge", Value: &g1},
+		{ID: "a", MType: "gauge", Value: &g2},
+		{ID: "b", MType: "gauge", Value: &g3},
+		{ID: "hits", MType: "counter", Delta: &d1},
+		{ID: "errs", MType: "counter", Delta: &d3},
+		{ID: "hits", MType: "counter", Delta: &d2},
+	})
+
+	assert.Equal(t, []string{"a", "b"}, b.gaugeIDs)
+	assert.Equal(t, []float64{2, 3}, b.gaugeValues, "last gauge value wins")
+	assert.Equal(t, []string{"errs", "hits"}, b.counterIDs)
+	assert.Equal(t, []int64{5, 3}, b.counterDeltas, "counter deltas are summed")
+}
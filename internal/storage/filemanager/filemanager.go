@@ -1,23 +1,58 @@
 package filemanager
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
 	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
+	"github.com/SamSafonov2025/metrics-tpl/internal/snapshot"
 )
 
 type StorageInterface = interfaces.Store
 
+// FormatVersion — текущая версия формата файла снимка.
+// Версия 1 — голый JSON-массив метрик без заголовка (читается для совместимости).
+const FormatVersion = 2
+
+// ErrChecksum возвращается, если содержимое файла не совпадает с контрольной суммой.
+var ErrChecksum = errors.New("filemanager: checksum mismatch")
+
+// Header — заголовок файла снимка.
+type Header struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Count     int       `json:"count"`
+	Checksum  string    `json:"checksum"` // sha256 от байтов поля metrics
+	Path      string    `json:"-"`        // из какого файла (поколения) прочитан снимок
+}
+
+// envelope — формат файла снимка версии 2.
+type envelope struct {
+	Header
+	Metrics json.RawMessage `json:"metrics"`
+}
+
 type FileManager struct {
-	FilePath  string
-	Done      chan struct{}
-	closeOnce sync.Once
+	FilePath string
+	// Generations — сколько предыдущих снимков хранить рядом (FilePath.1 … FilePath.N).
+	Generations int
+	Done        chan struct{}
+	closeOnce   sync.Once
+	mu          sync.Mutex // сериализует запись снимков
+
+	errMu   sync.Mutex
+	lastErr error // результат последнего SaveData (для проверки готовности)
 }
 
 func New(filePath string) *FileManager {
@@ -27,82 +62,237 @@ func New(filePath string) *FileManager {
 	}
 }
 
+// SaveData атомарно сохраняет снимок хранилища:
+// пишет во временный файл рядом, делает fsync, сдвигает поколения
+// и переименовывает временный файл в FilePath. При падении посреди записи
+// на диске остаётся либо старый, либо новый снимок, но не обрезанный.
 func (fm *FileManager) SaveData(storage StorageInterface) error {
+	return fm.saveTimed(storage, true)
+}
+
+// SaveCurrent — как SaveData, но только перезаписывает FilePath, не сдвигая
+// поколения. Нужен синхронному режиму: сохранение на каждое изменение
+// затёрло бы все FilePath.1 … FilePath.N за N обновлений.
+func (fm *FileManager) SaveCurrent(storage StorageInterface) error {
+	return fm.saveTimed(storage, false)
+}
+
+func (fm *FileManager) saveTimed(storage StorageInterface, rotate bool) error {
+	start := time.Now()
+	err := fm.save(storage, rotate)
+	selfmetrics.Observe("backup", time.Since(start))
+	if err != nil {
+		selfmetrics.Add("backup.failures", 1)
+	}
+	fm.errMu.Lock()
+	fm.lastErr = err
+	fm.errMu.Unlock()
+	return err
+}
+
+// Check возвращает ошибку последнего сохранения снимка; nil — последнее сохранение
+// прошло успешно или сохранений ещё не было. Подходит как health.Check.
+func (fm *FileManager) Check(context.Context) error {
+	fm.errMu.Lock()
+	defer fm.errMu.Unlock()
+	if fm.lastErr != nil {
+		return fmt.Errorf("last snapshot save failed: %w", fm.lastErr)
+	}
+	return nil
+}
+
+func (fm *FileManager) save(storage StorageInterface, rotate bool) error {
 	if fm.FilePath == "" {
 		return errors.New("filemanager: empty FilePath")
 	}
 
 	ctx := context.Background()
 
-	// собираем метрики из стораджа
-	var out []dto.Metrics
-	for k, v := range storage.GetAllCounters(ctx) {
-		val := v
-		out = append(out, dto.Metrics{ID: k, MType: "counter", Delta: &val})
-	}
-	for k, v := range storage.GetAllGauges(ctx) {
-		val := v
-		out = append(out, dto.Metrics{ID: k, MType: "gauge", Value: &val})
+	// хранилище с журналом само согласует снимок с компактификацией журнала
+	if c, ok := storage.(interfaces.Compactor); ok {
+		return c.Compact(ctx, func(items []dto.Metrics) error { return fm.write(items, rotate) })
 	}
 
-	f, err := os.Create(fm.FilePath)
+	// собираем метрики из стораджа
+	out, err := snapshot.Take(ctx, storage)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	enc := json.NewEncoder(f)
-	return enc.Encode(out)
+	return fm.write(out, rotate)
 }
 
-func (fm *FileManager) LoadData(storage StorageInterface) error {
-	if fm.FilePath == "" {
-		return errors.New("filemanager: empty FilePath")
+// write атомарно записывает снимок в FilePath; с rotate предыдущий файл
+// становится поколением FilePath.1.
+func (fm *FileManager) write(items []dto.Metrics, rotate bool) error {
+	var metrics bytes.Buffer
+	if err := snapshot.Encode(&metrics, items, snapshot.FormatJSON); err != nil {
+		return err
 	}
+	raw := bytes.TrimSpace(metrics.Bytes())
+	sum := sha256.Sum256(raw)
+	data, err := json.Marshal(envelope{
+		Header: Header{
+			Version:   FormatVersion,
+			CreatedAt: time.Now().UTC(),
+			Count:     len(items),
+			Checksum:  "sha256:" + hex.EncodeToString(sum[:]),
+		},
+		Metrics: raw,
+	})
+	if err != nil {
+		return err
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
 
-	f, err := os.Open(fm.FilePath)
+	dir := filepath.Dir(fm.FilePath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(fm.FilePath)+".tmp-*")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	tmpName := tmp.Name()
+	cleanup := func() { _ = os.Remove(tmpName) }
 
-	var items []dto.Metrics
-	dec := json.NewDecoder(f)
-	if err := dec.Decode(&items); err != nil {
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		cleanup()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		cleanup()
 		return err
 	}
 
-	ctx := context.Background()
+	if rotate {
+		if err := fm.rotate(); err != nil {
+			cleanup()
+			return err
+		}
+	}
+	if err := os.Rename(tmpName, fm.FilePath); err != nil {
+		cleanup()
+		return err
+	}
+	return syncDir(dir)
+}
 
-	for _, m := range items {
-		switch m.MType {
-		case "gauge":
-			if m.Value == nil {
-				continue
-			}
-			storage.SetGauge(ctx, m.ID, *m.Value)
+// rotate сдвигает поколения: FilePath.N-1 → FilePath.N, …, FilePath → FilePath.1.
+func (fm *FileManager) rotate() error {
+	if fm.Generations <= 0 {
+		return nil
+	}
+	for i := fm.Generations - 1; i >= 0; i-- {
+		src := fm.generationPath(i)
+		if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := os.Rename(src, fm.generationPath(i+1)); err != nil {
+			return fmt.Errorf("filemanager: rotate %s: %w", src, err)
+		}
+	}
+	return nil
+}
 
-		case "counter":
-			if m.Delta == nil {
-				continue
-			}
-			want := *m.Delta
-			cur, ok := storage.GetCounter(ctx, m.ID)
-			var inc int64
-			if ok {
-				inc = want - cur // доводим до абсолютного занчения
-			} else {
-				inc = want
-			}
-			if inc != 0 {
-				storage.IncrementCounter(ctx, m.ID, inc)
+// generationPath возвращает путь к поколению n (0 — текущий файл).
+func (fm *FileManager) generationPath(n int) string {
+	if n == 0 {
+		return fm.FilePath
+	}
+	return fmt.Sprintf("%s.%d", fm.FilePath, n)
+}
+
+// LoadData восстанавливает хранилище из самого свежего валидного поколения снимка.
+// Если текущий файл повреждён (обрезан, не сходится контрольная сумма),
+// пробуются FilePath.1, FilePath.2 и т.д. Возвращает заголовок применённого снимка.
+func (fm *FileManager) LoadData(storage StorageInterface) (Header, error) {
+	if fm.FilePath == "" {
+		return Header{}, errors.New("filemanager: empty FilePath")
+	}
+
+	var errs []error
+	for i := 0; i <= fm.Generations; i++ {
+		path := fm.generationPath(i)
+		h, items, err := readSnapshot(path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("%s: %w", path, err))
 			}
+			continue
+		}
+		// counter в файле хранится абсолютным значением — доводим до него
+		if err := snapshot.Apply(context.Background(), storage, items, snapshot.ModeMerge); err != nil {
+			return h, err
+		}
+		return h, nil
+	}
+	if len(errs) == 0 {
+		return Header{}, fmt.Errorf("filemanager: no snapshot found: %w", os.ErrNotExist)
+	}
+	return Header{}, errors.Join(errs...)
+}
+
+// readSnapshot читает и проверяет один файл снимка (версии 1 или 2).
+func readSnapshot(path string) (Header, []dto.Metrics, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	data = bytes.TrimSpace(data)
+
+	// Версия 1: голый массив без заголовка и контрольной суммы
+	if len(data) > 0 && data[0] == '[' || bytes.Equal(data, []byte("null")) {
+		items, err := snapshot.Decode(bytes.NewReader(data), snapshot.FormatJSON)
+		if err != nil {
+			return Header{}, nil, err
 		}
+		return Header{Version: 1, Count: len(items), Path: path}, items, nil
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Header{}, nil, err
+	}
+	if env.Version != FormatVersion {
+		return Header{}, nil, fmt.Errorf("filemanager: unsupported snapshot version %d", env.Version)
+	}
+	sum := sha256.Sum256(env.Metrics)
+	if env.Checksum != "sha256:"+hex.EncodeToString(sum[:]) {
+		return Header{}, nil, ErrChecksum
+	}
+	items, err := snapshot.Decode(bytes.NewReader(env.Metrics), snapshot.FormatJSON)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	env.Header.Path = path
+	return env.Header, items, nil
+}
+
+// syncDir делает fsync каталога, чтобы rename пережил падение питания.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
 	}
 	return nil
 }
 
 func (fm *FileManager) RunBackup(interval time.Duration, storage StorageInterface) {
+	fm.RunBackupContext(context.Background(), interval, storage)
+}
+
+// RunBackupContext — как RunBackup, но останавливается и по отмене ctx
+// (в HA-режиме бэкап делает только лидер, пока он лидер).
+func (fm *FileManager) RunBackupContext(ctx context.Context, interval time.Duration, storage StorageInterface) {
 	if interval <= 0 {
 		return
 	}
@@ -115,6 +305,8 @@ func (fm *FileManager) RunBackup(interval time.Duration, storage StorageInterfac
 			_ = fm.SaveData(storage) // не паникуем на ошибках бэкапа
 		case <-fm.Done:
 			return
+		case <-ctx.Done():
+			return
 		}
 	}
 }
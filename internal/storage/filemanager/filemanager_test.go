@@ -0,0 +1,130 @@
+package filemanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/memstorage"
+)
+
+func TestSaveLoad_RoundTripWithHeader(t *testing.T) {
+	ctx := context.Background()
+	fm := New(filepath.Join(t.TempDir(), "metrics.json"))
+
+	src := memstorage.New()
+	require.NoError(t, src.SetGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, src.IncrementCounter(ctx, "PollCount", 42))
+	require.NoError(t, fm.SaveData(src))
+
+	dst := memstorage.New()
+	h, err := fm.LoadData(dst)
+	require.NoError(t, err)
+	assert.Equal(t, FormatVersion, h.Version)
+	assert.Equal(t, 2, h.Count)
+	assert.Contains(t, h.Checksum, "sha256:")
+
+	v, _, _ := dst.GetCounter(ctx, "PollCount")
+	assert.Equal(t, int64(42), v)
+
+	// временных файлов не остаётся
+	matches, _ := filepath.Glob(fm.FilePath + ".tmp-*")
+	assert.Empty(t, matches)
+}
+
+func TestLoad_FallsBackToPreviousGeneration(t *testing.T) {
+	ctx := context.Background()
+	fm := New(filepath.Join(t.TempDir(), "metrics.json"))
+	fm.Generations = 2
+
+	src := memstorage.New()
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, src.IncrementCounter(ctx, "PollCount", 1))
+		require.NoError(t, fm.SaveData(src))
+	}
+	_, err := os.Stat(fm.FilePath + ".2")
+	require.NoError(t, err)
+	_, err = os.Stat(fm.FilePath + ".3")
+	assert.True(t, os.IsNotExist(err), "only Generations rotated files are kept")
+
+	// имитируем падение посреди записи: текущий файл обрезан
+	data, err := os.ReadFile(fm.FilePath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fm.FilePath, data[:len(data)/2], 0o644))
+
+	dst := memstorage.New()
+	h, err := fm.LoadData(dst)
+	require.NoError(t, err)
+	assert.Equal(t, fm.FilePath+".1", h.Path)
+	v, _, _ := dst.GetCounter(ctx, "PollCount")
+	assert.Equal(t, int64(2), v)
+}
+
+func TestSaveCurrent_KeepsGenerations(t *testing.T) {
+	ctx := context.Background()
+	fm := New(filepath.Join(t.TempDir(), "metrics.json"))
+	fm.Generations = 2
+
+	src := memstorage.New()
+	require.NoError(t, fm.SaveData(src))
+	require.NoError(t, src.IncrementCounter(ctx, "PollCount", 1))
+	require.NoError(t, fm.SaveData(src))
+	gen1, err := os.ReadFile(fm.FilePath + ".1")
+	require.NoError(t, err)
+
+	// синхронный режим: много сохранений подряд не вытесняют поколения
+	for i := 0; i < 5; i++ {
+		require.NoError(t, src.IncrementCounter(ctx, "PollCount", 1))
+		require.NoError(t, fm.SaveCurrent(src))
+	}
+	got, err := os.ReadFile(fm.FilePath + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, gen1, got)
+	_, err = os.Stat(fm.FilePath + ".2")
+	assert.True(t, os.IsNotExist(err))
+
+	dst := memstorage.New()
+	_, err = fm.LoadData(dst)
+	require.NoError(t, err)
+	v, _, _ := dst.GetCounter(ctx, "PollCount")
+	assert.Equal(t, int64(6), v)
+}
+
+func TestLoad_DetectsChecksumMismatchAndLegacyFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	tampered := filepath.Join(dir, "tampered.json")
+	require.NoError(t, os.WriteFile(tampered,
+		[]byte(`{"version":2,"count":1,"checksum":"sha256:00","metrics":[{"id":"a","type":"gauge","value":1}]}`), 0o644))
+	_, err := New(tampered).LoadData(memstorage.New())
+	assert.ErrorIs(t, err, ErrChecksum)
+
+	legacy := filepath.Join(dir, "legacy.json")
+	require.NoError(t, os.WriteFile(legacy, []byte(`[{"id":"a","type":"gauge","value":1}]`), 0o644))
+	h, err := New(legacy).LoadData(memstorage.New())
+	require.NoError(t, err)
+	assert.Equal(t, 1, h.Version)
+
+	_, err = New(filepath.Join(dir, "missing.json")).LoadData(memstorage.New())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCheck_ReportsLastSaveResult(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fm := New(filepath.Join(dir, "missing", "metrics.json"))
+	store := memstorage.New()
+
+	assert.NoError(t, fm.Check(ctx), "no saves yet")
+	require.Error(t, fm.SaveData(store))
+	assert.Error(t, fm.Check(ctx))
+
+	// каталог появился — следующее сохранение снимает отказ
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "missing"), 0o755))
+	require.NoError(t, fm.SaveData(store))
+	assert.NoError(t, fm.Check(ctx))
+}
@@ -0,0 +1,259 @@
+// Package kvstorage — хранилище метрик на встраиваемой KV-базе bbolt.
+//
+// Каждому типу метрик отведён свой bucket (gauge, counter), значения хранятся
+// как 8 байт big-endian (для gauge — биты float64). Все изменения выполняются
+// в транзакциях bbolt: SetMetrics — одной транзакцией на батч, инкремент
+// counter — чтение и запись внутри одной транзакции записи, поэтому атомарен.
+package kvstorage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+)
+
+var (
+	bucketGauge   = []byte(consts.MetricTypeGauge)
+	bucketCounter = []byte(consts.MetricTypeCounter)
+)
+
+type KVStorage struct {
+	DB *bolt.DB
+}
+
+// Open открывает (или создаёт) файл базы по пути path и заводит bucket'ы.
+func Open(path string) (*KVStorage, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("kvstorage: open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{bucketGauge, bucketCounter} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("kvstorage: init buckets: %w", err)
+	}
+	return &KVStorage{DB: db}, nil
+}
+
+// Ping проверяет, что база открыта и читается.
+func (s *KVStorage) Ping(context.Context) error {
+	if err := s.DB.View(func(*bolt.Tx) error { return nil }); err != nil {
+		return readErr("ping", err)
+	}
+	return nil
+}
+
+// Close закрывает файл базы.
+func (s *KVStorage) Close() error {
+	return s.DB.Close()
+}
+
+func encodeGauge(v float64) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(v))
+}
+
+func decodeGauge(b []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
+
+func encodeCounter(v int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(v))
+}
+
+func decodeCounter(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// incr увеличивает counter внутри уже открытой транзакции записи.
+func incr(b *bolt.Bucket, name string, delta int64) error {
+	var cur int64
+	if v := b.Get([]byte(name)); v != nil {
+		cur = decodeCounter(v)
+	}
+	return b.Put([]byte(name), encodeCounter(cur+delta))
+}
+
+func (s *KVStorage) SetGauge(_ context.Context, name string, value float64) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketGauge).Put([]byte(name), encodeGauge(value))
+	})
+}
+
+func (s *KVStorage) IncrementCounter(_ context.Context, name string, value int64) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		return incr(tx.Bucket(bucketCounter), name, value)
+	})
+}
+
+func (s *KVStorage) GetGauge(_ context.Context, name string) (float64, bool, error) {
+	var (
+		val float64
+		ok  bool
+	)
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketGauge).Get([]byte(name)); v != nil {
+			val, ok = decodeGauge(v), true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, readErr("get gauge", err)
+	}
+	return val, ok, nil
+}
+
+func (s *KVStorage) GetCounter(_ context.Context, name string) (int64, bool, error) {
+	var (
+		val int64
+		ok  bool
+	)
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketCounter).Get([]byte(name)); v != nil {
+			val, ok = decodeCounter(v), true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, readErr("get counter", err)
+	}
+	return val, ok, nil
+}
+
+func (s *KVStorage) GetAllGauges(ctx context.Context) (map[string]float64, error) {
+	gauges, _, err := s.Snapshot(ctx)
+	if err != nil {
+		return nil, readErr("get all gauges", err)
+	}
+	return gauges, nil
+}
+
+func (s *KVStorage) GetAllCounters(ctx context.Context) (map[string]int64, error) {
+	_, counters, err := s.Snapshot(ctx)
+	if err != nil {
+		return nil, readErr("get all counters", err)
+	}
+	return counters, nil
+}
+
+// readErr оборачивает ошибку чтения; закрытая база помечается interfaces.ErrUnavailable.
+func readErr(op string, err error) error {
+	if errors.Is(err, berrors.ErrDatabaseNotOpen) {
+		return fmt.Errorf("%s: %w: %w", op, interfaces.ErrUnavailable, err)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// SetMetrics применяет весь батч в одной транзакции записи.
+// Батч с некорректной метрикой отклоняется целиком до применения.
+func (s *KVStorage) SetMetrics(_ context.Context, metrics []dto.Metrics) error {
+	if err := dto.ValidateBatch(metrics); err != nil {
+		return err
+	}
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		gauges, counters := tx.Bucket(bucketGauge), tx.Bucket(bucketCounter)
+		for _, metric := range metrics {
+			var err error
+			switch metric.MType {
+			case consts.MetricTypeCounter:
+				err = incr(counters, metric.ID, *metric.Delta)
+			case consts.MetricTypeGauge:
+				err = gauges.Put([]byte(metric.ID), encodeGauge(*metric.Value))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Snapshot читает оба bucket'а в одной транзакции чтения.
+func (s *KVStorage) Snapshot(_ context.Context) (map[string]float64, map[string]int64, error) {
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketGauge).ForEach(func(k, v []byte) error {
+			gauges[string(k)] = decodeGauge(v)
+			return nil
+		}); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketCounter).ForEach(func(k, v []byte) error {
+			counters[string(k)] = decodeCounter(v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return gauges, counters, nil
+}
+
+// Replace пересоздаёт bucket'ы и заполняет их в одной транзакции.
+func (s *KVStorage) Replace(_ context.Context, gauges map[string]float64, counters map[string]int64) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketGauge, bucketCounter} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		g, err := tx.CreateBucket(bucketGauge)
+		if err != nil {
+			return err
+		}
+		c, err := tx.CreateBucket(bucketCounter)
+		if err != nil {
+			return err
+		}
+		for id, v := range gauges {
+			if err := g.Put([]byte(id), encodeGauge(v)); err != nil {
+				return err
+			}
+		}
+		for id, v := range counters {
+			if err := c.Put([]byte(id), encodeCounter(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Merge записывает gauge и абсолютные значения counter в одной транзакции.
+func (s *KVStorage) Merge(_ context.Context, gauges map[string]float64, counters map[string]int64) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		g, c := tx.Bucket(bucketGauge), tx.Bucket(bucketCounter)
+		for id, v := range gauges {
+			if err := g.Put([]byte(id), encodeGauge(v)); err != nil {
+				return err
+			}
+		}
+		for id, v := range counters {
+			if err := c.Put([]byte(id), encodeCounter(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *KVStorage) StorageType() string {
+	return "kv"
+}
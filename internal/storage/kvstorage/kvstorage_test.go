@@ -0,0 +1,104 @@
+package kvstorage
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+)
+
+func TestKVStorage_PersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+
+	s, err := Open(path)
+	require.NoError(t, err)
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 1.5))
+	v, d := -2.25, int64(4)
+	require.NoError(t, s.SetMetrics(ctx, []dto.Metrics{
+		{ID: "Alloc", MType: "gauge", Value: &v},
+		{ID: "PollCount", MType: "counter", Delta: &d},
+		{ID: "PollCount", MType: "counter", Delta: &d},
+	}))
+	require.NoError(t, s.Close())
+
+	s, err = Open(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	g, ok, err := s.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, -2.25, g)
+	c, ok, err := s.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(8), c)
+	_, ok, err = s.GetCounter(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, s.Replace(ctx, map[string]float64{"new": 1}, nil))
+	gauges, err := s.GetAllGauges(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"new": 1}, gauges)
+	counters, err := s.GetAllCounters(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, counters)
+
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 3))
+	require.NoError(t, s.Merge(ctx, map[string]float64{"Alloc": 2}, map[string]int64{"PollCount": 10}))
+	gauges, _, err = s.Snapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"new": 1, "Alloc": 2}, gauges)
+	c, _, err = s.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), c, "merge sets the absolute value")
+}
+
+func TestKVStorage_ConcurrentIncrement(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.IncrementCounter(ctx, "hits", 1))
+		}()
+	}
+	wg.Wait()
+
+	c, _, err := s.GetCounter(ctx, "hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), c)
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.Store {
+		s, err := Open(filepath.Join(t.TempDir(), "metrics.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	})
+}
+
+func TestReadsFailOnClosedDB(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	storetest.RunFailing(t, s)
+	_, _, err = s.GetGauge(context.Background(), "Alloc")
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+}
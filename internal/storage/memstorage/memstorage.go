@@ -2,7 +2,6 @@ package memstorage
 
 import (
 	"context"
-	"log"
 	"sync"
 
 	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
@@ -38,21 +37,21 @@ func (s *MemStorage) SetGauge(_ context.Context, name string, value float64) err
 	return nil
 }
 
-func (s *MemStorage) GetCounter(_ context.Context, name string) (int64, bool) {
+func (s *MemStorage) GetCounter(_ context.Context, name string) (int64, bool, error) {
 	s.mu.RLock()
 	val, exists := s.Counters[name]
 	s.mu.RUnlock()
-	return int64(val), exists
+	return int64(val), exists, nil
 }
 
-func (s *MemStorage) GetGauge(_ context.Context, name string) (float64, bool) {
+func (s *MemStorage) GetGauge(_ context.Context, name string) (float64, bool, error) {
 	s.mu.RLock()
 	val, exists := s.Gauges[name]
 	s.mu.RUnlock()
-	return float64(val), exists
+	return float64(val), exists, nil
 }
 
-func (s *MemStorage) GetAllCounters(_ context.Context) map[string]int64 {
+func (s *MemStorage) GetAllCounters(_ context.Context) (map[string]int64, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -61,10 +60,10 @@ func (s *MemStorage) GetAllCounters(_ context.Context) map[string]int64 {
 	for k, v := range s.Counters {
 		result[k] = int64(v)
 	}
-	return result
+	return result, nil
 }
 
-func (s *MemStorage) GetAllGauges(_ context.Context) map[string]float64 {
+func (s *MemStorage) GetAllGauges(_ context.Context) (map[string]float64, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -73,7 +72,7 @@ func (s *MemStorage) GetAllGauges(_ context.Context) map[string]float64 {
 	for k, v := range s.Gauges {
 		result[k] = float64(v)
 	}
-	return result
+	return result, nil
 }
 
 // Если эти методы нужны интерфейсом — оставляем и делаем потокобезопасными
@@ -91,34 +90,74 @@ func (s *MemStorage) UpdateGauge(_ context.Context, name string, value metrics2.
 	return nil
 }
 
-// Батч-обновление: держим lock на время всего прохода (атоминее и быстрее)
+// Батч-обновление: держим lock на время всего прохода (атоминее и быстрее).
+// Батч с некорректной метрикой отклоняется целиком до применения.
 func (s *MemStorage) SetMetrics(_ context.Context, metrics []dto.Metrics) error {
+	if err := dto.ValidateBatch(metrics); err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for _, metric := range metrics {
 		switch metric.MType {
 		case consts.MetricTypeCounter:
-			if metric.Delta == nil {
-				log.Printf("counter %q has nil delta — skipped", metric.ID)
-				continue
-			}
 			s.Counters[metric.ID] += metrics2.Counter(*metric.Delta)
-
 		case consts.MetricTypeGauge:
-			if metric.Value == nil {
-				log.Printf("gauge %q has nil value — skipped", metric.ID)
-				continue
-			}
 			s.Gauges[metric.ID] = metrics2.Gauge(*metric.Value)
-
-		default:
-			log.Printf("Unknown metric type: %s (id=%s)", metric.MType, metric.ID)
 		}
 	}
 	return nil
 }
 
+// Snapshot возвращает копии gauge и counter, снятые под одной блокировкой.
+func (s *MemStorage) Snapshot(_ context.Context) (map[string]float64, map[string]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	gauges := make(map[string]float64, len(s.Gauges))
+	for k, v := range s.Gauges {
+		gauges[k] = float64(v)
+	}
+	counters := make(map[string]int64, len(s.Counters))
+	for k, v := range s.Counters {
+		counters[k] = int64(v)
+	}
+	return gauges, counters, nil
+}
+
+// Replace атомарно заменяет всё содержимое хранилища.
+func (s *MemStorage) Replace(_ context.Context, gauges map[string]float64, counters map[string]int64) error {
+	g := make(map[string]metrics2.Gauge, len(gauges))
+	for k, v := range gauges {
+		g[k] = metrics2.Gauge(v)
+	}
+	c := make(map[string]metrics2.Counter, len(counters))
+	for k, v := range counters {
+		c[k] = metrics2.Counter(v)
+	}
+
+	s.mu.Lock()
+	s.Gauges, s.Counters = g, c
+	s.mu.Unlock()
+	return nil
+}
+
+// Merge под одной блокировкой перезаписывает gauge и устанавливает counter
+// в абсолютные значения снимка.
+func (s *MemStorage) Merge(_ context.Context, gauges map[string]float64, counters map[string]int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range gauges {
+		s.Gauges[k] = metrics2.Gauge(v)
+	}
+	for k, v := range counters {
+		s.Counters[k] = metrics2.Counter(v)
+	}
+	return nil
+}
+
 func (s *MemStorage) StorageType() string {
 	return "ms"
 }
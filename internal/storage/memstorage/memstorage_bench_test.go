@@ -56,14 +56,14 @@ func BenchmarkMemStorage_GetCounter(b *testing.B) {
 
 	b.Run("single_thread", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			_, _ = storage.GetCounter(ctx, "test_counter")
+			_, _, _ = storage.GetCounter(ctx, "test_counter")
 		}
 	})
 
 	b.Run("parallel", func(b *testing.B) {
 		b.RunParallel(func(pb *testing.PB) {
 			for pb.Next() {
-				_, _ = storage.GetCounter(ctx, "test_counter")
+				_, _, _ = storage.GetCounter(ctx, "test_counter")
 			}
 		})
 	})
@@ -84,13 +84,13 @@ func BenchmarkMemStorage_GetAllMetrics(b *testing.B) {
 
 	b.Run("get_all_counters", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			_ = storage.GetAllCounters(ctx)
+			_, _ = storage.GetAllCounters(ctx)
 		}
 	})
 
 	b.Run("get_all_gauges", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			_ = storage.GetAllGauges(ctx)
+			_, _ = storage.GetAllGauges(ctx)
 		}
 	})
 }
@@ -0,0 +1,12 @@
+package memstorage
+
+import (
+	"testing"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.Store { return New() })
+}
@@ -0,0 +1,272 @@
+// Package sqlitestorage — хранилище метрик на SQLite (чистый Go, без cgo).
+//
+// Схема повторяет postgres.initDB: таблицы gauge и counter с id в качестве
+// первичного ключа. Семантика та же, что у dbstorage: upsert для gauge,
+// прибавление для counter, SetMetrics — одной транзакцией.
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "modernc.org/sqlite" // драйвер "sqlite"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+)
+
+const (
+	upsertGauge = `INSERT INTO gauge (id, value) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET value = excluded.value;`
+	upsertCounter = `INSERT INTO counter (id, value) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET value = counter.value + excluded.value;`
+	setCounter = `INSERT INTO counter (id, value) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET value = excluded.value;`
+)
+
+type SQLiteStorage struct {
+	DB *sql.DB
+}
+
+// Open открывает (или создаёт) файл базы по пути path и создаёт таблицы.
+// SQLite допускает одного писателя, поэтому пул ограничен одним соединением:
+// запись сериализуется в Go, а не через SQLITE_BUSY.
+func Open(path string) (*SQLiteStorage, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("sqlitestorage: open %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := initDB(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStorage{DB: db}, nil
+}
+
+// initDB создаёт таблицы, если их нет.
+func initDB(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS gauge (
+			id    varchar(256) PRIMARY KEY,
+			value double precision NOT NULL
+		);
+	`); err != nil {
+		return fmt.Errorf("create table gauge: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS counter (
+			id    varchar(256) PRIMARY KEY,
+			value BIGINT NOT NULL
+		);
+	`); err != nil {
+		return fmt.Errorf("create table counter: %w", err)
+	}
+	return nil
+}
+
+// Ping проверяет соединение с базой.
+func (s *SQLiteStorage) Ping(ctx context.Context) error {
+	if err := s.DB.PingContext(ctx); err != nil {
+		return readErr("ping", err)
+	}
+	return nil
+}
+
+// Close закрывает базу.
+func (s *SQLiteStorage) Close() error {
+	return s.DB.Close()
+}
+
+func (s *SQLiteStorage) SetGauge(ctx context.Context, metricName string, value float64) error {
+	_, err := s.DB.ExecContext(ctx, upsertGauge, metricName, value)
+	return err
+}
+
+func (s *SQLiteStorage) IncrementCounter(ctx context.Context, metricName string, value int64) error {
+	_, err := s.DB.ExecContext(ctx, upsertCounter, metricName, value)
+	return err
+}
+
+func (s *SQLiteStorage) GetGauge(ctx context.Context, metricName string) (float64, bool, error) {
+	var v float64
+	err := s.DB.QueryRowContext(ctx, `SELECT value FROM gauge WHERE id = ?;`, metricName).Scan(&v)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, readErr("get gauge", err)
+	}
+	return v, true, nil
+}
+
+func (s *SQLiteStorage) GetCounter(ctx context.Context, metricName string) (int64, bool, error) {
+	var v int64
+	err := s.DB.QueryRowContext(ctx, `SELECT value FROM counter WHERE id = ?;`, metricName).Scan(&v)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, readErr("get counter", err)
+	}
+	return v, true, nil
+}
+
+func (s *SQLiteStorage) GetAllGauges(ctx context.Context) (map[string]float64, error) {
+	gauges, _, err := s.Snapshot(ctx)
+	if err != nil {
+		return nil, readErr("get all gauges", err)
+	}
+	return gauges, nil
+}
+
+func (s *SQLiteStorage) GetAllCounters(ctx context.Context) (map[string]int64, error) {
+	_, counters, err := s.Snapshot(ctx)
+	if err != nil {
+		return nil, readErr("get all counters", err)
+	}
+	return counters, nil
+}
+
+// readErr оборачивает ошибку чтения; таймаут и потерянное соединение
+// помечаются interfaces.ErrUnavailable.
+func readErr(op string, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("%s: %w: %w", op, interfaces.ErrUnavailable, err)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// SetMetrics применяет весь батч в одной транзакции; при ошибке — откат.
+// Батч с некорректной метрикой отклоняется целиком до применения.
+func (s *SQLiteStorage) SetMetrics(ctx context.Context, metrics []dto.Metrics) error {
+	if err := dto.ValidateBatch(metrics); err != nil {
+		return err
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("set metrics: begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, metric := range metrics {
+		switch metric.MType {
+		case consts.MetricTypeGauge:
+			if _, err := tx.ExecContext(ctx, upsertGauge, metric.ID, *metric.Value); err != nil {
+				return fmt.Errorf("set metrics: gauge %q: %w", metric.ID, err)
+			}
+		case consts.MetricTypeCounter:
+			if _, err := tx.ExecContext(ctx, upsertCounter, metric.ID, *metric.Delta); err != nil {
+				return fmt.Errorf("set metrics: counter %q: %w", metric.ID, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Snapshot читает обе таблицы в одной транзакции.
+func (s *SQLiteStorage) Snapshot(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshot: begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	gauges := make(map[string]float64)
+	if err := scanAll(ctx, tx, `SELECT id, value FROM gauge;`, func(rows *sql.Rows) error {
+		var id string
+		var v float64
+		if err := rows.Scan(&id, &v); err != nil {
+			return err
+		}
+		gauges[id] = v
+		return nil
+	}); err != nil {
+		return nil, nil, fmt.Errorf("snapshot: gauge: %w", err)
+	}
+
+	counters := make(map[string]int64)
+	if err := scanAll(ctx, tx, `SELECT id, value FROM counter;`, func(rows *sql.Rows) error {
+		var id string
+		var v int64
+		if err := rows.Scan(&id, &v); err != nil {
+			return err
+		}
+		counters[id] = v
+		return nil
+	}); err != nil {
+		return nil, nil, fmt.Errorf("snapshot: counter: %w", err)
+	}
+
+	return gauges, counters, tx.Commit()
+}
+
+func scanAll(ctx context.Context, tx *sql.Tx, q string, scan func(*sql.Rows) error) error {
+	rows, err := tx.QueryContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Replace в одной транзакции очищает таблицы и записывает новое содержимое.
+func (s *SQLiteStorage) Replace(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("replace: begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM gauge;`); err != nil {
+		return fmt.Errorf("replace: clear gauge: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM counter;`); err != nil {
+		return fmt.Errorf("replace: clear counter: %w", err)
+	}
+	for id, v := range gauges {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO gauge (id, value) VALUES (?, ?);`, id, v); err != nil {
+			return fmt.Errorf("replace: insert gauge %q: %w", id, err)
+		}
+	}
+	for id, v := range counters {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO counter (id, value) VALUES (?, ?);`, id, v); err != nil {
+			return fmt.Errorf("replace: insert counter %q: %w", id, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Merge в одной транзакции записывает gauge и абсолютные значения counter.
+func (s *SQLiteStorage) Merge(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return readErr("merge: begin", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for id, v := range gauges {
+		if _, err := tx.ExecContext(ctx, upsertGauge, id, v); err != nil {
+			return readErr(fmt.Sprintf("merge: gauge %q", id), err)
+		}
+	}
+	for id, v := range counters {
+		if _, err := tx.ExecContext(ctx, setCounter, id, v); err != nil {
+			return readErr(fmt.Sprintf("merge: counter %q", id), err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) StorageType() string {
+	return "sqlite"
+}
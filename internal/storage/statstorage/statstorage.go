@@ -0,0 +1,119 @@
+// Package statstorage — декоратор interfaces.Store, замеряющий операции хранилища.
+//
+// Длительность каждой операции попадает в self-метрику storage.<операция>
+// (см. selfmetrics), неудачные операции — в счётчик storage.<операция>.errors.
+package statstorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
+	"github.com/SamSafonov2025/metrics-tpl/internal/snapshot"
+)
+
+// Store замеряет операции внутреннего хранилища.
+type Store struct {
+	interfaces.Store
+	reg *selfmetrics.Registry
+}
+
+// New оборачивает inner; замеры пишутся в reg.
+func New(inner interfaces.Store, reg *selfmetrics.Registry) *Store {
+	return &Store{Store: inner, reg: reg}
+}
+
+// observe записывает длительность операции op, начатой в start, и её отказ.
+func (s *Store) observe(op string, start time.Time, err error) {
+	s.reg.Observe("storage."+op, time.Since(start))
+	if err != nil {
+		s.reg.Add("storage."+op+".errors", 1)
+	}
+}
+
+func (s *Store) SetGauge(ctx context.Context, name string, value float64) error {
+	start := time.Now()
+	err := s.Store.SetGauge(ctx, name, value)
+	s.observe("set_gauge", start, err)
+	return err
+}
+
+func (s *Store) IncrementCounter(ctx context.Context, name string, value int64) error {
+	start := time.Now()
+	err := s.Store.IncrementCounter(ctx, name, value)
+	s.observe("increment_counter", start, err)
+	return err
+}
+
+func (s *Store) SetMetrics(ctx context.Context, items []dto.Metrics) error {
+	start := time.Now()
+	err := s.Store.SetMetrics(ctx, items)
+	s.observe("set_metrics", start, err)
+	return err
+}
+
+func (s *Store) GetGauge(ctx context.Context, name string) (float64, bool, error) {
+	start := time.Now()
+	v, ok, err := s.Store.GetGauge(ctx, name)
+	s.observe("get_gauge", start, err)
+	return v, ok, err
+}
+
+func (s *Store) GetCounter(ctx context.Context, name string) (int64, bool, error) {
+	start := time.Now()
+	v, ok, err := s.Store.GetCounter(ctx, name)
+	s.observe("get_counter", start, err)
+	return v, ok, err
+}
+
+func (s *Store) GetAllGauges(ctx context.Context) (map[string]float64, error) {
+	start := time.Now()
+	v, err := s.Store.GetAllGauges(ctx)
+	s.observe("get_all_gauges", start, err)
+	return v, err
+}
+
+func (s *Store) GetAllCounters(ctx context.Context) (map[string]int64, error) {
+	start := time.Now()
+	v, err := s.Store.GetAllCounters(ctx)
+	s.observe("get_all_counters", start, err)
+	return v, err
+}
+
+// Snapshot возвращает согласованный снимок внутреннего хранилища.
+func (s *Store) Snapshot(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	start := time.Now()
+	gauges, counters, err := snapshot.Read(ctx, s.Store)
+	s.observe("snapshot", start, err)
+	return gauges, counters, err
+}
+
+// Replace заменяет содержимое внутреннего хранилища.
+func (s *Store) Replace(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	rp, ok := s.Store.(interfaces.Replacer)
+	if !ok {
+		return snapshot.ErrReplaceUnsupported
+	}
+	start := time.Now()
+	err := rp.Replace(ctx, gauges, counters)
+	s.observe("replace", start, err)
+	return err
+}
+
+// Merge сливает снимок с внутренним хранилищем.
+func (s *Store) Merge(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	mg, ok := s.Store.(interfaces.Merger)
+	if !ok {
+		return snapshot.ErrMergeUnsupported
+	}
+	start := time.Now()
+	err := mg.Merge(ctx, gauges, counters)
+	s.observe("merge", start, err)
+	return err
+}
+
+func (s *Store) StorageType() string {
+	return s.Store.StorageType() + "+stats"
+}
@@ -0,0 +1,45 @@
+package statstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/selfmetrics"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/memstorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.Store { return New(memstorage.New(), selfmetrics.New()) })
+}
+
+func TestObservesOperations(t *testing.T) {
+	ctx := context.Background()
+	reg := selfmetrics.New()
+	s := New(memstorage.New(), reg)
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 1))
+	_, _, err := s.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+
+	failing := New(storetest.Failing{Err: interfaces.ErrUnavailable}, reg)
+	_, err = failing.GetAllGauges(ctx)
+	assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+
+	got := map[string]bool{}
+	for _, m := range reg.Collect() {
+		got[m.ID] = true
+	}
+	for _, id := range []string{
+		"server.storage.set_gauge.count",
+		"server.storage.get_gauge.avg_ms",
+		"server.storage.get_all_gauges.max_ms",
+		"server.storage.get_all_gauges.errors",
+	} {
+		assert.True(t, got[id], id)
+	}
+	assert.False(t, got["server.storage.get_gauge.errors"])
+}
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"log"
+	"os"
 	"sync"
+	"time"
 
 	metrics2 "github.com/SamSafonov2025/metrics-tpl/internal/metrics"
 	"github.com/SamSafonov2025/metrics-tpl/internal/postgres"
@@ -11,9 +15,15 @@ import (
 
 	"github.com/SamSafonov2025/metrics-tpl/internal/config"
 	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/cachestorage"
 	"github.com/SamSafonov2025/metrics-tpl/internal/storage/dbstorage"
 	"github.com/SamSafonov2025/metrics-tpl/internal/storage/filemanager"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/kvstorage"
 	"github.com/SamSafonov2025/metrics-tpl/internal/storage/memstorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/sqlitestorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/syncstorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/wal"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/walstorage"
 )
 
 // Общий интерфейс стораджа (совпадает с тем, что использует FileManager)
@@ -23,21 +33,51 @@ var (
 	once     sync.Once
 	curFM    *filemanager.FileManager
 	curStore interfaces.Store
+	curWAL   *wal.Log
+	curEmbed embedded // встраиваемая база (kv, sqlite), закрывается в Close
+	curDB    bool     // backend — PostgreSQL (для Ping)
+	curCache *cachestorage.Store
+	curHA    bool // HA-режим: FileManager ведёт только лидер
+)
+
+// embedded — встраиваемая база: kvstorage или sqlitestorage.
+type embedded interface {
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Backend-ы, выбираемые через cfg.Storage (-storage / STORAGE).
+const (
+	BackendMemory = "memory" // только память, без файла
+	BackendFile   = "file"   // память + снимки в cfg.FileStoragePath (WAL, sync-режим)
+	BackendDB     = "db"     // PostgreSQL по cfg.Database
+	BackendKV     = "kv"     // встраиваемая bbolt-база в cfg.KVPath
+	BackendSQLite = "sqlite" // SQLite в cfg.SQLitePath
 )
 
 // NewStorage — единая точка инициализации стораджа + FileManager из конфигурации.
-// Выбор backend-а:
-//   - если cfg.Database непустой и подключение успешно → dbstorage (PostgreSQL),
-//   - иначе → memstorage.
+// Выбор backend-а — по cfg.Storage (см. Backend*); если он не задан:
+//   - если cfg.Database непустой → db,
+//   - иначе → file.
 //
-// Также: делает restore (если cfg.Restore) и запускает бэкап (если cfg.StoreInterval>0),
-// либо выполняет разовый сейв на старте, если задан cfg.FileStoragePath и интервал = 0.
+// Если PostgreSQL, KV или SQLite открыть не удалось, откатываемся на file.
+//
+// kv и sqlite долговечны сами по себе и файловые снимки не используют.
+// Для file и db: делает restore (если cfg.Restore) и запускает бэкап (если cfg.StoreInterval>0).
+// При интервале 0 (синхронный режим) in-memory хранилище сохраняется в
+// cfg.FileStoragePath после каждого изменения (см. syncstorage).
+// С cfg.WAL и интервалом > 0 in-memory хранилище журналирует изменения в FileStoragePath+".wal";
+// при restore журнал проигрывается поверх снимка, каждый снимок его компактифицирует.
+// С cfg.CacheTTL > 0 dbstorage оборачивается кешем чтений (см. Cache).
+// С cfg.HA и backend-ом db restore не выполняется, а бэкап не запускается:
+// им управляет лидер (см. FileManager и пакет leader).
 //
 // Вызывайте один раз. Повторные вызовы вернут уже созданный store.
 func NewStorage(cfg *config.ServerConfig) interfaces.Store {
 	once.Do(func() {
-		// Выбор реализации ТОЛЬКО по cfg.Database (никакой магии от чужого Pool)
-		if cfg.Database != "" {
+		backend := resolveBackend(cfg)
+		switch backend {
+		case BackendDB:
 			if postgres.Pool == nil {
 				if _, err := postgres.Connect(cfg.Database); err != nil {
 					// логируем и мягко откатываемся на in-memory
@@ -45,36 +85,177 @@ func NewStorage(cfg *config.ServerConfig) interfaces.Store {
 				}
 			}
 			if postgres.Pool != nil {
+				curDB = true
 				curStore = NewDB(postgres.Pool)
 			} else {
+				backend = BackendFile
 				curStore = NewMem()
 			}
-		} else {
+		case BackendKV:
+			kv, err := kvstorage.Open(cfg.KVPath)
+			if err != nil {
+				log.Printf("storage: kv open failed, fallback to memstorage: %v", err)
+				backend = BackendFile
+				curStore = NewMem()
+			} else {
+				curEmbed = kv
+				curStore = kv
+			}
+		case BackendSQLite:
+			lite, err := sqlitestorage.Open(cfg.SQLitePath)
+			if err != nil {
+				log.Printf("storage: sqlite open failed, fallback to memstorage: %v", err)
+				backend = BackendFile
+				curStore = NewMem()
+			} else {
+				curEmbed = lite
+				curStore = lite
+			}
+		default:
 			// Явно in-memory для тестов/локалки без БД,
 			// даже если где-то уже инициализировали глобальный Pool.
 			curStore = NewMem()
 		}
 
+		// kv и sqlite долговечны сами по себе, memory — намеренно без файла
+		if backend == BackendMemory || backend == BackendKV || backend == BackendSQLite {
+			return
+		}
+
 		// FileManager + restore/backup
 		curFM = filemanager.New(cfg.FileStoragePath)
-		if cfg.Restore {
-			_ = curFM.LoadData(curStore)
+		curFM.Generations = cfg.StoreGenerations
+		if backend == BackendDB && cfg.HA {
+			// БД — общее состояние реплик: restore из файла затёр бы их данные,
+			// периодический бэкап запускает только лидер (см. FileManager), финального сейва нет
+			curHA = true
+		} else {
+			setupFile(cfg, backend)
 		}
-		if cfg.StoreInterval > 0 {
-			go curFM.RunBackup(cfg.StoreInterval, curStore)
-		} else if cfg.FileStoragePath != "" {
-			_ = curFM.SaveData(curStore)
+
+		// кеш чтений имеет смысл только перед БД
+		if _, db := curStore.(*dbstorage.DBStorage); db && cfg.CacheTTL > 0 {
+			curCache = cachestorage.New(curStore, cfg.CacheTTL)
+			curStore = curCache
 		}
 	})
 	return curStore
 }
 
+// setupFile делает restore из файла и запускает бэкап (или синхронный режим, или WAL).
+func setupFile(cfg *config.ServerConfig, backend string) {
+	if cfg.Restore {
+		restore(curFM, curStore)
+	}
+	mem := backend != BackendDB
+	if cfg.StoreInterval > 0 {
+		// в синхронном режиме журнал не нужен: снимок пишется на каждое изменение
+		if mem && cfg.WAL && cfg.FileStoragePath != "" {
+			curStore = withWAL(cfg, curStore)
+		}
+		go curFM.RunBackup(cfg.StoreInterval, curStore)
+	} else if cfg.FileStoragePath != "" {
+		_ = curFM.SaveData(curStore)
+		if mem {
+			curStore = withSync(curFM, curStore)
+		}
+	}
+}
+
+// FileManager возвращает FileManager, созданный NewStorage, или nil.
+// В HA-режиме его периодический бэкап запускает лидер через RunBackupContext.
+func FileManager() *filemanager.FileManager {
+	return curFM
+}
+
+// Ping проверяет доступность хранилища, созданного NewStorage:
+// пул PostgreSQL или файл встраиваемой базы. Хранилище в памяти доступно всегда.
+func Ping(ctx context.Context) error {
+	switch {
+	case curDB:
+		return postgres.Ping(ctx)
+	case curEmbed != nil:
+		return curEmbed.Ping(ctx)
+	}
+	return nil
+}
+
+// Cache возвращает кеш чтений, созданный NewStorage, или nil, если он выключен.
+func Cache() *cachestorage.Store {
+	return curCache
+}
+
+// resolveBackend возвращает backend из cfg.Storage или выводит его по cfg.Database.
+func resolveBackend(cfg *config.ServerConfig) string {
+	switch cfg.Storage {
+	case BackendMemory, BackendFile, BackendDB, BackendKV, BackendSQLite:
+		return cfg.Storage
+	case "":
+	default:
+		log.Printf("storage: unknown backend %q, choosing by database DSN", cfg.Storage)
+	}
+	if cfg.Database != "" {
+		return BackendDB
+	}
+	return BackendFile
+}
+
+// restore загружает самый свежий валидный снимок и сообщает, какой именно.
+func restore(fm *filemanager.FileManager, store interfaces.Store) {
+	h, err := fm.LoadData(store)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		log.Printf("storage: nothing to restore from %s", fm.FilePath)
+	case err != nil:
+		log.Printf("storage: restore from %s failed: %v", fm.FilePath, err)
+	default:
+		log.Printf("storage: restored %d metrics from %s (version=%d created_at=%s checksum=%s)",
+			h.Count, h.Path, h.Version, h.CreatedAt.Format(time.RFC3339), h.Checksum)
+	}
+}
+
+// withSync оборачивает store синхронным сохранением через fm. Поколения
+// сдвигаются только при сохранении на старте и при остановке.
+func withSync(fm *filemanager.FileManager, store interfaces.Store) interfaces.Store {
+	return syncstorage.New(store, func() error { return fm.SaveCurrent(store) })
+}
+
+// withWAL открывает журнал и оборачивает им store. При restore журнал
+// проигрывается поверх уже загруженного снимка, иначе — отбрасывается.
+// Если журнал открыть не удалось, работаем без него.
+func withWAL(cfg *config.ServerConfig, store interfaces.Store) interfaces.Store {
+	path := cfg.FileStoragePath + ".wal"
+	if cfg.Restore {
+		n, err := walstorage.Replay(context.Background(), store, path)
+		if err != nil {
+			log.Printf("storage: wal replay from %s stopped after %d records: %v", path, n, err)
+		} else {
+			log.Printf("storage: replayed %d wal records from %s", n, path)
+		}
+	}
+
+	l, err := wal.Open(path, cfg.WALFsync, cfg.WALFsyncInterval)
+	if err != nil {
+		log.Printf("storage: wal disabled: %v", err)
+		return store
+	}
+	if !cfg.Restore {
+		if err := l.Truncate(); err != nil {
+			log.Printf("storage: wal truncate failed: %v", err)
+		}
+	}
+	curWAL = l
+	return walstorage.New(store, l)
+}
+
 // Close — аккуратно завершает FileManager и соединение с БД.
 // Рекомендуется вызывать в main: defer storage.Close()
 func Close() {
-	if curFM != nil && curStore != nil {
+	if curFM != nil && curStore != nil && !curHA {
 		curFM.Close(curStore)
 	}
+	closeWAL()
+	closeEmbedded()
 	if postgres.Pool != nil {
 		postgres.Close()
 	}
@@ -82,6 +263,22 @@ func Close() {
 
 // --- Вспомогательные фабрики (если нужно напрямую) ---
 
+// closeWAL закрывает журнал после финального снимка.
+func closeWAL() {
+	if curWAL != nil {
+		_ = curWAL.Close()
+		curWAL = nil
+	}
+}
+
+// closeEmbedded закрывает файл встраиваемой базы.
+func closeEmbedded() {
+	if curEmbed != nil {
+		_ = curEmbed.Close()
+		curEmbed = nil
+	}
+}
+
 func NewMem() interfaces.Store {
 	return &memstorage.MemStorage{
 		Counters: make(map[string]metrics2.Counter),
@@ -94,9 +291,14 @@ func NewDB(pool *pgxpool.Pool) interfaces.Store {
 }
 
 func TestReset() {
-	if curFM != nil && curStore != nil {
+	if curFM != nil && curStore != nil && !curHA {
 		curFM.Close(curStore)
 	}
+	closeWAL()
+	closeEmbedded()
+	curCache = nil
+	curDB = false
+	curHA = false
 	curFM = nil
 	curStore = nil
 	once = sync.Once{}
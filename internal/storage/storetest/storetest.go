@@ -0,0 +1,256 @@
+// Package storetest — общий набор поведенческих тестов для реализаций interfaces.Store.
+//
+// Новый backend подключается одной строкой в своём _test.go:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) interfaces.Store { return New() })
+//	}
+//
+// newStore вызывается для каждого подтеста и должен возвращать пустое хранилище.
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+)
+
+// LargeBatch — размер батча в проверке больших SetMetrics.
+const LargeBatch = 5000
+
+// Run прогоняет весь набор проверок на хранилищах, создаваемых newStore.
+func Run(t *testing.T, newStore func(t *testing.T) interfaces.Store) {
+	t.Helper()
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s interfaces.Store)
+	}{
+		{"GaugeOverwrites", testGaugeOverwrites},
+		{"CounterAccumulates", testCounterAccumulates},
+		{"NotFound", testNotFound},
+		{"ConcurrentIncrements", testConcurrentIncrements},
+		{"SetMetricsAppliesBatch", testSetMetricsAppliesBatch},
+		{"SetMetricsAtomicOnBadInput", testSetMetricsAtomicOnBadInput},
+		{"GetAllReturnsCopies", testGetAllReturnsCopies},
+		{"LargeBatch", testLargeBatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// RunFailing проверяет, что хранилище, у которого отказал backend
+// (закрытая база, недоступный пул соединений), сообщает об этом ошибкой
+// на каждом чтении, а не выдаёт пустой результат за «метрика не найдена».
+func RunFailing(t *testing.T, s interfaces.Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, ok, err := s.GetGauge(ctx, "Alloc")
+	assert.Error(t, err, "GetGauge")
+	assert.False(t, ok)
+	_, ok, err = s.GetCounter(ctx, "PollCount")
+	assert.Error(t, err, "GetCounter")
+	assert.False(t, ok)
+	_, err = s.GetAllGauges(ctx)
+	assert.Error(t, err, "GetAllGauges")
+	_, err = s.GetAllCounters(ctx)
+	assert.Error(t, err, "GetAllCounters")
+}
+
+func getGauge(t *testing.T, s interfaces.Store, name string) (float64, bool) {
+	t.Helper()
+	v, ok, err := s.GetGauge(context.Background(), name)
+	require.NoError(t, err)
+	return v, ok
+}
+
+func getCounter(t *testing.T, s interfaces.Store, name string) (int64, bool) {
+	t.Helper()
+	v, ok, err := s.GetCounter(context.Background(), name)
+	require.NoError(t, err)
+	return v, ok
+}
+
+func getAllGauges(t *testing.T, s interfaces.Store) map[string]float64 {
+	t.Helper()
+	v, err := s.GetAllGauges(context.Background())
+	require.NoError(t, err)
+	return v
+}
+
+func getAllCounters(t *testing.T, s interfaces.Store) map[string]int64 {
+	t.Helper()
+	v, err := s.GetAllCounters(context.Background())
+	require.NoError(t, err)
+	return v
+}
+
+func gauge(id string, v float64) dto.Metrics {
+	return dto.Metrics{ID: id, MType: consts.MetricTypeGauge, Value: &v}
+}
+
+func counter(id string, d int64) dto.Metrics {
+	return dto.Metrics{ID: id, MType: consts.MetricTypeCounter, Delta: &d}
+}
+
+func testGaugeOverwrites(t *testing.T, s interfaces.Store) {
+	ctx := context.Background()
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, s.SetGauge(ctx, "Alloc", -0.25))
+
+	v, ok := getGauge(t, s, "Alloc")
+	assert.True(t, ok)
+	assert.Equal(t, -0.25, v)
+}
+
+func testCounterAccumulates(t *testing.T, s interfaces.Store) {
+	ctx := context.Background()
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 5))
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 7))
+
+	v, ok := getCounter(t, s, "PollCount")
+	assert.True(t, ok)
+	assert.Equal(t, int64(12), v)
+}
+
+func testNotFound(t *testing.T, s interfaces.Store) {
+	ctx := context.Background()
+	_, ok := getGauge(t, s, "missing")
+	assert.False(t, ok)
+	_, ok = getCounter(t, s, "missing")
+	assert.False(t, ok)
+
+	// одноимённые метрики разных типов не пересекаются
+	require.NoError(t, s.SetGauge(ctx, "shared", 1))
+	_, ok = getCounter(t, s, "shared")
+	assert.False(t, ok)
+
+	assert.Empty(t, getAllCounters(t, s))
+}
+
+func testConcurrentIncrements(t *testing.T, s interfaces.Store) {
+	ctx := context.Background()
+	const workers, perWorker = 16, 25
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				if j%2 == 0 {
+					assert.NoError(t, s.IncrementCounter(ctx, "hits", 1))
+				} else {
+					assert.NoError(t, s.SetMetrics(ctx, []dto.Metrics{counter("hits", 1)}))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, ok := getCounter(t, s, "hits")
+	assert.True(t, ok)
+	assert.Equal(t, int64(workers*perWorker), v)
+}
+
+func testSetMetricsAppliesBatch(t *testing.T, s interfaces.Store) {
+	ctx := context.Background()
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 1))
+	require.NoError(t, s.SetMetrics(ctx, []dto.Metrics{
+		gauge("Alloc", 1),
+		gauge("Alloc", 2),
+		counter("PollCount", 3),
+		counter("PollCount", 4),
+	}))
+
+	g, _ := getGauge(t, s, "Alloc")
+	assert.Equal(t, 2.0, g, "last gauge in a batch wins")
+	c, _ := getCounter(t, s, "PollCount")
+	assert.Equal(t, int64(8), c, "counters in a batch are summed")
+}
+
+func testSetMetricsAtomicOnBadInput(t *testing.T, s interfaces.Store) {
+	ctx := context.Background()
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 1))
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 1))
+
+	bad := [][]dto.Metrics{
+		{gauge("Alloc", 2), counter("PollCount", 5), {ID: "broken", MType: consts.MetricTypeGauge}},
+		{counter("PollCount", 5), {ID: "broken", MType: consts.MetricTypeCounter}},
+		{gauge("Alloc", 2), {ID: "broken", MType: "histogram"}},
+	}
+	for i, batch := range bad {
+		err := s.SetMetrics(ctx, batch)
+		assert.ErrorIs(t, err, dto.ErrInvalidMetric, "batch #%d", i)
+	}
+
+	g, _ := getGauge(t, s, "Alloc")
+	assert.Equal(t, 1.0, g)
+	c, _ := getCounter(t, s, "PollCount")
+	assert.Equal(t, int64(1), c)
+	_, ok := getGauge(t, s, "broken")
+	assert.False(t, ok)
+}
+
+func testGetAllReturnsCopies(t *testing.T, s interfaces.Store) {
+	ctx := context.Background()
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 1))
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 1))
+
+	gauges := getAllGauges(t, s)
+	counters := getAllCounters(t, s)
+	gauges["Alloc"] = 100
+	gauges["injected"] = 1
+	counters["PollCount"] = 100
+
+	assert.Equal(t, map[string]float64{"Alloc": 1}, getAllGauges(t, s))
+	assert.Equal(t, map[string]int64{"PollCount": 1}, getAllCounters(t, s))
+}
+
+func testLargeBatch(t *testing.T, s interfaces.Store) {
+	ctx := context.Background()
+	batch := make([]dto.Metrics, 0, LargeBatch)
+	for i := 0; i < LargeBatch/2; i++ {
+		batch = append(batch, gauge(fmt.Sprintf("g%d", i), float64(i)), counter(fmt.Sprintf("c%d", i%100), 1))
+	}
+	require.NoError(t, s.SetMetrics(ctx, batch))
+
+	assert.Len(t, getAllGauges(t, s), LargeBatch/2)
+	counters := getAllCounters(t, s)
+	require.Len(t, counters, 100)
+	assert.Equal(t, int64(LargeBatch/2/100), counters["c0"])
+}
+
+// Failing — заглушка interfaces.Store, у которой любая операция
+// завершается ошибкой Err. Подменяет отказавший backend в тестах
+// вышележащих слоёв (декораторы, сервис, HTTP-обработчики).
+type Failing struct {
+	Err error
+}
+
+func (f Failing) StorageType() string { return "failing" }
+
+func (f Failing) SetMetrics(context.Context, []dto.Metrics) error { return f.Err }
+
+func (f Failing) SetGauge(context.Context, string, float64) error { return f.Err }
+
+func (f Failing) IncrementCounter(context.Context, string, int64) error { return f.Err }
+
+func (f Failing) GetGauge(context.Context, string) (float64, bool, error) { return 0, false, f.Err }
+
+func (f Failing) GetCounter(context.Context, string) (int64, bool, error) { return 0, false, f.Err }
+
+func (f Failing) GetAllGauges(context.Context) (map[string]float64, error) { return nil, f.Err }
+
+func (f Failing) GetAllCounters(context.Context) (map[string]int64, error) { return nil, f.Err }
@@ -0,0 +1,109 @@
+// Package syncstorage — декоратор interfaces.Store для синхронного режима (STORE_INTERVAL=0).
+//
+// После каждого изменяющего вызова (SetGauge, IncrementCounter, Replace,
+// а для SetMetrics — один раз на батч) хранилище сохраняется на диск.
+// Если сохранить не удалось, вызов возвращает ошибку с ErrPersist:
+// изменение уже применено в памяти, но клиент не получает подтверждения
+// и может повторить запрос.
+package syncstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/snapshot"
+)
+
+// ErrPersist оборачивает ошибку сохранения снимка после изменения.
+var ErrPersist = errors.New("syncstorage: persist failed")
+
+// Store сохраняет внутреннее хранилище после каждого изменения.
+type Store struct {
+	interfaces.Store // чтение делегируется как есть
+
+	save func() error
+	mu   sync.Mutex // сериализует изменения и сохранение, чтобы снимки шли по порядку
+}
+
+// New оборачивает inner; save вызывается после каждого изменения
+// (обычно — сохранение inner через filemanager.FileManager).
+func New(inner interfaces.Store, save func() error) *Store {
+	return &Store{Store: inner, save: save}
+}
+
+func (s *Store) persist() error {
+	if err := s.save(); err != nil {
+		return fmt.Errorf("%w: %w", ErrPersist, err)
+	}
+	return nil
+}
+
+func (s *Store) SetGauge(ctx context.Context, name string, value float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Store.SetGauge(ctx, name, value); err != nil {
+		return err
+	}
+	return s.persist()
+}
+
+func (s *Store) IncrementCounter(ctx context.Context, name string, value int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Store.IncrementCounter(ctx, name, value); err != nil {
+		return err
+	}
+	return s.persist()
+}
+
+func (s *Store) SetMetrics(ctx context.Context, items []dto.Metrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Store.SetMetrics(ctx, items); err != nil {
+		return err
+	}
+	return s.persist()
+}
+
+// Snapshot возвращает согласованный снимок внутреннего хранилища.
+func (s *Store) Snapshot(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	return snapshot.Read(ctx, s.Store)
+}
+
+// Replace заменяет содержимое внутреннего хранилища и сохраняет результат.
+func (s *Store) Replace(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	rp, ok := s.Store.(interfaces.Replacer)
+	if !ok {
+		return snapshot.ErrReplaceUnsupported
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := rp.Replace(ctx, gauges, counters); err != nil {
+		return err
+	}
+	return s.persist()
+}
+
+// Merge сливает снимок с внутренним хранилищем и сохраняет результат.
+func (s *Store) Merge(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	mg, ok := s.Store.(interfaces.Merger)
+	if !ok {
+		return snapshot.ErrMergeUnsupported
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := mg.Merge(ctx, gauges, counters); err != nil {
+		return err
+	}
+	return s.persist()
+}
+
+func (s *Store) StorageType() string {
+	return s.Store.StorageType() + "+sync"
+}
@@ -0,0 +1,60 @@
+package syncstorage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/filemanager"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/memstorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+)
+
+func TestPersistsAfterEveryMutation(t *testing.T) {
+	ctx := context.Background()
+	saves := 0
+	s := New(memstorage.New(), func() error { saves++; return nil })
+
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 1))
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 1))
+	assert.Equal(t, 2, saves)
+
+	// батч сохраняется один раз
+	v, d := 2.0, int64(3)
+	require.NoError(t, s.SetMetrics(ctx, []dto.Metrics{
+		{ID: "Alloc", MType: "gauge", Value: &v},
+		{ID: "PollCount", MType: "counter", Delta: &d},
+	}))
+	assert.Equal(t, 3, saves)
+
+	// чтение не сохраняет
+	_, _, _ = s.GetCounter(ctx, "PollCount")
+	assert.Equal(t, 3, saves)
+	assert.Equal(t, "ms+sync", s.StorageType())
+}
+
+func TestPersistFailureIsReported(t *testing.T) {
+	ctx := context.Background()
+	diskFull := errors.New("no space left on device")
+	s := New(memstorage.New(), func() error { return diskFull })
+
+	err := s.SetGauge(ctx, "Alloc", 1)
+	assert.ErrorIs(t, err, ErrPersist)
+	assert.ErrorIs(t, err, diskFull)
+	assert.ErrorIs(t, s.Replace(ctx, nil, nil), ErrPersist)
+}
+
+// TestConformance — backend "file" в синхронном режиме: память + снимок на каждое изменение.
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.Store {
+		inner := memstorage.New()
+		fm := filemanager.New(filepath.Join(t.TempDir(), "metrics.json"))
+		return New(inner, func() error { return fm.SaveData(inner) })
+	})
+}
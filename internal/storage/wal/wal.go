@@ -0,0 +1,298 @@
+// Package wal реализует журнал упреждающей записи (write-ahead log) для in-memory хранилища.
+//
+// Журнал — текстовый файл, по одной JSON-записи на строку. Для counter в журнал
+// пишется абсолютное значение после изменения, а не приращение, поэтому повторное
+// проигрывание записей идемпотентно: журнал можно безопасно проигрывать поверх
+// снимка, даже если часть записей в снимок уже попала.
+//
+// Компактификация: Rotate переименовывает текущий журнал в <path>.old и начинает
+// новый; после успешной записи снимка RemoveOld удаляет старый журнал.
+// Replay проигрывает <path>.old (если остался после падения), затем <path>.
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Политики fsync
+const (
+	SyncAlways   = "always"   // fsync после каждой записи
+	SyncInterval = "interval" // fsync не чаще, чем раз в интервал
+	SyncNever    = "never"    // fsync оставляем ОС
+)
+
+// Операции записей журнала
+const (
+	OpGauge   = "gauge"   // установка gauge
+	OpCounter = "counter" // абсолютное значение counter
+	OpReset   = "reset"   // очистка хранилища (замена снимком)
+)
+
+// Record — одна запись журнала.
+type Record struct {
+	Op      string  `json:"op"`
+	ID      string  `json:"id,omitempty"`
+	Value   float64 `json:"v,omitempty"` // для OpGauge
+	Counter int64   `json:"c,omitempty"` // для OpCounter — абсолютное значение
+}
+
+// Log — открытый на запись журнал.
+type Log struct {
+	path     string
+	policy   string
+	interval time.Duration
+
+	mu    sync.Mutex
+	f     *os.File
+	w     *bufio.Writer
+	dirty bool // есть записи без fsync (для SyncInterval)
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// Open открывает (или создаёт) журнал по пути path.
+// Для SyncInterval запускается фоновый fsync каждые interval.
+func Open(path, policy string, interval time.Duration) (*Log, error) {
+	switch policy {
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, fmt.Errorf("wal: unknown fsync policy %q", policy)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("wal: open: %w", err)
+	}
+	l := &Log{
+		path:     path,
+		policy:   policy,
+		interval: interval,
+		f:        f,
+		w:        bufio.NewWriter(f),
+		done:     make(chan struct{}),
+	}
+	if policy == SyncInterval && interval > 0 {
+		l.wg.Add(1)
+		go l.syncLoop()
+	}
+	return l, nil
+}
+
+// Append дописывает записи в журнал одним блоком.
+// Данные всегда передаются ОС (переживают падение процесса);
+// переживут ли они падение ОС — зависит от политики fsync.
+func (l *Log) Append(recs ...Record) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf) // Encode сам добавляет перевод строки
+	for _, r := range recs {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("wal: encode: %w", err)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return errors.New("wal: log is closed")
+	}
+	if _, err := l.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("wal: write: %w", err)
+	}
+	if err := l.w.Flush(); err != nil {
+		return fmt.Errorf("wal: flush: %w", err)
+	}
+	if l.policy == SyncAlways {
+		return l.f.Sync()
+	}
+	l.dirty = true
+	return nil
+}
+
+func (l *Log) syncLoop() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			if l.dirty && l.f != nil {
+				_ = l.f.Sync()
+				l.dirty = false
+			}
+			l.mu.Unlock()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// OldPath возвращает путь к журналу, ожидающему удаления после снимка.
+func (l *Log) OldPath() string { return l.path + ".old" }
+
+// Rotate закрывает текущий журнал, переносит его в <path>.old и открывает новый.
+// Если <path>.old уже существует (прошлая компактификация не завершилась),
+// текущий журнал дописывается в его конец.
+func (l *Log) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return errors.New("wal: log is closed")
+	}
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	l.f = nil
+
+	if _, err := os.Stat(l.OldPath()); err == nil {
+		if err := appendFile(l.OldPath(), l.path); err != nil {
+			return err
+		}
+		if err := os.Remove(l.path); err != nil {
+			return err
+		}
+	} else if err := os.Rename(l.path, l.OldPath()); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("wal: reopen: %w", err)
+	}
+	l.f = f
+	l.w.Reset(f)
+	l.dirty = false
+	return nil
+}
+
+// RemoveOld удаляет журнал, записи которого уже попали в снимок.
+func (l *Log) RemoveOld() error {
+	if err := os.Remove(l.OldPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Truncate отбрасывает все записи журнала (и старого, и текущего).
+func (l *Log) Truncate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return errors.New("wal: log is closed")
+	}
+	l.w.Reset(l.f)
+	if err := l.f.Truncate(0); err != nil {
+		return err
+	}
+	l.dirty = false
+	return l.RemoveOld()
+}
+
+// Close сбрасывает буфер, делает fsync и закрывает журнал.
+func (l *Log) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.wg.Wait()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.f == nil {
+			return
+		}
+		if err = l.w.Flush(); err == nil {
+			err = l.f.Sync()
+		}
+		if cerr := l.f.Close(); err == nil {
+			err = cerr
+		}
+		l.f = nil
+	})
+	return err
+}
+
+// Replay проигрывает записи <path>.old и <path> по порядку.
+// Обрезанная последняя строка (падение посреди записи) игнорируется.
+func Replay(path string, fn func(Record) error) (int, error) {
+	total := 0
+	for _, p := range []string{path + ".old", path} {
+		n, err := replayFile(p, fn)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func replayFile(path string, fn func(Record) error) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n := 0
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// строка без перевода строки — недописанная запись, пропускаем
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return n, fmt.Errorf("wal: %s: corrupt record #%d: %w", path, n+1, err)
+		}
+		if err := fn(rec); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// appendFile дописывает содержимое src в конец dst и делает fsync.
+func appendFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,68 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collect(t *testing.T, path string) []Record {
+	t.Helper()
+	var got []Record
+	_, err := Replay(path, func(r Record) error {
+		got = append(got, r)
+		return nil
+	})
+	require.NoError(t, err)
+	return got
+}
+
+func TestAppendReplay_SkipsTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	l, err := Open(path, SyncAlways, 0)
+	require.NoError(t, err)
+	require.NoError(t, l.Append(
+		Record{Op: OpGauge, ID: "Alloc", Value: 1.5},
+		Record{Op: OpCounter, ID: "PollCount", Counter: 3},
+	))
+	require.NoError(t, l.Close())
+
+	// имитируем падение посреди записи
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"counter","id":"PollC`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	got := collect(t, path)
+	require.Len(t, got, 2)
+	assert.Equal(t, Record{Op: OpCounter, ID: "PollCount", Counter: 3}, got[1])
+}
+
+func TestRotateRemoveOld(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	l, err := Open(path, SyncNever, 0)
+	require.NoError(t, err)
+	defer l.Close()
+
+	require.NoError(t, l.Append(Record{Op: OpGauge, ID: "a", Value: 1}))
+	require.NoError(t, l.Rotate())
+	require.NoError(t, l.Append(Record{Op: OpGauge, ID: "b", Value: 2}))
+
+	// до удаления .old проигрываются оба журнала по порядку
+	got := collect(t, path)
+	require.Len(t, got, 2)
+	assert.Equal(t, "a", got[0].ID)
+	assert.Equal(t, "b", got[1].ID)
+
+	require.NoError(t, l.RemoveOld())
+	got = collect(t, path)
+	require.Len(t, got, 1)
+	assert.Equal(t, "b", got[0].ID)
+
+	_, err = Open(path, "sometimes", 0)
+	assert.Error(t, err)
+}
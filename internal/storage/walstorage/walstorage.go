@@ -0,0 +1,191 @@
+// Package walstorage — декоратор interfaces.Store, журналирующий каждое изменение в WAL.
+//
+// Каждый SetGauge, IncrementCounter и SetMetrics сначала применяется к внутреннему
+// хранилищу, затем итоговые значения дописываются в журнал; ошибка журнала
+// возвращается вызывающему. Записи сериализуются, чтобы порядок в журнале
+// совпадал с порядком применения.
+package walstorage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/consts"
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/snapshot"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/wal"
+)
+
+// Store журналирует изменения внутреннего хранилища.
+type Store struct {
+	interfaces.Store // чтение делегируется как есть
+
+	log *wal.Log
+	mu  sync.Mutex // сериализует изменения и компактификацию
+}
+
+// New оборачивает inner журналом log.
+func New(inner interfaces.Store, log *wal.Log) *Store {
+	return &Store{Store: inner, log: log}
+}
+
+// Replay проигрывает журнал по пути path поверх inner (обычно — после загрузки снимка).
+// Возвращает число проигранных записей.
+func Replay(ctx context.Context, inner interfaces.Store, path string) (int, error) {
+	return wal.Replay(path, func(r wal.Record) error {
+		switch r.Op {
+		case wal.OpGauge:
+			return inner.SetGauge(ctx, r.ID, r.Value)
+		case wal.OpCounter:
+			delta := r.Counter
+			return snapshot.Apply(ctx, inner,
+				[]dto.Metrics{{ID: r.ID, MType: consts.MetricTypeCounter, Delta: &delta}}, snapshot.ModeMerge)
+		case wal.OpReset:
+			rp, ok := inner.(interfaces.Replacer)
+			if !ok {
+				return fmt.Errorf("walstorage: %s does not support reset", inner.StorageType())
+			}
+			return rp.Replace(ctx, nil, nil)
+		default:
+			return fmt.Errorf("walstorage: unknown record op %q", r.Op)
+		}
+	})
+}
+
+func (s *Store) SetGauge(ctx context.Context, name string, value float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Store.SetGauge(ctx, name, value); err != nil {
+		return err
+	}
+	return s.log.Append(wal.Record{Op: wal.OpGauge, ID: name, Value: value})
+}
+
+func (s *Store) IncrementCounter(ctx context.Context, name string, value int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Store.IncrementCounter(ctx, name, value); err != nil {
+		return err
+	}
+	abs, _, err := s.Store.GetCounter(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.log.Append(wal.Record{Op: wal.OpCounter, ID: name, Counter: abs})
+}
+
+func (s *Store) SetMetrics(ctx context.Context, items []dto.Metrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Store.SetMetrics(ctx, items); err != nil {
+		return err
+	}
+
+	// пишем итоговые значения; повторы одного ID в батче схлопываем
+	recs := make([]wal.Record, 0, len(items))
+	seen := make(map[string]struct{}, len(items))
+	for _, m := range items {
+		key := m.MType + "/" + m.ID
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+		switch m.MType {
+		case consts.MetricTypeGauge:
+			v, ok, err := s.Store.GetGauge(ctx, m.ID)
+			if err != nil {
+				return err
+			}
+			if ok {
+				recs = append(recs, wal.Record{Op: wal.OpGauge, ID: m.ID, Value: v})
+			}
+		case consts.MetricTypeCounter:
+			v, ok, err := s.Store.GetCounter(ctx, m.ID)
+			if err != nil {
+				return err
+			}
+			if ok {
+				recs = append(recs, wal.Record{Op: wal.OpCounter, ID: m.ID, Counter: v})
+			}
+		}
+	}
+	return s.log.Append(recs...)
+}
+
+// Snapshot возвращает согласованный снимок внутреннего хранилища.
+func (s *Store) Snapshot(ctx context.Context) (map[string]float64, map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return snapshot.Read(ctx, s.Store)
+}
+
+// Replace заменяет содержимое и журналирует это как reset + новые значения.
+func (s *Store) Replace(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	rp, ok := s.Store.(interfaces.Replacer)
+	if !ok {
+		return snapshot.ErrReplaceUnsupported
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := rp.Replace(ctx, gauges, counters); err != nil {
+		return err
+	}
+	recs := make([]wal.Record, 0, len(gauges)+len(counters)+1)
+	recs = append(recs, wal.Record{Op: wal.OpReset})
+	for id, v := range gauges {
+		recs = append(recs, wal.Record{Op: wal.OpGauge, ID: id, Value: v})
+	}
+	for id, v := range counters {
+		recs = append(recs, wal.Record{Op: wal.OpCounter, ID: id, Counter: v})
+	}
+	return s.log.Append(recs...)
+}
+
+// Merge сливает снимок с внутренним хранилищем и журналирует итоговые значения.
+func (s *Store) Merge(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	mg, ok := s.Store.(interfaces.Merger)
+	if !ok {
+		return snapshot.ErrMergeUnsupported
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := mg.Merge(ctx, gauges, counters); err != nil {
+		return err
+	}
+	recs := make([]wal.Record, 0, len(gauges)+len(counters))
+	for id, v := range gauges {
+		recs = append(recs, wal.Record{Op: wal.OpGauge, ID: id, Value: v})
+	}
+	for id, v := range counters {
+		recs = append(recs, wal.Record{Op: wal.OpCounter, ID: id, Counter: v})
+	}
+	return s.log.Append(recs...)
+}
+
+// Compact снимает снимок и ротирует журнал в одной критической секции,
+// сохраняет снимок через save и удаляет вошедший в него журнал.
+// Если save упал, старый журнал остаётся и будет проигран при рестарте.
+func (s *Store) Compact(ctx context.Context, save func(items []dto.Metrics) error) error {
+	s.mu.Lock()
+	items, err := snapshot.Take(ctx, s.Store)
+	if err == nil {
+		err = s.log.Rotate()
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := save(items); err != nil {
+		return err
+	}
+	return s.log.RemoveOld()
+}
+
+func (s *Store) StorageType() string {
+	return s.Store.StorageType() + "+wal"
+}
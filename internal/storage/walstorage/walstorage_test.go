@@ -0,0 +1,79 @@
+package walstorage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+	"github.com/SamSafonov2025/metrics-tpl/internal/interfaces"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/memstorage"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/storetest"
+	"github.com/SamSafonov2025/metrics-tpl/internal/storage/wal"
+)
+
+func TestReplayRestoresAndIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	l, err := wal.Open(path, wal.SyncAlways, 0)
+	require.NoError(t, err)
+
+	s := New(memstorage.New(), l)
+	require.NoError(t, s.SetGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 2))
+	delta := int64(5)
+	require.NoError(t, s.SetMetrics(ctx, []dto.Metrics{
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+	}))
+	require.NoError(t, l.Close())
+
+	// журнал хранит абсолютные значения — повторное проигрывание ничего не удваивает
+	dst := memstorage.New()
+	for i := 0; i < 2; i++ {
+		_, err := Replay(ctx, dst, path)
+		require.NoError(t, err)
+	}
+	v, _, _ := dst.GetCounter(ctx, "PollCount")
+	assert.Equal(t, int64(12), v)
+	g, _, _ := dst.GetGauge(ctx, "Alloc")
+	assert.Equal(t, 1.5, g)
+}
+
+func TestCompactDropsSnapshottedRecords(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	l, err := wal.Open(path, wal.SyncNever, 0)
+	require.NoError(t, err)
+	defer l.Close()
+
+	s := New(memstorage.New(), l)
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 1))
+
+	var saved []dto.Metrics
+	require.NoError(t, s.Compact(ctx, func(items []dto.Metrics) error {
+		saved = items
+		return nil
+	}))
+	require.Len(t, saved, 1)
+	assert.Equal(t, int64(1), *saved[0].Delta)
+
+	require.NoError(t, s.IncrementCounter(ctx, "PollCount", 1))
+	n, err := wal.Replay(path, func(wal.Record) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "only records after the snapshot remain")
+	assert.Equal(t, "ms+wal", s.StorageType())
+}
+
+// TestConformance — backend "file" с журналом.
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.Store {
+		l, err := wal.Open(filepath.Join(t.TempDir(), "metrics.wal"), wal.SyncNever, 0)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = l.Close() })
+		return New(memstorage.New(), l)
+	})
+}
@@ -0,0 +1,159 @@
+// Package stream рассылает подписчикам события об успешных обновлениях метрик.
+//
+// Каждый подписчик получает ограниченный буфер; если клиент не успевает
+// читать, события отбрасываются согласно политике (старые или новые),
+// поэтому медленные клиенты не тормозят приём метрик.
+package stream
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+)
+
+// Политики отбрасывания событий при переполнении буфера подписчика
+const (
+	DropOldest = "oldest" // вытесняем самое старое событие из буфера
+	DropNewest = "newest" // отбрасываем новое событие
+)
+
+// Event — событие обновления метрики.
+// Для counter поле Delta содержит приращение из запроса, а не итоговое значение.
+type Event struct {
+	dto.Metrics
+	Timestamp int64 `json:"ts"` // unix timestamp обновления в миллисекундах
+}
+
+// Subscriber — подписка на поток событий.
+type Subscriber struct {
+	ch       chan Event
+	patterns []string
+	dropped  atomic.Uint64
+}
+
+// Events возвращает канал событий подписчика.
+func (s *Subscriber) Events() <-chan Event { return s.ch }
+
+// Dropped возвращает количество отброшенных для подписчика событий.
+func (s *Subscriber) Dropped() uint64 { return s.dropped.Load() }
+
+// match проверяет имя метрики по glob-шаблонам подписки (path.Match).
+// Пустой список шаблонов пропускает все метрики.
+func (s *Subscriber) match(name string) bool {
+	if len(s.patterns) == 0 {
+		return true
+	}
+	for _, p := range s.patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Hub хранит подписчиков и рассылает им события.
+type Hub struct {
+	bufSize int
+	policy  string
+
+	mu     sync.RWMutex
+	subs   map[*Subscriber]struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// NewHub создаёт хаб с буфером bufSize событий на подписчика
+// и политикой отбрасывания policy (DropOldest или DropNewest).
+func NewHub(bufSize int, policy string) *Hub {
+	if bufSize < 1 {
+		bufSize = 1
+	}
+	if policy != DropNewest {
+		policy = DropOldest
+	}
+	return &Hub{
+		bufSize: bufSize,
+		policy:  policy,
+		subs:    make(map[*Subscriber]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Subscribe создаёт подписку. pattern — список glob-шаблонов имён через запятую
+// (например, "CPU*,FreeMemory"); пустая строка — все метрики.
+func (h *Hub) Subscribe(pattern string) *Subscriber {
+	s := &Subscriber{ch: make(chan Event, h.bufSize)}
+	for _, p := range strings.Split(pattern, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			s.patterns = append(s.patterns, p)
+		}
+	}
+
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+// Unsubscribe удаляет подписку.
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
+
+// Publish рассылает события об обновлении метрик всем подходящим подписчикам.
+// Никогда не блокируется.
+func (h *Hub) Publish(items []dto.Metrics) {
+	ts := time.Now().UnixMilli()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subs {
+		for _, m := range items {
+			if s.match(m.ID) {
+				h.offer(s, Event{Metrics: m, Timestamp: ts})
+			}
+		}
+	}
+}
+
+// offer кладёт событие в буфер подписчика, применяя политику при переполнении.
+func (h *Hub) offer(s *Subscriber, e Event) {
+	select {
+	case s.ch <- e:
+		return
+	default:
+	}
+	s.dropped.Add(1)
+	if h.policy == DropNewest {
+		return
+	}
+	// DropOldest: освобождаем место и пробуем ещё раз; при гонке с читателем
+	// событие может быть просто отброшено — это допустимо
+	select {
+	case <-s.ch:
+	default:
+	}
+	select {
+	case s.ch <- e:
+	default:
+	}
+}
+
+// Done закрывается при остановке хаба; обработчики потоков должны завершиться.
+func (h *Hub) Done() <-chan struct{} { return h.done }
+
+// Close останавливает хаб: активные потоки завершаются, чтобы не задерживать shutdown сервера.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed {
+		h.closed = true
+		close(h.done)
+	}
+}
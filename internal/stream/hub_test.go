@@ -0,0 +1,54 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SamSafonov2025/metrics-tpl/internal/dto"
+)
+
+func gauge(id string, v float64) dto.Metrics {
+	return dto.Metrics{ID: id, MType: "gauge", Value: &v}
+}
+
+func TestHub_PatternFilter(t *testing.T) {
+	h := NewHub(10, DropOldest)
+	s := h.Subscribe("CPU*, FreeMemory")
+	defer h.Unsubscribe(s)
+
+	h.Publish([]dto.Metrics{gauge("CPUutilization1", 1), gauge("Alloc", 2), gauge("FreeMemory", 3)})
+
+	assert.Len(t, s.Events(), 2)
+	assert.Equal(t, "CPUutilization1", (<-s.Events()).ID)
+	assert.Equal(t, "FreeMemory", (<-s.Events()).ID)
+}
+
+func TestHub_DropPolicies(t *testing.T) {
+	for _, tc := range []struct{ policy string }{{DropOldest}, {DropNewest}} {
+		h := NewHub(2, tc.policy)
+		s := h.Subscribe("")
+		h.Publish([]dto.Metrics{gauge("m0", 0), gauge("m1", 1), gauge("m2", 2)})
+
+		assert.Equal(t, uint64(1), s.Dropped(), tc.policy)
+		assert.Len(t, s.Events(), 2, tc.policy)
+		got := []string{(<-s.Events()).ID, (<-s.Events()).ID}
+		if tc.policy == DropOldest {
+			assert.Equal(t, []string{"m1", "m2"}, got)
+		} else {
+			assert.Equal(t, []string{"m0", "m1"}, got)
+		}
+	}
+}
+
+func TestHub_Unsubscribe(t *testing.T) {
+	h := NewHub(1, DropOldest)
+	s := h.Subscribe("")
+	h.Unsubscribe(s)
+	h.Publish([]dto.Metrics{gauge("m", 1)})
+	assert.Len(t, s.Events(), 0)
+
+	h.Close()
+	h.Close() // повторный вызов безопасен
+	<-h.Done()
+}
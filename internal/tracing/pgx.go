@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer — pgx.QueryTracer, открывающий спан на каждый SQL-запрос пула
+// (включая BEGIN/COMMIT транзакций dbstorage). Спаны создаются только внутри
+// уже идущей трассы: фоновые запросы (выборы лидера, LISTEN) трассы не плодят.
+type QueryTracer struct{}
+
+var _ pgx.QueryTracer = QueryTracer{}
+
+type querySpanKey struct{}
+
+// TraceQueryStart открывает спан запроса.
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	sql := strings.Join(strings.Fields(data.SQL), " ")
+	op := operation(sql)
+	ctx, span := Start(ctx, "db "+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", op),
+			attribute.String("db.query.text", sql),
+		),
+	)
+	return context.WithValue(ctx, querySpanKey{}, span)
+}
+
+// TraceQueryEnd закрывает спан запроса.
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span, ok := ctx.Value(querySpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	if data.Err == nil {
+		span.SetAttributes(attribute.Int64("db.response.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	End(span, data.Err)
+}
+
+// operation — первое слово запроса в верхнем регистре ("INSERT", "SELECT", "BEGIN").
+func operation(sql string) string {
+	op, _, _ := strings.Cut(sql, " ")
+	op = strings.ToUpper(strings.TrimSuffix(op, ";"))
+	if op == "" {
+		return "QUERY"
+	}
+	return op
+}
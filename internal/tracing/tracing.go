@@ -0,0 +1,112 @@
+// Package tracing — распределённая трассировка (OpenTelemetry) агента и сервера.
+//
+// Init настраивает глобальный TracerProvider и W3C-пропагатор traceparent:
+// агент кладёт контекст трассы в заголовки запроса (Inject), сервер продолжает
+// её в Middleware, поэтому батч виден одной трассой от отправки до SQL-запросов.
+// Пока Init не вызван, Start возвращает no-op спаны и ничего не стоит.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Экспортёры спанов.
+const (
+	ExporterNone   = "none"   // трассировка выключена
+	ExporterStdout = "stdout" // спаны в stdout (локальная отладка, тесты)
+	ExporterOTLP   = "otlp"   // OTLP/HTTP на коллектор (Jaeger, Tempo, otel-collector)
+)
+
+// DefaultOTLPEndpoint — адрес OTLP/HTTP коллектора по умолчанию.
+const DefaultOTLPEndpoint = "localhost:4318"
+
+const instrumentationName = "github.com/SamSafonov2025/metrics-tpl"
+
+// Init настраивает экспорт спанов сервиса service и W3C-пропагацию.
+// endpoint используется только экспортёром otlp: "host:port" (без TLS)
+// или полный URL ("https://collector:4318").
+// Возвращённый shutdown дописывает накопленные спаны; его нужно вызвать при остановке.
+func Init(ctx context.Context, service, exporter, endpoint string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var exp sdktrace.SpanExporter
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx, otlpOptions(endpoint)...)
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q (want %s | %s | %s)",
+			exporter, ExporterNone, ExporterStdout, ExporterOTLP)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %s exporter: %w", exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", service),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// otlpOptions переводит endpoint из конфига в опции OTLP/HTTP экспортёра.
+func otlpOptions(endpoint string) []otlptracehttp.Option {
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+	if strings.Contains(endpoint, "://") {
+		return []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint)}
+	}
+	return []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure()}
+}
+
+// Start открывает спан name — дочерний к спану из ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End закрывает спан, отмечая его ошибкой, если err != nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject кладёт контекст трассы из ctx в заголовки исходящего запроса (traceparent).
+func Inject(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// Extract достаёт контекст трассы из заголовков входящего запроса.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(h))
+}
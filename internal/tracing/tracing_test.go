@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// record подменяет глобальный TracerProvider на запоминающий спаны.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	_, err := Init(context.Background(), "test", ExporterNone, "")
+	require.NoError(t, err)
+
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func attr(s sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestInit(t *testing.T) {
+	for _, exp := range []string{"", ExporterNone, ExporterStdout, ExporterOTLP} {
+		shutdown, err := Init(context.Background(), "test", exp, "localhost:4318")
+		require.NoError(t, err, exp)
+		require.NoError(t, shutdown(context.Background()), exp)
+	}
+	otel.SetTracerProvider(noop.NewTracerProvider())
+
+	_, err := Init(context.Background(), "test", "jaeger", "")
+	assert.Error(t, err)
+}
+
+func TestMiddleware_ContinuesRemoteTrace(t *testing.T) {
+	rec := record(t)
+
+	// клиент: спан, контекст которого уходит в traceparent
+	ctx, client := Start(context.Background(), "client")
+	req := httptest.NewRequest(http.MethodPost, "/update/gauge/x/1", nil)
+	Inject(ctx, req.Header)
+	client.End()
+	require.NotEmpty(t, req.Header.Get("traceparent"))
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Post("/update/{metricType}/{metricName}/{metricValue}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "handler")
+		span.End()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	require.Len(t, spans, 3)
+	handler, server := spans[1], spans[2]
+	traceID := client.SpanContext().TraceID()
+
+	assert.Equal(t, "POST /update/{metricType}/{metricName}/{metricValue}", server.Name())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, traceID, server.SpanContext().TraceID())
+	assert.Equal(t, client.SpanContext().SpanID(), server.Parent().SpanID())
+	assert.True(t, server.Parent().IsRemote())
+	assert.Equal(t, int64(500), attr(server, "http.response.status_code").AsInt64())
+	assert.Equal(t, codes.Error, server.Status().Code)
+
+	assert.Equal(t, traceID, handler.SpanContext().TraceID())
+	assert.Equal(t, server.SpanContext().SpanID(), handler.Parent().SpanID())
+}
+
+func TestQueryTracer(t *testing.T) {
+	rec := record(t)
+	var qt QueryTracer
+
+	// вне трассы спаны не создаются
+	ctx := qt.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	qt.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	assert.Empty(t, rec.Ended())
+
+	parent, span := Start(context.Background(), "parent")
+	ctx = qt.TraceQueryStart(parent, nil, pgx.TraceQueryStartData{SQL: `
+		INSERT INTO gauge (id, value)
+		VALUES ($1, $2);`})
+	qt.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("INSERT 0 2")})
+	span.End()
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	q := spans[0]
+	assert.Equal(t, "db INSERT", q.Name())
+	assert.Equal(t, span.SpanContext().SpanID(), q.Parent().SpanID())
+	assert.Equal(t, "INSERT INTO gauge (id, value) VALUES ($1, $2);", attr(q, "db.query.text").AsString())
+	assert.Equal(t, int64(2), attr(q, "db.response.rows_affected").AsInt64())
+}